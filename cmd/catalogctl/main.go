@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"search-ec2/internal/config"
+	"search-ec2/internal/models"
+	"search-ec2/internal/services"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// catalogctl 商品目录运维工具
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	// 加载配置
+	if err := config.Load(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// 设置日志
+	setupLogger()
+
+	command, args := os.Args[1], os.Args[2:]
+	switch command {
+	case "migrate-ids":
+		runMigrateIDs(args)
+	case "export":
+		runExport(args)
+	case "restore":
+		runRestore(args)
+	case "snapshot":
+		runSnapshot(args)
+	case "reindex":
+		runReindex(args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// usage 打印使用说明
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: catalogctl <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  migrate-ids   rewrite existing points to deterministic product/variant IDs")
+	fmt.Fprintln(os.Stderr, "  export        stream all products with variants as JSONL")
+	fmt.Fprintln(os.Stderr, "  restore       restore products from an export file without calling the LLM or embedding APIs")
+	fmt.Fprintln(os.Stderr, "  snapshot      create | list | download | delete | restore collection snapshots")
+	fmt.Fprintln(os.Stderr, "  reindex       start | switch | rollback | collections | drop: rebuild into a new collection and switch the alias")
+}
+
+// newQdrantService 创建 Qdrant 服务，失败时退出
+func newQdrantService() *services.QdrantService {
+	qdrantService, err := services.NewQdrantService()
+	if err != nil {
+		logrus.Fatalf("Failed to initialize Qdrant service: %v", err)
+	}
+	return qdrantService
+}
+
+// runExport 导出商品目录
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("o", "", "output file (default stdout)")
+	withVectors := fs.Bool("vectors", true, "include variant vectors (required for restore)")
+	fs.Parse(args)
+
+	writer := os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			logrus.Fatalf("Failed to create output file: %v", err)
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	buffered := bufio.NewWriter(writer)
+	count, err := newQdrantService().ExportProducts(buffered, services.ExportOptions{WithVectors: *withVectors})
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		logrus.Fatalf("Export failed after %d products: %v", count, err)
+	}
+
+	logrus.Infof("Exported %d products", count)
+}
+
+// runRestore 从导出文件恢复商品
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	input := fs.String("i", "", "export file to restore (default stdin)")
+	fs.Parse(args)
+
+	reader := os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			logrus.Fatalf("Failed to open input file: %v", err)
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	result, err := newQdrantService().RestoreProducts(reader)
+	if err != nil {
+		logrus.Fatalf("Restore failed: %v", err)
+	}
+
+	for _, item := range result.Errors {
+		logrus.Warnf("line %d (%s): %s", item.Line, item.Product, item.Error)
+	}
+	logrus.Infof("Restore finished: restored=%d failed=%d", result.Restored, result.Failed)
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runSnapshot 管理集合快照
+func runSnapshot(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: catalogctl snapshot <create|list|download|delete|restore> [flags]")
+		os.Exit(2)
+	}
+
+	action, args := args[0], args[1:]
+	fs := flag.NewFlagSet("snapshot "+action, flag.ExitOnError)
+	name := fs.String("name", "", "snapshot name (download, delete)")
+	file := fs.String("file", "", "snapshot file (download output, restore input)")
+	fs.Parse(args)
+
+	qdrantService := newQdrantService()
+	switch action {
+	case "create":
+		snapshot, err := qdrantService.CreateSnapshot()
+		if err != nil {
+			logrus.Fatalf("Failed to create snapshot: %v", err)
+		}
+		fmt.Println(snapshot.Name)
+	case "list":
+		snapshots, err := qdrantService.ListSnapshots()
+		if err != nil {
+			logrus.Fatalf("Failed to list snapshots: %v", err)
+		}
+		for _, snapshot := range snapshots {
+			fmt.Printf("%s\t%d\t%s\n", snapshot.Name, snapshot.Size, snapshot.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+	case "download":
+		if *name == "" {
+			logrus.Fatal("-name is required")
+		}
+		path := *file
+		if path == "" {
+			path = *name
+		}
+		out, err := os.Create(path)
+		if err != nil {
+			logrus.Fatalf("Failed to create output file: %v", err)
+		}
+		defer out.Close()
+		written, err := qdrantService.DownloadSnapshot(*name, out)
+		if err != nil {
+			logrus.Fatalf("Failed to download snapshot: %v", err)
+		}
+		logrus.Infof("Snapshot %s saved to %s (%d bytes)", *name, path, written)
+	case "delete":
+		if *name == "" {
+			logrus.Fatal("-name is required")
+		}
+		if err := qdrantService.DeleteSnapshot(*name); err != nil {
+			logrus.Fatalf("Failed to delete snapshot: %v", err)
+		}
+	case "restore":
+		if *file == "" {
+			logrus.Fatal("-file is required")
+		}
+		in, err := os.Open(*file)
+		if err != nil {
+			logrus.Fatalf("Failed to open snapshot file: %v", err)
+		}
+		defer in.Close()
+		if err := qdrantService.RestoreSnapshot(in, filepath.Base(*file)); err != nil {
+			logrus.Fatalf("Failed to restore snapshot: %v", err)
+		}
+		logrus.Infof("Collection restored from %s", *file)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown snapshot action: %s\n", action)
+		os.Exit(2)
+	}
+}
+
+// runReindex 重建索引与版本化集合管理
+// 命令行与服务共用任务目录，但各自只在内存中跟踪自己启动的任务；模型变化时切换后需要更新配置并重启服务
+func runReindex(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: catalogctl reindex <start|switch|rollback|collections|drop> [flags]")
+		os.Exit(2)
+	}
+
+	action, args := args[0], args[1:]
+	fs := flag.NewFlagSet("reindex "+action, flag.ExitOnError)
+	model := fs.String("model", "", "embedding model for the new collection (start, default current model)")
+	vectorSize := fs.Int("vector-size", 0, "vector size of the new model (start, default probed)")
+	regenerate := fs.Bool("regenerate", false, "regenerate variants with the LLM instead of re-embedding stored texts (start)")
+	autoSwitch := fs.Bool("switch", false, "switch the alias when the rebuild passes validation (start)")
+	dropLegacy := fs.Bool("drop-legacy", false, "allow deleting a physical collection_name collection to create the alias (start)")
+	jobID := fs.String("id", "", "reindex job id (switch)")
+	force := fs.Bool("force", false, "switch even if validation fails (switch)")
+	name := fs.String("name", "", "collection name (drop)")
+	fs.Parse(args)
+
+	qdrantService := newQdrantService()
+	reindexManager, err := services.NewReindexManager(qdrantService, nil, services.NewVariantGenerationService())
+	if err != nil {
+		logrus.Fatalf("Failed to initialize reindex manager: %v", err)
+	}
+
+	switch action {
+	case "start":
+		job, err := reindexManager.Start(models.ReindexOptions{
+			EmbeddingModel:     *model,
+			VectorSize:         *vectorSize,
+			RegenerateVariants: *regenerate,
+			AutoSwitch:         *autoSwitch,
+			DropLegacy:         *dropLegacy,
+		})
+		if err != nil {
+			logrus.Fatalf("Failed to start reindex: %v", err)
+		}
+		logrus.Infof("Reindex job %s: %s -> %s", job.ID, job.SourceCollection, job.TargetCollection)
+
+		// 等待构建（以及自动切换）完成
+		for job.Status == models.ReindexRunning || (*autoSwitch && job.Status == models.ReindexReady && job.Message == "") {
+			time.Sleep(5 * time.Second)
+			if job, err = reindexManager.Get(job.ID); err != nil {
+				logrus.Fatalf("Failed to get reindex job: %v", err)
+			}
+			logrus.Infof("Reindex progress: %d/%d processed, %d failed", job.Processed, job.Total, job.Failed)
+		}
+		printReindexJob(job)
+	case "switch":
+		if *jobID == "" {
+			logrus.Fatal("-id is required")
+		}
+		job, err := reindexManager.Switch(*jobID, *force)
+		if err != nil {
+			logrus.Fatalf("Failed to switch: %v", err)
+		}
+		printReindexJob(job)
+	case "rollback":
+		job, err := reindexManager.Rollback()
+		if err != nil {
+			logrus.Fatalf("Failed to roll back: %v", err)
+		}
+		printReindexJob(job)
+	case "collections":
+		versions, err := qdrantService.ListCollectionVersions()
+		if err != nil {
+			logrus.Fatalf("Failed to list collections: %v", err)
+		}
+		for _, version := range versions {
+			live := ""
+			if version.Live {
+				live = "live"
+			}
+			fmt.Printf("%s\t%d\t%d\t%s\n", version.Name, version.Points, version.VectorSize, live)
+		}
+	case "drop":
+		if *name == "" {
+			logrus.Fatal("-name is required")
+		}
+		if err := qdrantService.DeleteCollectionVersion(*name); err != nil {
+			logrus.Fatalf("Failed to delete collection: %v", err)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown reindex action: %s\n", action)
+		os.Exit(2)
+	}
+}
+
+// printReindexJob 输出重建任务结果
+func printReindexJob(job *models.ReindexJob) {
+	for _, item := range job.Errors {
+		logrus.Warnf("product %s: %s", item.Product, item.Error)
+	}
+	if job.Validation != nil {
+		logrus.Infof("Validation: source=%d target=%d passed=%v",
+			job.Validation.SourceCount, job.Validation.TargetCount, job.Validation.Passed)
+	}
+	logrus.Infof("Reindex job %s %s: %s -> %s, processed=%d failed=%d caught_up=%d %s", job.ID, job.Status,
+		job.SourceCollection, job.TargetCollection, job.Processed, job.Failed, job.CaughtUp, job.Message)
+}
+
+// runMigrateIDs 执行点 ID 迁移
+func runMigrateIDs(args []string) {
+	fs := flag.NewFlagSet("migrate-ids", flag.ExitOnError)
+	batchSize := fs.Uint("batch", 256, "points per scroll batch")
+	dryRun := fs.Bool("dry-run", false, "only report what would be migrated")
+	fs.Parse(args)
+
+	result, err := newQdrantService().MigratePointIDs(uint32(*batchSize), *dryRun)
+	if err != nil {
+		logrus.Fatalf("Point ID migration failed: %v", err)
+	}
+
+	logrus.Infof("Point ID migration finished: scanned=%d migrated=%d skipped=%d invalid=%d dry_run=%v",
+		result.Scanned, result.Migrated, result.Skipped, result.Invalid, *dryRun)
+}
+
+// setupLogger 设置日志
+func setupLogger() {
+	level, err := logrus.ParseLevel(config.AppConfig.Logging.Level)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logrus.SetLevel(level)
+
+	if config.AppConfig.Logging.Format == "json" {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logrus.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp: true,
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 属性类型
+const (
+	AttributeTypeKeyword = "keyword" // 精确匹配的字符串
+	AttributeTypeText    = "text"    // 全文字符串
+	AttributeTypeInteger = "integer"
+	AttributeTypeFloat   = "float"
+	AttributeTypeBool    = "bool"
+)
+
+// AttributeDefinition 属性定义
+type AttributeDefinition struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Filterable  bool   `json:"filterable"` // 创建 payload 索引，用于过滤
+	Facetable   bool   `json:"facetable"`  // 可用于分面统计
+	Searchable  bool   `json:"searchable"` // 属性值参与关键词检索
+}
+
+// AttributeSchema 属性注册表
+type AttributeSchema struct {
+	Strict     bool                  `json:"strict"` // 为 true 时拒绝未注册的自定义属性
+	Attributes []AttributeDefinition `json:"attributes"`
+}
+
+// attributeRegistry 当前生效的属性注册表，更新时整体替换，读取方拿到的注册表不会再被修改
+var attributeRegistry atomic.Pointer[AttributeSchema]
+
+func init() {
+	attributeRegistry.Store(&AttributeSchema{})
+}
+
+// AttributeRegistry 返回当前生效的属性注册表
+func AttributeRegistry() *AttributeSchema {
+	return attributeRegistry.Load()
+}
+
+// Lookup 按名称查找属性定义
+func (s *AttributeSchema) Lookup(name string) (*AttributeDefinition, bool) {
+	if s == nil {
+		return nil, false
+	}
+	for i := range s.Attributes {
+		if s.Attributes[i].Name == name {
+			return &s.Attributes[i], true
+		}
+	}
+	return nil, false
+}
+
+// Validate 校验注册表本身
+func (s *AttributeSchema) Validate() error {
+	seen := make(map[string]bool, len(s.Attributes))
+	for i, attr := range s.Attributes {
+		if attr.Name == "" {
+			return fmt.Errorf("attributes[%d]: name is required", i)
+		}
+		if seen[attr.Name] {
+			return fmt.Errorf("attributes[%d]: duplicate attribute %q", i, attr.Name)
+		}
+		seen[attr.Name] = true
+
+		switch attr.Type {
+		case AttributeTypeKeyword, AttributeTypeInteger, AttributeTypeBool:
+		case AttributeTypeText, AttributeTypeFloat:
+			// Qdrant 只支持对关键字、整数和布尔字段做分面统计
+			if attr.Facetable {
+				return fmt.Errorf("attributes[%d]: %s attribute %q cannot be facetable", i, attr.Type, attr.Name)
+			}
+		default:
+			return fmt.Errorf("attributes[%d]: unsupported type %q for %q", i, attr.Type, attr.Name)
+		}
+	}
+	return nil
+}
+
+// ValidateValues 按注册表校验商品的自定义属性值
+func (s *AttributeSchema) ValidateValues(attributes map[string]interface{}) error {
+	if s == nil {
+		return nil
+	}
+
+	// 按名称排序，保证错误信息稳定
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := attributes[name]
+		attr, ok := s.Lookup(name)
+		if !ok {
+			if s.Strict {
+				return fmt.Errorf("attribute %q is not registered", name)
+			}
+			continue
+		}
+		if value == nil {
+			continue
+		}
+
+		// 数组按元素逐个校验
+		if list, ok := value.([]interface{}); ok {
+			for i, item := range list {
+				if !attr.accepts(item) {
+					return fmt.Errorf("attribute %q[%d]: expected %s, got %v", name, i, attr.Type, item)
+				}
+			}
+			continue
+		}
+		if !attr.accepts(value) {
+			return fmt.Errorf("attribute %q: expected %s, got %v", name, attr.Type, value)
+		}
+	}
+	return nil
+}
+
+// accepts 判断单个值是否符合属性类型
+func (a *AttributeDefinition) accepts(value interface{}) bool {
+	switch a.Type {
+	case AttributeTypeKeyword, AttributeTypeText:
+		_, ok := value.(string)
+		return ok
+	case AttributeTypeBool:
+		_, ok := value.(bool)
+		return ok
+	case AttributeTypeInteger:
+		switch v := value.(type) {
+		case int, int32, int64:
+			return true
+		case float64:
+			return v == math.Trunc(v)
+		}
+	case AttributeTypeFloat:
+		switch value.(type) {
+		case int, int32, int64, float32, float64:
+			return true
+		}
+	}
+	return false
+}
+
+// loadAttributeSchema 加载属性注册表，文件不存在时使用空注册表
+func loadAttributeSchema() error {
+	schemaPath := findConfigFile("attribute_schema.json")
+	if schemaPath == "" {
+		logrus.Warn("attribute_schema.json not found, attribute registry is empty")
+		attributeRegistry.Store(&AttributeSchema{})
+		return nil
+	}
+
+	data, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return fmt.Errorf("failed to read attribute schema: %w", err)
+	}
+
+	schema := &AttributeSchema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return fmt.Errorf("failed to parse attribute schema: %w", err)
+	}
+	if err := schema.Validate(); err != nil {
+		return fmt.Errorf("invalid attribute schema: %w", err)
+	}
+
+	attributeRegistry.Store(schema)
+	return nil
+}
+
+// SaveAttributeSchema 保存属性注册表到文件并替换当前注册表
+func SaveAttributeSchema(schema *AttributeSchema) error {
+	schemaPath := findConfigFile("attribute_schema.json")
+	if schemaPath == "" {
+		schemaPath = "config/attribute_schema.json"
+	}
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal attribute schema: %w", err)
+	}
+	if err := os.WriteFile(schemaPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write attribute schema: %w", err)
+	}
+
+	attributeRegistry.Store(schema)
+	return nil
+}
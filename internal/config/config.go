@@ -18,22 +18,29 @@ type Config struct {
 	Search   SearchConfig   `mapstructure:"search"`
 	Logging  LoggingConfig  `mapstructure:"logging"`
 	Features FeaturesConfig `mapstructure:"features"`
+	Import   ImportConfig   `mapstructure:"import"`
+	Reindex  ReindexConfig  `mapstructure:"reindex"`
+	LLM      LLMConfig      `mapstructure:"llm"`
+	Models   ModelsConfig   `mapstructure:"models"`
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Host string `mapstructure:"host"`
-	Port int    `mapstructure:"port"`
-	Mode string `mapstructure:"mode"`
+	Host           string `mapstructure:"host"`
+	Port           int    `mapstructure:"port"`
+	Mode           string `mapstructure:"mode"`
+	IdempotencyTTL int    `mapstructure:"idempotency_ttl"` // Idempotency-Key 有效期（秒）
 }
 
 // QdrantConfig Qdrant 配置
 type QdrantConfig struct {
 	Host           string `mapstructure:"host"`
 	Port           int    `mapstructure:"port"`
+	HTTPPort       int    `mapstructure:"http_port"` // REST 接口端口，快照下载和恢复使用
 	APIKey         string `mapstructure:"api_key"`
 	CollectionName string `mapstructure:"collection_name"`
-	VectorSize     int    `mapstructure:"vector_size"`
+	VectorSize     int    `mapstructure:"vector_size"` // 必须与 embedding 模型的输出维度一致
+	Distance       string `mapstructure:"distance"`    // Cosine / Dot / Euclid / Manhattan，仅在创建集合时使用
 }
 
 // OpenAIConfig OpenAI 配置
@@ -44,14 +51,100 @@ type OpenAIConfig struct {
 	ChatModel      string `mapstructure:"chat_model"`
 	MaxTokens      int    `mapstructure:"max_tokens"`
 	Timeout        int    `mapstructure:"timeout"`
+	// 对话（查询解析、搜索建议、变体生成）和向量化使用的协议：openai / anthropic / bedrock，默认 openai
+	ChatProvider      string                    `mapstructure:"chat_provider"`
+	EmbeddingProvider string                    `mapstructure:"embedding_provider"`
+	Providers         map[string]ProviderConfig `mapstructure:"providers"` // 按协议覆盖 base_url / api_key
+}
+
+// 模型服务协议
+const (
+	ProviderOpenAI    = "openai"    // OpenAI 兼容的 chat/completions 和 embeddings
+	ProviderAnthropic = "anthropic" // Anthropic Messages API，只支持对话
+	ProviderBedrock   = "bedrock"   // Bedrock InvokeModel 风格的 JSON（Claude 对话、Titan 向量）
+	ProviderTEI       = "tei"       // 本地 Text Embeddings Inference 兼容服务（/embed），只支持向量化
+	ProviderHash      = "hash"      // 进程内基于哈希的确定性向量，用于测试和离线开发，没有语义能力
+)
+
+// ProviderConfig 单个协议的配置，未设置的 base_url / api_key 使用 openai 段的值
+type ProviderConfig struct {
+	BaseURL    string `mapstructure:"base_url"`
+	APIKey     string `mapstructure:"api_key"`
+	Dimensions int    `mapstructure:"dimensions"` // hash 的向量维度，0 使用 qdrant.vector_size
+	// 查询解析的结构化输出方式，按顺序尝试：tools / json_schema / functions，为空时使用协议的默认顺序
+	StructuredOutput []string `mapstructure:"structured_output"`
+}
+
+// Provider 返回协议的连接配置
+func (c *OpenAIConfig) Provider(name string) ProviderConfig {
+	provider := c.Providers[name]
+	if provider.BaseURL == "" {
+		provider.BaseURL = c.BaseURL
+	}
+	if provider.APIKey == "" {
+		provider.APIKey = c.APIKey
+	}
+	return provider
+}
+
+// EmbeddingConfigured 向量化服务是否已配置（设置了 API Key 或使用不需要 Key 的本地服务）
+func (c *OpenAIConfig) EmbeddingConfigured() bool {
+	switch c.EmbeddingProvider {
+	case ProviderTEI, ProviderHash:
+		return true
+	}
+	return c.Provider(c.EmbeddingProvider).APIKey != ""
+}
+
+// ValidateProviders 校验对话和向量化使用的协议
+func (c *OpenAIConfig) ValidateProviders() error {
+	if err := validateProvider(c.ChatProvider, false); err != nil {
+		return fmt.Errorf("chat_provider: %w", err)
+	}
+	if err := validateProvider(c.EmbeddingProvider, true); err != nil {
+		return fmt.Errorf("embedding_provider: %w", err)
+	}
+	return nil
+}
+
+// validateProvider 校验协议名称，embedding 为 true 时要求协议支持向量化
+func validateProvider(name string, embedding bool) error {
+	switch name {
+	case ProviderOpenAI, ProviderBedrock:
+	case ProviderAnthropic:
+		if embedding {
+			return fmt.Errorf("provider %q does not support embeddings", name)
+		}
+	case ProviderTEI, ProviderHash:
+		if !embedding {
+			return fmt.Errorf("provider %q only supports embeddings", name)
+		}
+	default:
+		return fmt.Errorf("unknown provider %q", name)
+	}
+	return nil
 }
 
 // SearchConfig 搜索配置
 type SearchConfig struct {
-	MaxResults          int     `mapstructure:"max_results"`
-	SimilarityThreshold float64 `mapstructure:"similarity_threshold"`
-	EnableCache         bool    `mapstructure:"enable_cache"`
-	CacheTTL            int     `mapstructure:"cache_ttl"`
+	MaxResults          int                `mapstructure:"max_results"`
+	SimilarityThreshold float64            `mapstructure:"similarity_threshold"`
+	EnableCache         bool               `mapstructure:"enable_cache"`
+	CacheTTL            int                `mapstructure:"cache_ttl"`
+	VariantsPerProduct  int                `mapstructure:"variants_per_product"` // 每个商品结果附带的命中变体数
+	MaxWindow           int                `mapstructure:"max_window"`           // offset + limit 的上限
+	NormalizeScores     bool               `mapstructure:"normalize_scores"`     // 将得分归一化到余弦相似度尺度
+	FacetLimit          int                `mapstructure:"facet_limit"`          // 每个分面字段默认返回的取值数量
+	FacetScanLimit      int                `mapstructure:"facet_scan_limit"`     // Facet API 不可用时最多扫描的商品数
+	Hybrid              HybridSearchConfig `mapstructure:"hybrid"`
+}
+
+// HybridSearchConfig 混合检索（稠密 + 关键词稀疏向量）配置
+type HybridSearchConfig struct {
+	Enabled      bool    `mapstructure:"enabled"`
+	RRFK         int     `mapstructure:"rrf_k"`         // RRF 常数 k
+	DenseWeight  float64 `mapstructure:"dense_weight"`  // 稠密检索默认权重
+	SparseWeight float64 `mapstructure:"sparse_weight"` // 关键词检索默认权重
 }
 
 // LoggingConfig 日志配置
@@ -70,6 +163,149 @@ type FeaturesConfig struct {
 	EnableSearchSuggestions bool `mapstructure:"enable_search_suggestions"`
 }
 
+// ImportConfig 批量导入任务配置
+type ImportConfig struct {
+	JobDir       string            `mapstructure:"job_dir"`       // 任务状态与数据文件目录
+	Workers      int               `mapstructure:"workers"`       // 单个任务的并发处理数
+	VariantCount int               `mapstructure:"variant_count"` // 每个商品生成的变体数量
+	CSVMapping   map[string]string `mapstructure:"csv_mapping"`   // CSV 表头到商品字段的映射
+}
+
+// ReindexConfig 重建索引（蓝绿切换）任务配置
+type ReindexConfig struct {
+	JobDir  string `mapstructure:"job_dir"` // 任务状态目录
+	Workers int    `mapstructure:"workers"` // 并发处理的商品数
+}
+
+// LLMConfig 大模型调用的重试与限流配置，对话和 embedding 请求共用
+type LLMConfig struct {
+	MaxRetries        *int `mapstructure:"max_retries"`         // 最大重试次数，不配置时使用默认值 3，0 表示不重试
+	InitialBackoffMs  int  `mapstructure:"initial_backoff_ms"`  // 首次重试等待时间（毫秒），之后指数增长
+	MaxBackoffMs      int  `mapstructure:"max_backoff_ms"`      // 单次重试等待时间上限（毫秒）
+	RequestsPerMinute int  `mapstructure:"requests_per_minute"` // 每分钟请求数上限，0 表示不限制
+	TokensPerMinute   int  `mapstructure:"tokens_per_minute"`   // 每分钟 token 数上限，0 表示不限制
+}
+
+// 模型任务
+const (
+	TaskParse       = "parse"       // 查询解析
+	TaskVariants    = "variants"    // 变体生成
+	TaskSuggestions = "suggestions" // 搜索建议
+	TaskRerank      = "rerank"      // 结果重排（预留）
+	TaskEmbedding   = "embedding"   // 向量化
+)
+
+// ModelsConfig 按任务配置模型，未配置的字段使用 openai 段的协议和模型
+type ModelsConfig struct {
+	Parse       ModelConfig `mapstructure:"parse"`
+	Variants    ModelConfig `mapstructure:"variants"`
+	Suggestions ModelConfig `mapstructure:"suggestions"`
+	Rerank      ModelConfig `mapstructure:"rerank"`
+	Embedding   ModelConfig `mapstructure:"embedding"` // 模型与集合绑定，备用项只能更换协议，不能更换模型
+}
+
+// ModelConfig 单个任务使用的模型
+type ModelConfig struct {
+	Provider    string        `mapstructure:"provider"`
+	Model       string        `mapstructure:"model"`
+	Temperature *float64      `mapstructure:"temperature"` // 为空时使用任务的默认温度
+	MaxTokens   int           `mapstructure:"max_tokens"`  // 0 使用任务的默认值
+	Timeout     int           `mapstructure:"timeout"`     // 秒，包含重试在内的总时长，0 表示只受单次请求超时限制
+	Fallbacks   []ModelConfig `mapstructure:"fallbacks"`   // 主模型失败后按顺序尝试，未设置的字段沿用主模型
+}
+
+// Task 返回任务的模型配置
+func (c *ModelsConfig) Task(task string) (ModelConfig, bool) {
+	switch task {
+	case TaskParse:
+		return c.Parse, true
+	case TaskVariants:
+		return c.Variants, true
+	case TaskSuggestions:
+		return c.Suggestions, true
+	case TaskRerank:
+		return c.Rerank, true
+	case TaskEmbedding:
+		return c.Embedding, true
+	}
+	return ModelConfig{}, false
+}
+
+// ModelRoute 返回任务的模型链（主模型在前，备用模型在后），未设置的字段已补全
+// 向量化任务的模型始终为 openai.embedding_model（重建索引切换模型时会更新它）
+func (c *Config) ModelRoute(task string) []ModelConfig {
+	primary, _ := c.Models.Task(task)
+	if task == TaskEmbedding {
+		primary.Provider = c.OpenAI.EmbeddingProvider
+		primary.Model = c.OpenAI.EmbeddingModel
+	} else {
+		if primary.Provider == "" {
+			primary.Provider = c.OpenAI.ChatProvider
+		}
+		if primary.Model == "" {
+			primary.Model = c.OpenAI.ChatModel
+		}
+	}
+
+	route := []ModelConfig{primary}
+	for _, fallback := range primary.Fallbacks {
+		if fallback.Provider == "" {
+			fallback.Provider = primary.Provider
+		}
+		if fallback.Model == "" || task == TaskEmbedding {
+			fallback.Model = primary.Model
+		}
+		if fallback.Temperature == nil {
+			fallback.Temperature = primary.Temperature
+		}
+		if fallback.MaxTokens == 0 {
+			fallback.MaxTokens = primary.MaxTokens
+		}
+		if fallback.Timeout == 0 {
+			fallback.Timeout = primary.Timeout
+		}
+		fallback.Fallbacks = nil
+		route = append(route, fallback)
+	}
+	route[0].Fallbacks = nil
+	return route
+}
+
+// validateModels 校验按任务配置的模型，并把向量化任务的协议和模型同步到 openai 段
+func (c *Config) validateModels() error {
+	embedding := c.Models.Embedding
+	if embedding.Provider != "" {
+		c.OpenAI.EmbeddingProvider = embedding.Provider
+	}
+	if embedding.Model != "" {
+		c.OpenAI.EmbeddingModel = embedding.Model
+	}
+	for i, fallback := range embedding.Fallbacks {
+		if fallback.Model != "" && fallback.Model != c.OpenAI.EmbeddingModel {
+			return fmt.Errorf("models.embedding.fallbacks[%d]: embedding fallbacks must use the primary model %s", i, c.OpenAI.EmbeddingModel)
+		}
+	}
+	// tei / hash 不按模型名称选择模型，作为备用项会把另一个向量空间的向量以同一模型名写入集合
+	for i, fallback := range c.ModelRoute(TaskEmbedding)[1:] {
+		switch fallback.Provider {
+		case ProviderTEI, ProviderHash:
+			return fmt.Errorf("models.embedding.fallbacks[%d]: provider %q cannot serve model %s and is not allowed as an embedding fallback", i, fallback.Provider, c.OpenAI.EmbeddingModel)
+		}
+	}
+
+	for _, task := range []string{TaskParse, TaskVariants, TaskSuggestions, TaskRerank, TaskEmbedding} {
+		for i, model := range c.ModelRoute(task) {
+			if err := validateProvider(model.Provider, task == TaskEmbedding); err != nil {
+				if i == 0 {
+					return fmt.Errorf("models.%s: %w", task, err)
+				}
+				return fmt.Errorf("models.%s.fallbacks[%d]: %w", task, i-1, err)
+			}
+		}
+	}
+	return nil
+}
+
 // FunctionCallingSchema Function Calling 配置结构
 type FunctionCallingSchema struct {
 	FunctionName string                 `json:"function_name"`
@@ -113,11 +349,32 @@ func Load() error {
 		AppConfig.OpenAI.APIKey = apiKey
 	}
 
+	if AppConfig.OpenAI.ChatProvider == "" {
+		AppConfig.OpenAI.ChatProvider = ProviderOpenAI
+	}
+	if AppConfig.OpenAI.EmbeddingProvider == "" {
+		AppConfig.OpenAI.EmbeddingProvider = ProviderOpenAI
+	}
+	if err := AppConfig.OpenAI.ValidateProviders(); err != nil {
+		return fmt.Errorf("invalid openai config: %w", err)
+	}
+	if err := AppConfig.validateModels(); err != nil {
+		return fmt.Errorf("invalid models config: %w", err)
+	}
+	if retries := AppConfig.LLM.MaxRetries; retries != nil && *retries < 0 {
+		return fmt.Errorf("invalid llm config: max_retries cannot be negative")
+	}
+
 	// 加载 Function Calling Schema
 	if err := loadFunctionCallingSchema(); err != nil {
 		return fmt.Errorf("failed to load function calling schema: %w", err)
 	}
 
+	// 加载属性注册表
+	if err := loadAttributeSchema(); err != nil {
+		return fmt.Errorf("failed to load attribute schema: %w", err)
+	}
+
 	// 加载变体生成提示词模板
 	if err := loadVariantPromptTemplate(); err != nil {
 		return fmt.Errorf("failed to load variant prompt template: %w", err)
@@ -142,6 +399,9 @@ func loadFunctionCallingSchema() error {
 	if err := json.Unmarshal(data, FunctionSchema); err != nil {
 		return fmt.Errorf("failed to parse function calling schema: %w", err)
 	}
+	if err := FunctionSchema.Validate(); err != nil {
+		return fmt.Errorf("invalid function calling schema: %w", err)
+	}
 
 	return nil
 }
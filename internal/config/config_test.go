@@ -0,0 +1,35 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateModelsEmbeddingFallbacks(t *testing.T) {
+	cases := []struct {
+		name      string
+		primary   string
+		fallbacks []ModelConfig
+		wantErr   string
+	}{
+		{"same provider", ProviderOpenAI, []ModelConfig{{}}, ""},
+		{"other hosted provider", ProviderOpenAI, []ModelConfig{{Provider: ProviderBedrock}}, ""},
+		{"hash fallback", ProviderOpenAI, []ModelConfig{{Provider: ProviderHash}}, `fallbacks[0]: provider "hash"`},
+		{"tei fallback", ProviderBedrock, []ModelConfig{{Provider: ProviderBedrock}, {Provider: ProviderTEI}}, `fallbacks[1]: provider "tei"`},
+		{"inherited hash", ProviderHash, []ModelConfig{{}}, `fallbacks[0]: provider "hash"`},
+		{"other model", ProviderOpenAI, []ModelConfig{{Model: "text-embedding-3-large"}}, "must use the primary model"},
+	}
+	for _, tc := range cases {
+		cfg := &Config{
+			OpenAI: OpenAIConfig{ChatProvider: ProviderOpenAI, EmbeddingProvider: tc.primary, EmbeddingModel: "text-embedding-3-small"},
+			Models: ModelsConfig{Embedding: ModelConfig{Fallbacks: tc.fallbacks}},
+		}
+		err := cfg.validateModels()
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%s: error = %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
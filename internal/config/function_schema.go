@@ -0,0 +1,234 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+)
+
+// functionNamePattern 函数名格式，tools 和 json_schema 两种方式都要求满足
+var functionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Validate 校验 Function Calling Schema 本身，只允许校验器支持的 JSON Schema 子集
+func (s *FunctionCallingSchema) Validate() error {
+	if !functionNamePattern.MatchString(s.FunctionName) {
+		return fmt.Errorf("function_name %q must match %s", s.FunctionName, functionNamePattern)
+	}
+	if s.Parameters == nil {
+		return fmt.Errorf("parameters are required")
+	}
+	if t, _ := s.Parameters["type"].(string); t != "object" {
+		return fmt.Errorf("parameters must be an object schema")
+	}
+	return checkSchema("parameters", s.Parameters)
+}
+
+// checkSchema 递归检查 schema 中的类型是否受支持
+func checkSchema(path string, schema map[string]interface{}) error {
+	for _, t := range schemaTypes(schema) {
+		switch t {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return fmt.Errorf("%s: unsupported type %q", path, t)
+		}
+	}
+
+	if properties, ok := schema["properties"]; ok {
+		props, ok := properties.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s.properties must be an object", path)
+		}
+		for name, prop := range props {
+			propSchema, ok := prop.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s.properties.%s must be an object", path, name)
+			}
+			if err := checkSchema(path+"."+name, propSchema); err != nil {
+				return err
+			}
+		}
+	}
+	if items, ok := schema["items"]; ok {
+		itemSchema, ok := items.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s.items must be an object", path)
+		}
+		if err := checkSchema(path+"[]", itemSchema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateArguments 严格按 parameters 校验模型返回的参数
+// 未在 properties 中声明的字段默认拒绝（additionalProperties 为 true 时允许），
+// 非必填字段的 null 视为未提供
+func (s *FunctionCallingSchema) ValidateArguments(arguments map[string]interface{}) error {
+	return validateValue("arguments", arguments, s.Parameters)
+}
+
+// validateValue 按 schema 校验单个值
+func validateValue(path string, value interface{}, schema map[string]interface{}) error {
+	if types := schemaTypes(schema); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if valueHasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected %v, got %s", path, types, describeValue(value))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if fmt.Sprint(candidate) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", path, value, enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return validateObject(path, v, schema)
+	case []interface{}:
+		if itemSchema, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateValue(fmt.Sprintf("%s[%d]", path, i), item, itemSchema); err != nil {
+					return err
+				}
+			}
+		}
+	case float64:
+		if minimum, ok := schema["minimum"].(float64); ok && v < minimum {
+			return fmt.Errorf("%s: %v is less than minimum %v", path, v, minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && v > maximum {
+			return fmt.Errorf("%s: %v is greater than maximum %v", path, v, maximum)
+		}
+	}
+	return nil
+}
+
+// validateObject 校验对象的必填字段、已声明字段和额外字段
+func validateObject(path string, object map[string]interface{}, schema map[string]interface{}) error {
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	required := make(map[string]bool)
+	if list, ok := schema["required"].([]interface{}); ok {
+		for _, name := range list {
+			if s, ok := name.(string); ok {
+				required[s] = true
+			}
+		}
+	}
+	for name := range required {
+		if value, ok := object[name]; !ok || value == nil {
+			return fmt.Errorf("%s.%s is required", path, name)
+		}
+	}
+
+	// 按名称排序，保证错误信息稳定
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := object[name]
+		prop, declared := properties[name].(map[string]interface{})
+		if !declared {
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if extra {
+					continue
+				}
+			case map[string]interface{}:
+				if err := validateValue(path+"."+name, value, extra); err != nil {
+					return err
+				}
+				continue
+			}
+			return fmt.Errorf("%s.%s is not allowed", path, name)
+		}
+		if value == nil && !required[name] {
+			continue
+		}
+		if err := validateValue(path+"."+name, value, prop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaTypes schema 的 type 字段，支持字符串和字符串数组两种写法
+func schemaTypes(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// valueHasType 判断 JSON 解码后的值是否属于指定类型
+func valueHasType(value interface{}, t string) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		v, ok := value.(float64)
+		return ok && v == math.Trunc(v)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+// describeValue 错误信息中的值类型描述
+func describeValue(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// testSchema 从 JSON 构造 Function Calling Schema，保证数值类型与模型返回一致（float64）
+func testSchema(t *testing.T, parameters string) *FunctionCallingSchema {
+	t.Helper()
+	schema := &FunctionCallingSchema{FunctionName: "parse_product_query"}
+	if err := json.Unmarshal([]byte(parameters), &schema.Parameters); err != nil {
+		t.Fatalf("parse parameters: %v", err)
+	}
+	return schema
+}
+
+func TestFunctionCallingSchemaValidate(t *testing.T) {
+	cases := []struct {
+		name       string
+		function   string
+		parameters string
+		wantErr    string
+	}{
+		{"valid", "parse_product_query", `{"type":"object","properties":{"tags":{"type":["array","null"],"items":{"type":"string"}}}}`, ""},
+		{"bad name", "parse product query", `{"type":"object"}`, "function_name"},
+		{"not object", "parse", `{"type":"array"}`, "must be an object schema"},
+		{"unsupported type", "parse", `{"type":"object","properties":{"when":{"type":"date"}}}`, `parameters.when: unsupported type "date"`},
+		{"bad items", "parse", `{"type":"object","properties":{"tags":{"type":"array","items":["string"]}}}`, "parameters.tags.items must be an object"},
+	}
+	for _, tc := range cases {
+		schema := testSchema(t, tc.parameters)
+		schema.FunctionName = tc.function
+		err := schema.Validate()
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%s: error = %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+
+	if err := (&FunctionCallingSchema{FunctionName: "parse"}).Validate(); err == nil {
+		t.Errorf("missing parameters should be rejected")
+	}
+}
+
+func TestValidateArguments(t *testing.T) {
+	schema := testSchema(t, `{
+		"type": "object",
+		"properties": {
+			"product_type": {"type": "string"},
+			"gender": {"type": ["string", "null"], "enum": ["男", "女", "通用"]},
+			"price_max": {"type": "number", "minimum": 0, "maximum": 100000},
+			"count": {"type": "integer"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"filters": {
+				"type": "object",
+				"additionalProperties": {"type": ["string", "number", "boolean"]}
+			},
+			"extra": {"type": "object", "additionalProperties": true}
+		},
+		"required": ["product_type"]
+	}`)
+
+	cases := []struct {
+		name      string
+		arguments string
+		wantErr   string
+	}{
+		{"minimal", `{"product_type":"手机"}`, ""},
+		{"full", `{"product_type":"手机","gender":"男","price_max":3000,"count":2,"tags":["5G"],"filters":{"storage_gb":256,"nfc":true},"extra":{"anything":[1,2]}}`, ""},
+		{"optional null", `{"product_type":"手机","price_max":null,"tags":null}`, ""},
+		{"nullable type", `{"product_type":"手机","gender":null}`, ""},
+		{"missing required", `{"brand":"Apple"}`, "arguments.product_type is required"},
+		{"null required", `{"product_type":null}`, "arguments.product_type is required"},
+		{"undeclared", `{"product_type":"手机","brand":"Apple"}`, "arguments.brand is not allowed"},
+		{"wrong type", `{"product_type":"手机","price_max":"3000"}`, "arguments.price_max: expected [number], got string"},
+		{"fractional integer", `{"product_type":"手机","count":1.5}`, "arguments.count: expected [integer]"},
+		{"enum", `{"product_type":"手机","gender":"儿童"}`, "is not one of"},
+		{"minimum", `{"product_type":"手机","price_max":-1}`, "less than minimum"},
+		{"maximum", `{"product_type":"手机","price_max":200000}`, "greater than maximum"},
+		{"item type", `{"product_type":"手机","tags":["5G",5]}`, "arguments.tags[1]: expected [string], got number"},
+		{"additional schema", `{"product_type":"手机","filters":{"colors":["红"]}}`, "arguments.filters.colors: expected [string number boolean], got array"},
+	}
+	for _, tc := range cases {
+		var arguments map[string]interface{}
+		if err := json.Unmarshal([]byte(tc.arguments), &arguments); err != nil {
+			t.Fatalf("%s: parse arguments: %v", tc.name, err)
+		}
+		err := schema.ValidateArguments(arguments)
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%s: error = %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
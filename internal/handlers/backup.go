@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"search-ec2/internal/models"
+	"search-ec2/internal/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// BackupHandler 商品目录导出恢复与快照处理器
+type BackupHandler struct {
+	serviceManager *services.ServiceManager
+}
+
+// NewBackupHandler 创建备份处理器
+func NewBackupHandler(serviceManager *services.ServiceManager) *BackupHandler {
+	return &BackupHandler{
+		serviceManager: serviceManager,
+	}
+}
+
+// Export 以 JSONL 流式导出商品目录
+// 默认包含变体向量（可用于恢复，与 catalogctl export 一致），vectors=false 时不包含；category、status 可选，用于只导出部分商品
+func (h *BackupHandler) Export(c *gin.Context) {
+	opts := services.ExportOptions{WithVectors: true}
+	if raw := c.Query("vectors"); raw != "" {
+		withVectors, err := strconv.ParseBool(raw)
+		if err != nil {
+			BadRequestResponse(c, "Invalid vectors parameter")
+			return
+		}
+		opts.WithVectors = withVectors
+	}
+
+	filter := &models.Filter{}
+	if category := c.Query("category"); category != "" {
+		filter.Must = append(filter.Must, models.NewMatchCondition("category", category))
+	}
+	if status := c.Query("status"); status != "" {
+		if !models.IsValidProductStatus(status) {
+			BadRequestResponse(c, "Invalid status")
+			return
+		}
+		filter.Must = append(filter.Must, models.NewMatchCondition("status", status))
+	}
+	if len(filter.Must) > 0 {
+		opts.Filter = filter
+	}
+
+	filename := fmt.Sprintf("catalog-%s.jsonl", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	// 响应头已发送，导出中途失败只能中断输出
+	count, err := h.serviceManager.Qdrant.ExportProducts(c.Writer, opts)
+	if err != nil {
+		logrus.Errorf("Catalog export failed after %d products: %v", count, err)
+		c.Abort()
+		return
+	}
+	logrus.Infof("Catalog exported: %d products", count)
+}
+
+// Restore 从导出文件恢复商品（请求体为 JSONL），不调用 LLM 和 embedding
+func (h *BackupHandler) Restore(c *gin.Context) {
+	result, err := h.serviceManager.Qdrant.RestoreProducts(c.Request.Body)
+	if err != nil {
+		logrus.Errorf("Catalog restore failed: %v", err)
+		InternalErrorResponse(c, "Failed to restore catalog")
+		return
+	}
+
+	SuccessResponse(c, result)
+}
+
+// ListSnapshots 列出集合快照
+func (h *BackupHandler) ListSnapshots(c *gin.Context) {
+	snapshots, err := h.serviceManager.Qdrant.ListSnapshots()
+	if err != nil {
+		logrus.Errorf("Failed to list snapshots: %v", err)
+		InternalErrorResponse(c, "Failed to list snapshots")
+		return
+	}
+
+	SuccessResponse(c, snapshots)
+}
+
+// CreateSnapshot 创建集合快照
+func (h *BackupHandler) CreateSnapshot(c *gin.Context) {
+	snapshot, err := h.serviceManager.Qdrant.CreateSnapshot()
+	if err != nil {
+		logrus.Errorf("Failed to create snapshot: %v", err)
+		InternalErrorResponse(c, "Failed to create snapshot")
+		return
+	}
+
+	SuccessResponse(c, snapshot)
+}
+
+// DownloadSnapshot 下载快照文件
+func (h *BackupHandler) DownloadSnapshot(c *gin.Context) {
+	name := c.Param("name")
+
+	// 先确认快照存在，避免发送响应头后才发现错误
+	snapshots, err := h.serviceManager.Qdrant.ListSnapshots()
+	if err != nil {
+		logrus.Errorf("Failed to list snapshots: %v", err)
+		InternalErrorResponse(c, "Failed to download snapshot")
+		return
+	}
+	found := false
+	for _, snapshot := range snapshots {
+		if snapshot.Name == name {
+			found = true
+			c.Header("Content-Length", strconv.FormatInt(snapshot.Size, 10))
+			break
+		}
+	}
+	if !found {
+		NotFoundResponse(c, "Snapshot not found")
+		return
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	c.Status(http.StatusOK)
+
+	if _, err := h.serviceManager.Qdrant.DownloadSnapshot(name, c.Writer); err != nil {
+		logrus.Errorf("Failed to download snapshot %s: %v", name, err)
+		c.Abort()
+	}
+}
+
+// DeleteSnapshot 删除集合快照
+func (h *BackupHandler) DeleteSnapshot(c *gin.Context) {
+	name := c.Param("name")
+	if err := h.serviceManager.Qdrant.DeleteSnapshot(name); err != nil {
+		logrus.Errorf("Failed to delete snapshot %s: %v", name, err)
+		InternalErrorResponse(c, "Failed to delete snapshot")
+		return
+	}
+
+	SuccessResponse(c, gin.H{"name": name, "deleted": true})
+}
+
+// RestoreSnapshot 上传快照文件并替换当前集合（请求体为快照文件）
+func (h *BackupHandler) RestoreSnapshot(c *gin.Context) {
+	if err := h.serviceManager.Qdrant.RestoreSnapshot(c.Request.Body, c.Query("filename")); err != nil {
+		logrus.Errorf("Failed to restore snapshot: %v", err)
+		InternalErrorResponse(c, "Failed to restore snapshot")
+		return
+	}
+
+	SuccessResponse(c, gin.H{"restored": true})
+}
@@ -52,6 +52,11 @@ func (h *ConfigHandler) UpdateFunctionSchema(c *gin.Context) {
 		return
 	}
 
+	if err := newSchema.Validate(); err != nil {
+		BadRequestResponse(c, fmt.Sprintf("Invalid schema: %v", err))
+		return
+	}
+
 	// 保存到文件
 	schemaPath := "config/function_calling_schema.json"
 	data, err := json.MarshalIndent(newSchema, "", "  ")
@@ -132,3 +137,46 @@ func (h *ConfigHandler) UpdateVariantPrompt(c *gin.Context) {
 
 	SuccessResponse(c, response)
 }
+
+// GetAttributeSchema 获取属性注册表
+func (h *ConfigHandler) GetAttributeSchema(c *gin.Context) {
+	SuccessResponse(c, config.AttributeRegistry())
+}
+
+// UpdateAttributeSchema 更新属性注册表，并为新增的可过滤属性创建 payload 索引
+// 已创建的索引不会被删除；修改属性类型需要重建集合后才能生效
+func (h *ConfigHandler) UpdateAttributeSchema(c *gin.Context) {
+	var newSchema config.AttributeSchema
+	if err := c.ShouldBindJSON(&newSchema); err != nil {
+		BadRequestResponse(c, fmt.Sprintf("Invalid schema: %v", err))
+		return
+	}
+
+	if err := newSchema.Validate(); err != nil {
+		BadRequestResponse(c, fmt.Sprintf("Invalid schema: %v", err))
+		return
+	}
+
+	if err := config.SaveAttributeSchema(&newSchema); err != nil {
+		logrus.Errorf("Failed to save attribute schema: %v", err)
+		InternalErrorResponse(c, "Failed to save attribute schema")
+		return
+	}
+
+	indexed, err := h.serviceManager.Qdrant.EnsureAttributeIndexes()
+	if err != nil {
+		logrus.Errorf("Failed to create attribute indexes: %v", err)
+		InternalErrorResponse(c, "Attribute schema saved but indexes could not be created")
+		return
+	}
+
+	logrus.Infof("Attribute schema updated successfully: %d attributes", len(newSchema.Attributes))
+
+	response := map[string]interface{}{
+		"message":    "Attribute schema updated successfully",
+		"attributes": len(newSchema.Attributes),
+		"indexed":    indexed,
+	}
+
+	SuccessResponse(c, response)
+}
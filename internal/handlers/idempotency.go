@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyHeader 幂等键请求头
+const IdempotencyHeader = "Idempotency-Key"
+
+const (
+	defaultIdempotencyTTL = 24 * time.Hour
+	maxIdempotencyKeyLen  = 255
+)
+
+// idempotencyEntry 幂等键对应的请求记录
+type idempotencyEntry struct {
+	fingerprint string // 请求体摘要
+	done        bool   // 请求已完成，可以重放响应
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// IdempotencyStore 内存幂等键存储
+// 同一个键在有效期内重复提交相同的请求时直接返回首次的响应；请求体不同时拒绝。
+// 5xx 响应不会被记录，客户端可以用同一个键重试。服务重启后记录丢失
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*idempotencyEntry
+}
+
+// NewIdempotencyStore 创建幂等键存储，ttl <= 0 时使用默认有效期（24 小时）
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return &IdempotencyStore{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// idempotencyRecorder 记录响应内容的 ResponseWriter
+type idempotencyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write 写入响应并保留副本
+func (w *idempotencyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString 写入响应并保留副本
+func (w *idempotencyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Middleware 幂等中间件，未携带 Idempotency-Key 的请求不受影响
+func (s *IdempotencyStore) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			BadRequestResponse(c, fmt.Sprintf("%s is too long", IdempotencyHeader))
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			BadRequestResponse(c, fmt.Sprintf("Failed to read request body: %v", err))
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+		// 键按接口区分，不同接口可以使用相同的键
+		storeKey := c.Request.Method + " " + c.FullPath() + " " + key
+
+		s.mu.Lock()
+		s.purgeExpiredLocked()
+		if entry, ok := s.entries[storeKey]; ok {
+			s.mu.Unlock()
+			switch {
+			case entry.fingerprint != fingerprint:
+				ErrorResponse(c, http.StatusUnprocessableEntity,
+					fmt.Sprintf("%s was already used with a different request", IdempotencyHeader))
+			case !entry.done:
+				ErrorResponse(c, http.StatusConflict,
+					fmt.Sprintf("A request with the same %s is still in progress", IdempotencyHeader))
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(entry.status, entry.contentType, entry.body)
+			}
+			c.Abort()
+			return
+		}
+		entry := &idempotencyEntry{fingerprint: fingerprint, expiresAt: time.Now().Add(s.ttl)}
+		s.entries[storeKey] = entry
+		s.mu.Unlock()
+
+		recorder := &idempotencyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		// 使用 defer 保证处理器 panic 时也会释放幂等键
+		defer func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if !recorder.Written() || recorder.Status() >= http.StatusInternalServerError {
+				delete(s.entries, storeKey)
+				return
+			}
+			entry.done = true
+			entry.status = recorder.Status()
+			entry.contentType = recorder.Header().Get("Content-Type")
+			entry.body = recorder.body.Bytes()
+			entry.expiresAt = time.Now().Add(s.ttl)
+		}()
+
+		c.Next()
+	}
+}
+
+// purgeExpiredLocked 清理过期记录，调用方需持有锁
+func (s *IdempotencyStore) purgeExpiredLocked() {
+	now := time.Now()
+	for key, entry := range s.entries {
+		if entry.done && now.After(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
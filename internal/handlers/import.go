@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"search-ec2/internal/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ImportHandler 导入任务处理器
+type ImportHandler struct {
+	serviceManager *services.ServiceManager
+}
+
+// NewImportHandler 创建导入任务处理器
+func NewImportHandler(serviceManager *services.ServiceManager) *ImportHandler {
+	return &ImportHandler{
+		serviceManager: serviceManager,
+	}
+}
+
+// 上传文件格式
+const (
+	importFormatCSV   = "csv"
+	importFormatJSONL = "jsonl"
+)
+
+// UploadImport 上传 CSV 或 JSONL 文件创建导入任务
+// 文件可以作为请求体直接上传，也可以通过 multipart 表单的 file 字段上传；数据边读边写入任务文件，不会整体加载到内存。
+// 格式依次由 format 参数、文件扩展名、Content-Type 确定；CSV 表头映射可通过 mapping 参数（JSON 对象）覆盖配置
+func (h *ImportHandler) UploadImport(c *gin.Context) {
+	var mapping map[string]string
+	if raw := c.Query("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			BadRequestResponse(c, fmt.Sprintf("Invalid mapping: %v", err))
+			return
+		}
+	}
+
+	body, filename, contentType, err := h.uploadBody(c)
+	if err != nil {
+		BadRequestResponse(c, err.Error())
+		return
+	}
+	defer body.Close()
+
+	format := detectImportFormat(c.Query("format"), filename, contentType)
+	var source services.ProductSource
+	switch format {
+	case importFormatCSV:
+		source, err = services.NewCSVProductSource(body, mapping)
+		if err != nil {
+			BadRequestResponse(c, err.Error())
+			return
+		}
+	case importFormatJSONL:
+		source = services.NewJSONLProductSource(body)
+	default:
+		BadRequestResponse(c, "Unable to detect file format, use format=csv or format=jsonl")
+		return
+	}
+
+	job, err := h.serviceManager.Imports.SubmitSource(source)
+	if err != nil {
+		if errors.Is(err, services.ErrEmptyImport) || errors.Is(err, services.ErrInvalidImportSource) {
+			BadRequestResponse(c, err.Error())
+			return
+		}
+		logrus.Errorf("Failed to submit import upload: %v", err)
+		InternalErrorResponse(c, "Failed to create import job")
+		return
+	}
+
+	logrus.Infof("Import job %s created from %s upload with %d items", job.ID, format, job.Total)
+	SuccessResponse(c, job)
+}
+
+// uploadBody 返回上传文件的数据流、文件名和 Content-Type
+func (h *ImportHandler) uploadBody(c *gin.Context) (io.ReadCloser, string, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return c.Request.Body, "", mediaType, nil
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, "", "", fmt.Errorf("invalid multipart request: %w", err)
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, "", "", errors.New("multipart request has no file field")
+		}
+		if err != nil {
+			return nil, "", "", fmt.Errorf("invalid multipart request: %w", err)
+		}
+		if part.FormName() == "file" {
+			partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			return part, part.FileName(), partType, nil
+		}
+		part.Close()
+	}
+}
+
+// detectImportFormat 确定上传文件格式
+func detectImportFormat(format, filename, contentType string) string {
+	switch strings.ToLower(format) {
+	case importFormatCSV:
+		return importFormatCSV
+	case importFormatJSONL, "ndjson":
+		return importFormatJSONL
+	case "":
+	default:
+		return ""
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return importFormatCSV
+	case ".jsonl", ".ndjson":
+		return importFormatJSONL
+	}
+
+	switch contentType {
+	case "text/csv":
+		return importFormatCSV
+	case "application/jsonl", "application/x-ndjson", "application/x-jsonlines":
+		return importFormatJSONL
+	}
+	return ""
+}
+
+// ListJobs 列出导入任务
+func (h *ImportHandler) ListJobs(c *gin.Context) {
+	SuccessResponse(c, h.serviceManager.Imports.List())
+}
+
+// GetJob 查询导入任务进度
+func (h *ImportHandler) GetJob(c *gin.Context) {
+	job, err := h.serviceManager.Imports.Get(c.Param("id"))
+	if err != nil {
+		h.jobErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponse(c, job)
+}
+
+// CancelJob 取消导入任务
+func (h *ImportHandler) CancelJob(c *gin.Context) {
+	job, err := h.serviceManager.Imports.Cancel(c.Param("id"))
+	if err != nil {
+		h.jobErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponse(c, job)
+}
+
+// ResumeJob 继续已取消或失败的导入任务
+func (h *ImportHandler) ResumeJob(c *gin.Context) {
+	job, err := h.serviceManager.Imports.Resume(c.Param("id"))
+	if err != nil {
+		h.jobErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponse(c, job)
+}
+
+// jobErrorResponse 将任务错误映射为 HTTP 响应
+func (h *ImportHandler) jobErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrImportJobNotFound):
+		NotFoundResponse(c, "Import job not found")
+	case errors.Is(err, services.ErrImportJobState):
+		BadRequestResponse(c, err.Error())
+	default:
+		logrus.Errorf("Import job operation failed: %v", err)
+		InternalErrorResponse(c, "Import job operation failed")
+	}
+}
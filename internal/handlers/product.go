@@ -1,16 +1,23 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"search-ec2/internal/config"
 	"search-ec2/internal/models"
 	"search-ec2/internal/services"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	defaultListLimit = 20  // 商品列表默认每页数量
+	maxListLimit     = 500 // 商品列表每页数量上限
+)
+
 // ProductHandler 商品处理器
 type ProductHandler struct {
 	serviceManager *services.ServiceManager
@@ -31,39 +38,35 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
-	// 转换为商品对象
+	if err := req.Validate(); err != nil {
+		BadRequestResponse(c, fmt.Sprintf("Invalid request: %v", err))
+		return
+	}
+
+	if err := config.AttributeRegistry().ValidateValues(req.Attributes); err != nil {
+		BadRequestResponse(c, fmt.Sprintf("Invalid attributes: %v", err))
+		return
+	}
+
+	// 转换为商品对象，带外部 ID 且已存在时按 upsert 处理
 	product := req.ToProduct()
-	product.ID = uuid.New().String()
 
 	logrus.Infof("Creating product: %s", product.Name)
 
-	// 生成商品变体
-	variants, err := h.serviceManager.VariantGeneration.GenerateVariantsWithEmbeddings(
-		product, 5, h.serviceManager.Embedding,
-	)
+	result, err := h.serviceManager.UpsertProduct(c.Request.Context(), product, 5)
 	if err != nil {
-		logrus.Errorf("Failed to generate variants: %v", err)
-		InternalErrorResponse(c, "Failed to generate product variants")
-		return
-	}
-
-	// 插入到 Qdrant
-	if err := h.serviceManager.Qdrant.InsertProduct(product, variants); err != nil {
-		logrus.Errorf("Failed to insert product: %v", err)
+		logrus.Errorf("Failed to save product: %v", err)
 		InternalErrorResponse(c, "Failed to save product")
 		return
 	}
 
-	logrus.Infof("Product created successfully: %s with %d variants", product.ID, len(variants))
-
-	response := map[string]interface{}{
-		"product_id":     product.ID,
-		"name":          product.Name,
-		"variants_count": len(variants),
-		"created_at":    product.CreatedAt,
+	if result.Unchanged {
+		logrus.Infof("Product %s unchanged, variants kept", result.ProductID)
+	} else {
+		logrus.Infof("Product saved successfully: %s with %d variants", result.ProductID, result.VariantsCount)
 	}
 
-	SuccessResponse(c, response)
+	SuccessResponse(c, result)
 }
 
 // GetProduct 获取商品详情
@@ -76,7 +79,17 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 
 	product, err := h.serviceManager.Qdrant.GetProduct(productID)
 	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			NotFoundResponse(c, "Product not found")
+			return
+		}
 		logrus.Errorf("Failed to get product %s: %v", productID, err)
+		InternalErrorResponse(c, "Failed to get product")
+		return
+	}
+
+	// 已删除的商品只能通过管理接口查看和恢复
+	if product.Status == models.ProductStatusDeleted {
 		NotFoundResponse(c, "Product not found")
 		return
 	}
@@ -84,6 +97,203 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 	SuccessResponse(c, product)
 }
 
+// BatchGetProducts 批量获取商品详情
+func (h *ProductHandler) BatchGetProducts(c *gin.Context) {
+	var req models.ProductBatchGetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequestResponse(c, fmt.Sprintf("Invalid request: %v", err))
+		return
+	}
+
+	products, err := h.serviceManager.Qdrant.GetProducts(req.IDs)
+	if err != nil {
+		logrus.Errorf("Failed to get products: %v", err)
+		InternalErrorResponse(c, "Failed to get products")
+		return
+	}
+
+	// 已删除的商品视为不存在
+	response := models.ProductBatchGetResponse{Products: make([]*models.Product, 0, len(products))}
+	found := make(map[string]bool, len(products))
+	for _, product := range products {
+		if product.Status == models.ProductStatusDeleted {
+			continue
+		}
+		found[product.ID] = true
+		response.Products = append(response.Products, product)
+	}
+
+	for _, id := range req.IDs {
+		if !found[id] {
+			response.Missing = append(response.Missing, id)
+			found[id] = true
+		}
+	}
+
+	SuccessResponse(c, response)
+}
+
+// ListProducts 分页浏览商品目录
+// 支持 category、brand、status、price_min、price_max、updated_since 过滤，
+// sort=updated_at|price、order=asc|desc 排序，通过 cursor 翻页
+// status 默认为 active（包含没有写入状态的旧数据），可以指定 inactive；已删除的商品只能通过管理端查看
+func (h *ProductHandler) ListProducts(c *gin.Context) {
+	params, ok := listParamsFromQuery(c)
+	if !ok {
+		return
+	}
+
+	switch status := c.Query("status"); status {
+	case "", models.ProductStatusActive:
+		params.Filter = params.Filter.And(models.VisibleStatusFilter())
+	case models.ProductStatusInactive:
+		params.Filter = params.Filter.And(&models.Filter{
+			Must: []models.Condition{models.NewMatchCondition("status", status)},
+		})
+	case models.ProductStatusDeleted:
+		BadRequestResponse(c, "Deleted products are only listed by /api/admin/products")
+		return
+	default:
+		BadRequestResponse(c, "Invalid status")
+		return
+	}
+
+	h.listProducts(c, params)
+}
+
+// AdminListProducts 管理端浏览商品目录
+// 默认列出下架和已删除的商品，status=active|inactive|deleted 指定状态，status=all 列出全部
+func (h *ProductHandler) AdminListProducts(c *gin.Context) {
+	params, ok := listParamsFromQuery(c)
+	if !ok {
+		return
+	}
+
+	switch status := c.Query("status"); {
+	case status == "":
+		params.Filter = params.Filter.And(&models.Filter{
+			Must: []models.Condition{
+				models.NewMatchAnyCondition("status", models.ProductStatusInactive, models.ProductStatusDeleted),
+			},
+		})
+	case status == "all":
+	case models.IsValidProductStatus(status):
+		params.Filter = params.Filter.And(&models.Filter{
+			Must: []models.Condition{models.NewMatchCondition("status", status)},
+		})
+	default:
+		BadRequestResponse(c, "Invalid status")
+		return
+	}
+
+	h.listProducts(c, params)
+}
+
+// listProducts 执行列表查询并返回响应
+func (h *ProductHandler) listProducts(c *gin.Context, params services.ProductListParams) {
+	products, nextCursor, err := h.serviceManager.Qdrant.ScrollProducts(params)
+	if errors.Is(err, services.ErrInvalidListRequest) {
+		BadRequestResponse(c, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.Errorf("Failed to list products: %v", err)
+		InternalErrorResponse(c, "Failed to list products")
+		return
+	}
+
+	SuccessResponse(c, models.ProductListResponse{
+		Products:   products,
+		Count:      len(products),
+		NextCursor: nextCursor,
+	})
+}
+
+// listParamsFromQuery 解析列表查询参数，参数不合法时写入 400 响应并返回 false
+func listParamsFromQuery(c *gin.Context) (services.ProductListParams, bool) {
+	limit := defaultListLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 {
+			BadRequestResponse(c, "Invalid limit")
+			return services.ProductListParams{}, false
+		}
+		limit = l
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	filter := &models.Filter{}
+	for _, key := range []string{"category", "brand"} {
+		if value := c.Query(key); value != "" {
+			filter.Must = append(filter.Must, models.NewMatchCondition(key, value))
+		}
+	}
+
+	priceMin, err := parseOptionalFloat(c.Query("price_min"))
+	if err != nil {
+		BadRequestResponse(c, "Invalid price_min")
+		return services.ProductListParams{}, false
+	}
+	priceMax, err := parseOptionalFloat(c.Query("price_max"))
+	if err != nil {
+		BadRequestResponse(c, "Invalid price_max")
+		return services.ProductListParams{}, false
+	}
+	if priceMin != nil || priceMax != nil {
+		filter.Must = append(filter.Must, models.NewRangeCondition("price", priceMin, priceMax))
+	}
+
+	if since := c.Query("updated_since"); since != "" {
+		sinceUnix, err := parseTimestamp(since)
+		if err != nil {
+			BadRequestResponse(c, "Invalid updated_since, expected unix seconds or RFC3339")
+			return services.ProductListParams{}, false
+		}
+		filter.Must = append(filter.Must, models.NewRangeCondition("updated_at", &sinceUnix, nil))
+	}
+
+	order := c.DefaultQuery("order", "asc")
+	if order != "asc" && order != "desc" {
+		BadRequestResponse(c, "Invalid order, expected asc or desc")
+		return services.ProductListParams{}, false
+	}
+
+	return services.ProductListParams{
+		Filter: filter,
+		SortBy: c.Query("sort"),
+		Desc:   order == "desc",
+		Limit:  uint32(limit),
+		Cursor: c.Query("cursor"),
+	}, true
+}
+
+// RestoreProduct 恢复下架或已删除的商品
+func (h *ProductHandler) RestoreProduct(c *gin.Context) {
+	productID := c.Param("id")
+	if productID == "" {
+		BadRequestResponse(c, "Product ID is required")
+		return
+	}
+
+	if err := h.serviceManager.Qdrant.SetProductStatus(productID, models.ProductStatusActive); err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			NotFoundResponse(c, "Product not found")
+			return
+		}
+		logrus.Errorf("Failed to restore product %s: %v", productID, err)
+		InternalErrorResponse(c, "Failed to restore product")
+		return
+	}
+
+	logrus.Infof("Product restored successfully: %s", productID)
+	SuccessResponse(c, map[string]interface{}{
+		"product_id": productID,
+		"status":     models.ProductStatusActive,
+	})
+}
+
 // UpdateProduct 更新商品
 func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	productID := c.Param("id")
@@ -98,45 +308,53 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		return
 	}
 
+	if req.Status != nil && !models.IsValidProductStatus(*req.Status) {
+		BadRequestResponse(c, "Invalid status, expected active, inactive or deleted")
+		return
+	}
+
+	if err := config.AttributeRegistry().ValidateValues(req.Attributes); err != nil {
+		BadRequestResponse(c, fmt.Sprintf("Invalid attributes: %v", err))
+		return
+	}
+
+	// 读取和写入期间持有商品锁，避免与导入等并发写入基于同一代变体
+	unlock := h.serviceManager.LockProduct(productID)
+	defer unlock()
+
 	// 获取现有商品
 	product, err := h.serviceManager.Qdrant.GetProduct(productID)
 	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			NotFoundResponse(c, "Product not found")
+			return
+		}
 		logrus.Errorf("Failed to get product %s: %v", productID, err)
-		NotFoundResponse(c, "Product not found")
+		InternalErrorResponse(c, "Failed to get product")
 		return
 	}
+	existing := *product
 
 	// 应用更新
 	product.ApplyUpdate(&req)
+	product.Variants = nil
 
-	// 重新生成变体
-	variants, err := h.serviceManager.VariantGeneration.GenerateVariantsWithEmbeddings(
-		product, 5, h.serviceManager.Embedding,
-	)
+	// 生成变体的字段没有变化时只更新 payload，否则重新生成变体
+	variantsCount, regenerated, err := h.serviceManager.SaveProduct(c.Request.Context(), product, &existing, 5)
 	if err != nil {
-		logrus.Errorf("Failed to regenerate variants: %v", err)
-		InternalErrorResponse(c, "Failed to update product variants")
-		return
-	}
-
-	// 删除旧数据并插入新数据
-	if err := h.serviceManager.Qdrant.DeleteProduct(productID); err != nil {
-		logrus.Errorf("Failed to delete old product data: %v", err)
-	}
-
-	if err := h.serviceManager.Qdrant.InsertProduct(product, variants); err != nil {
-		logrus.Errorf("Failed to insert updated product: %v", err)
+		logrus.Errorf("Failed to save updated product %s: %v", productID, err)
 		InternalErrorResponse(c, "Failed to save updated product")
 		return
 	}
 
-	logrus.Infof("Product updated successfully: %s", productID)
+	logrus.Infof("Product updated successfully: %s (variants regenerated: %v)", productID, regenerated)
 
 	response := map[string]interface{}{
-		"product_id":     product.ID,
-		"name":          product.Name,
-		"variants_count": len(variants),
-		"updated_at":    product.UpdatedAt,
+		"product_id":           product.ID,
+		"name":                 product.Name,
+		"variants_count":       variantsCount,
+		"variants_regenerated": regenerated,
+		"updated_at":           product.UpdatedAt,
 	}
 
 	SuccessResponse(c, response)
@@ -150,16 +368,30 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	if err := h.serviceManager.Qdrant.DeleteProduct(productID); err != nil {
+	// soft=true 时只标记为已删除，可以通过管理接口恢复
+	soft := c.Query("soft") == "true"
+	if soft {
+		err := h.serviceManager.Qdrant.SetProductStatus(productID, models.ProductStatusDeleted)
+		if errors.Is(err, services.ErrProductNotFound) {
+			NotFoundResponse(c, "Product not found")
+			return
+		}
+		if err != nil {
+			logrus.Errorf("Failed to soft delete product %s: %v", productID, err)
+			InternalErrorResponse(c, "Failed to delete product")
+			return
+		}
+	} else if err := h.serviceManager.Qdrant.DeleteProduct(productID); err != nil {
 		logrus.Errorf("Failed to delete product %s: %v", productID, err)
 		InternalErrorResponse(c, "Failed to delete product")
 		return
 	}
 
-	logrus.Infof("Product deleted successfully: %s", productID)
+	logrus.Infof("Product deleted successfully: %s (soft=%v)", productID, soft)
 
 	response := map[string]interface{}{
 		"product_id": productID,
+		"soft":       soft,
 		"deleted_at": time.Now(),
 	}
 
@@ -167,6 +399,7 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 }
 
 // BatchImport 批量导入商品
+// 创建异步导入任务后立即返回，通过 GET /api/import/jobs/:id 查询进度
 func (h *ProductHandler) BatchImport(c *gin.Context) {
 	var req models.BatchImportRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -174,55 +407,14 @@ func (h *ProductHandler) BatchImport(c *gin.Context) {
 		return
 	}
 
-	processID := uuid.New().String()
-	logrus.Infof("Starting batch import with process ID: %s, total products: %d", processID, len(req.Products))
-
-	response := models.BatchImportResponse{
-		Total:     len(req.Products),
-		Success:   0,
-		Failed:    0,
-		Errors:    []models.BatchImportError{},
-		ProcessID: processID,
-	}
-
-	// 逐个处理商品
-	for i, productReq := range req.Products {
-		product := productReq.ToProduct()
-		product.ID = uuid.New().String()
-
-		// 生成变体
-		variants, err := h.serviceManager.VariantGeneration.GenerateVariantsWithEmbeddings(
-			product, 3, h.serviceManager.Embedding, // 批量导入时减少变体数量
-		)
-		if err != nil {
-			logrus.Errorf("Failed to generate variants for product %d: %v", i, err)
-			response.Failed++
-			response.Errors = append(response.Errors, models.BatchImportError{
-				Index:   i,
-				Product: product.Name,
-				Error:   fmt.Sprintf("Failed to generate variants: %v", err),
-			})
-			continue
-		}
-
-		// 插入商品
-		if err := h.serviceManager.Qdrant.InsertProduct(product, variants); err != nil {
-			logrus.Errorf("Failed to insert product %d: %v", i, err)
-			response.Failed++
-			response.Errors = append(response.Errors, models.BatchImportError{
-				Index:   i,
-				Product: product.Name,
-				Error:   fmt.Sprintf("Failed to save product: %v", err),
-			})
-			continue
-		}
-
-		response.Success++
-		logrus.Debugf("Successfully imported product %d: %s", i, product.Name)
+	job, err := h.serviceManager.Imports.Submit(req.Products)
+	if err != nil {
+		logrus.Errorf("Failed to submit import job: %v", err)
+		InternalErrorResponse(c, "Failed to create import job")
+		return
 	}
 
-	logrus.Infof("Batch import completed: %d success, %d failed", response.Success, response.Failed)
-	SuccessResponse(c, response)
+	SuccessResponse(c, job)
 }
 
 // RegenerateVariants 重新生成商品变体
@@ -243,8 +435,11 @@ func (h *ProductHandler) RegenerateVariants(c *gin.Context) {
 		req.VariantCount = 5
 	}
 
+	unlock := h.serviceManager.LockProduct(productID)
+	defer unlock()
+
 	err := h.serviceManager.VariantGeneration.RegenerateVariants(
-		productID, req.VariantCount, h.serviceManager.Qdrant, h.serviceManager.Embedding,
+		c.Request.Context(), productID, req.VariantCount, h.serviceManager.Qdrant, h.serviceManager.Embedding,
 	)
 	if err != nil {
 		logrus.Errorf("Failed to regenerate variants for product %s: %v", productID, err)
@@ -262,3 +457,27 @@ func (h *ProductHandler) RegenerateVariants(c *gin.Context) {
 
 	SuccessResponse(c, response)
 }
+
+// parseOptionalFloat 解析可选的浮点数查询参数
+func parseOptionalFloat(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// parseTimestamp 解析 unix 秒或 RFC3339 时间，返回 unix 秒
+func parseTimestamp(value string) (float64, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return float64(seconds), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, err
+	}
+	return float64(t.Unix()), nil
+}
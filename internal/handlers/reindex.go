@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"search-ec2/internal/models"
+	"search-ec2/internal/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ReindexHandler 重建索引（蓝绿切换）与版本化集合管理处理器
+type ReindexHandler struct {
+	serviceManager *services.ServiceManager
+}
+
+// NewReindexHandler 创建重建索引处理器
+func NewReindexHandler(serviceManager *services.ServiceManager) *ReindexHandler {
+	return &ReindexHandler{
+		serviceManager: serviceManager,
+	}
+}
+
+// StartReindex 创建新的版本化集合并在后台重建索引
+func (h *ReindexHandler) StartReindex(c *gin.Context) {
+	var opts models.ReindexOptions
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			BadRequestResponse(c, "Invalid request format: "+err.Error())
+			return
+		}
+	}
+
+	job, err := h.serviceManager.Reindex.Start(opts)
+	if err != nil {
+		h.reindexErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponse(c, job)
+}
+
+// ListJobs 列出重建任务
+func (h *ReindexHandler) ListJobs(c *gin.Context) {
+	SuccessResponse(c, h.serviceManager.Reindex.List())
+}
+
+// GetJob 查询重建任务进度
+func (h *ReindexHandler) GetJob(c *gin.Context) {
+	job, err := h.serviceManager.Reindex.Get(c.Param("id"))
+	if err != nil {
+		h.reindexErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponse(c, job)
+}
+
+// CancelJob 取消重建任务并删除新集合
+func (h *ReindexHandler) CancelJob(c *gin.Context) {
+	job, err := h.serviceManager.Reindex.Cancel(c.Param("id"))
+	if err != nil {
+		h.reindexErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponse(c, job)
+}
+
+// SwitchJob 把别名切换到任务构建的新集合，force=true 时数量校验不通过也切换
+func (h *ReindexHandler) SwitchJob(c *gin.Context) {
+	force := false
+	if raw := c.Query("force"); raw != "" {
+		var err error
+		if force, err = strconv.ParseBool(raw); err != nil {
+			BadRequestResponse(c, "Invalid force parameter")
+			return
+		}
+	}
+
+	job, err := h.serviceManager.Reindex.Switch(c.Param("id"), force)
+	if err != nil {
+		h.reindexErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponse(c, job)
+}
+
+// Rollback 把别名切回最近一次切换前的集合
+func (h *ReindexHandler) Rollback(c *gin.Context) {
+	job, err := h.serviceManager.Reindex.Rollback()
+	if err != nil {
+		h.reindexErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponse(c, job)
+}
+
+// ListCollections 列出版本化集合及别名当前指向的集合
+func (h *ReindexHandler) ListCollections(c *gin.Context) {
+	versions, err := h.serviceManager.Qdrant.ListCollectionVersions()
+	if err != nil {
+		logrus.Errorf("Failed to list collections: %v", err)
+		InternalErrorResponse(c, "Failed to list collections")
+		return
+	}
+
+	SuccessResponse(c, versions)
+}
+
+// DeleteCollection 删除不再使用的版本化集合（删除后无法再回滚到该集合）
+func (h *ReindexHandler) DeleteCollection(c *gin.Context) {
+	name := c.Param("name")
+	if err := h.serviceManager.Qdrant.DeleteCollectionVersion(name); err != nil {
+		h.reindexErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponse(c, gin.H{"name": name, "deleted": true})
+}
+
+// reindexErrorResponse 将重建任务和集合错误映射为 HTTP 响应
+func (h *ReindexHandler) reindexErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrReindexJobNotFound):
+		NotFoundResponse(c, "Reindex job not found")
+	case errors.Is(err, services.ErrCollectionNotFound):
+		NotFoundResponse(c, err.Error())
+	case errors.Is(err, services.ErrReindexJobState),
+		errors.Is(err, services.ErrCollectionInUse):
+		ErrorResponse(c, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrReindexValidation),
+		errors.Is(err, services.ErrLegacyCollection),
+		errors.Is(err, services.ErrVectorParamsMismatch):
+		BadRequestResponse(c, err.Error())
+	default:
+		logrus.Errorf("Reindex operation failed: %v", err)
+		InternalErrorResponse(c, "Reindex operation failed")
+	}
+}
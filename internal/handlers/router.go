@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"search-ec2/internal/config"
 	"search-ec2/internal/services"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,11 +21,17 @@ func SetupRoutesWithServices(r *gin.Engine, serviceManager *services.ServiceMana
 	var productHandler *ProductHandler
 	var searchHandler *SearchHandler
 	var configHandler *ConfigHandler
+	var importHandler *ImportHandler
+	var backupHandler *BackupHandler
+	var reindexHandler *ReindexHandler
 	
 	if serviceManager != nil {
 		productHandler = NewProductHandler(serviceManager)
 		searchHandler = NewSearchHandler(serviceManager)
 		configHandler = NewConfigHandler(serviceManager)
+		importHandler = NewImportHandler(serviceManager)
+		backupHandler = NewBackupHandler(serviceManager)
+		reindexHandler = NewReindexHandler(serviceManager)
 	}
 
 	// API 路由组
@@ -36,14 +44,21 @@ func SetupRoutesWithServices(r *gin.Engine, serviceManager *services.ServiceMana
 		products := api.Group("/products")
 		{
 			if productHandler != nil {
-				products.POST("", productHandler.CreateProduct)
+				products.GET("", productHandler.ListProducts)
+				// 创建和批量导入支持 Idempotency-Key，客户端可以安全重试
+				idempotency := NewIdempotencyStore(time.Duration(config.AppConfig.Server.IdempotencyTTL) * time.Second).Middleware()
+				products.POST("", idempotency, productHandler.CreateProduct)
 				products.GET("/:id", productHandler.GetProduct)
 				products.PUT("/:id", productHandler.UpdateProduct)
 				products.DELETE("/:id", productHandler.DeleteProduct)
-				products.POST("/batch", productHandler.BatchImport)
+				products.POST("/batch", idempotency, productHandler.BatchImport)
+				products.POST("/batch-get", productHandler.BatchGetProducts)
 				products.POST("/:id/variants/regenerate", productHandler.RegenerateVariants)
 			} else {
 				// 备用 TODO 响应
+				products.GET("", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "List products - TODO"})
+				})
 				products.POST("", func(c *gin.Context) {
 					SuccessResponse(c, gin.H{"message": "Create product - TODO"})
 				})
@@ -59,12 +74,139 @@ func SetupRoutesWithServices(r *gin.Engine, serviceManager *services.ServiceMana
 				products.POST("/batch", func(c *gin.Context) {
 					SuccessResponse(c, gin.H{"message": "Batch import - TODO"})
 				})
+				products.POST("/batch-get", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Batch get products - TODO"})
+				})
 				products.POST("/:id/variants/regenerate", func(c *gin.Context) {
 					SuccessResponse(c, gin.H{"message": "Regenerate variants - TODO"})
 				})
 			}
 		}
 
+		// 导入任务路由组
+		imports := api.Group("/import")
+		{
+			if importHandler != nil {
+				imports.POST("/upload", importHandler.UploadImport)
+				imports.GET("/jobs", importHandler.ListJobs)
+				imports.GET("/jobs/:id", importHandler.GetJob)
+				imports.POST("/jobs/:id/cancel", importHandler.CancelJob)
+				imports.POST("/jobs/:id/resume", importHandler.ResumeJob)
+			} else {
+				// 备用 TODO 响应
+				imports.POST("/upload", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Upload import file - TODO"})
+				})
+				imports.GET("/jobs", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "List import jobs - TODO"})
+				})
+				imports.GET("/jobs/:id", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Get import job - TODO"})
+				})
+				imports.POST("/jobs/:id/cancel", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Cancel import job - TODO"})
+				})
+				imports.POST("/jobs/:id/resume", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Resume import job - TODO"})
+				})
+			}
+		}
+
+		// 管理路由组：下架和已删除商品的浏览与恢复
+		admin := api.Group("/admin")
+		{
+			if productHandler != nil {
+				admin.GET("/products", productHandler.AdminListProducts)
+				admin.POST("/products/:id/restore", productHandler.RestoreProduct)
+			} else {
+				// 备用 TODO 响应
+				admin.GET("/products", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Admin list products - TODO"})
+				})
+				admin.POST("/products/:id/restore", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Restore product - TODO"})
+				})
+			}
+		}
+
+		// 备份路由组：商品目录导出恢复与集合快照
+		backup := api.Group("/admin")
+		{
+			if backupHandler != nil {
+				backup.GET("/export", backupHandler.Export)
+				backup.POST("/restore", backupHandler.Restore)
+				backup.GET("/snapshots", backupHandler.ListSnapshots)
+				backup.POST("/snapshots", backupHandler.CreateSnapshot)
+				backup.POST("/snapshots/restore", backupHandler.RestoreSnapshot)
+				backup.GET("/snapshots/:name", backupHandler.DownloadSnapshot)
+				backup.DELETE("/snapshots/:name", backupHandler.DeleteSnapshot)
+			} else {
+				// 备用 TODO 响应
+				backup.GET("/export", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Export catalog - TODO"})
+				})
+				backup.POST("/restore", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Restore catalog - TODO"})
+				})
+				backup.GET("/snapshots", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "List snapshots - TODO"})
+				})
+				backup.POST("/snapshots", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Create snapshot - TODO"})
+				})
+				backup.POST("/snapshots/restore", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Restore snapshot - TODO"})
+				})
+				backup.GET("/snapshots/:name", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Download snapshot - TODO"})
+				})
+				backup.DELETE("/snapshots/:name", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Delete snapshot - TODO"})
+				})
+			}
+		}
+
+		// 重建索引路由组：在新的版本化集合中重建并切换别名
+		reindex := api.Group("/admin")
+		{
+			if reindexHandler != nil {
+				reindex.POST("/reindex", reindexHandler.StartReindex)
+				reindex.GET("/reindex", reindexHandler.ListJobs)
+				reindex.POST("/reindex/rollback", reindexHandler.Rollback)
+				reindex.GET("/reindex/:id", reindexHandler.GetJob)
+				reindex.POST("/reindex/:id/cancel", reindexHandler.CancelJob)
+				reindex.POST("/reindex/:id/switch", reindexHandler.SwitchJob)
+				reindex.GET("/collections", reindexHandler.ListCollections)
+				reindex.DELETE("/collections/:name", reindexHandler.DeleteCollection)
+			} else {
+				// 备用 TODO 响应
+				reindex.POST("/reindex", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Start reindex - TODO"})
+				})
+				reindex.GET("/reindex", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "List reindex jobs - TODO"})
+				})
+				reindex.POST("/reindex/rollback", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Rollback reindex - TODO"})
+				})
+				reindex.GET("/reindex/:id", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Get reindex job - TODO"})
+				})
+				reindex.POST("/reindex/:id/cancel", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Cancel reindex job - TODO"})
+				})
+				reindex.POST("/reindex/:id/switch", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Switch reindex job - TODO"})
+				})
+				reindex.GET("/collections", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "List collections - TODO"})
+				})
+				reindex.DELETE("/collections/:name", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Delete collection - TODO"})
+				})
+			}
+		}
+
 		// 搜索路由组
 		search := api.Group("/search")
 		{
@@ -90,6 +232,8 @@ func SetupRoutesWithServices(r *gin.Engine, serviceManager *services.ServiceMana
 				config.PUT("/function-schema", configHandler.UpdateFunctionSchema)
 				config.GET("/variant-prompt", configHandler.GetVariantPrompt)
 				config.PUT("/variant-prompt", configHandler.UpdateVariantPrompt)
+				config.GET("/attributes", configHandler.GetAttributeSchema)
+				config.PUT("/attributes", configHandler.UpdateAttributeSchema)
 			} else {
 				// 备用 TODO 响应
 				config.GET("/function-schema", func(c *gin.Context) {
@@ -104,6 +248,12 @@ func SetupRoutesWithServices(r *gin.Engine, serviceManager *services.ServiceMana
 				config.PUT("/variant-prompt", func(c *gin.Context) {
 					SuccessResponse(c, gin.H{"message": "Update variant prompt - TODO"})
 				})
+				config.GET("/attributes", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Get attribute schema - TODO"})
+				})
+				config.PUT("/attributes", func(c *gin.Context) {
+					SuccessResponse(c, gin.H{"message": "Update attribute schema - TODO"})
+				})
 			}
 		}
 
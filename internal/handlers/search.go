@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"search-ec2/internal/config"
+	"search-ec2/internal/llm"
 	"search-ec2/internal/models"
 	"search-ec2/internal/services"
 	"time"
@@ -36,6 +40,26 @@ func (h *SearchHandler) Search(c *gin.Context) {
 		return
 	}
 
+	if req.SimilarityThreshold != nil && *req.SimilarityThreshold < 0 {
+		BadRequestResponse(c, "similarity_threshold cannot be negative")
+		return
+	}
+
+	if w := req.HybridWeights; w != nil && (w.Dense < 0 || w.Sparse < 0 || w.Dense+w.Sparse == 0) {
+		BadRequestResponse(c, "hybrid_weights must be non-negative and not both zero")
+		return
+	}
+
+	if err := validateFacetRequest(&req); err != nil {
+		BadRequestResponse(c, err.Error())
+		return
+	}
+
+	if err := req.Filter.Validate(); err != nil {
+		BadRequestResponse(c, fmt.Sprintf("Invalid filter: %v", err))
+		return
+	}
+
 	if req.Limit <= 0 {
 		req.Limit = config.AppConfig.Search.MaxResults
 	}
@@ -43,69 +67,251 @@ func (h *SearchHandler) Search(c *gin.Context) {
 		req.Limit = config.AppConfig.Search.MaxResults
 	}
 
-	startTime := time.Now()
-	logrus.Infof("Processing search query: %s", req.Query)
-
-	// 1. 解析用户查询意图
-	parsedQuery, err := h.serviceManager.FunctionCalling.ParseQuery(req.Query)
-	if err != nil {
-		logrus.Errorf("Failed to parse query: %v", err)
-		// 如果解析失败，使用原始查询进行向量搜索
-		parsedQuery = &models.ParsedQuery{
-			ProductType: req.Query,
+	// 解析分页游标：游标携带首次解析的查询意图，翻页时直接复用
+	fingerprint := req.Fingerprint()
+	var parsedQuery *models.ParsedQuery
+	if req.Cursor != "" {
+		var cursor models.SearchCursor
+		if err := models.DecodeCursor(req.Cursor, &cursor); err != nil {
+			BadRequestResponse(c, fmt.Sprintf("Invalid cursor: %v", err))
+			return
+		}
+		if cursor.Fingerprint != fingerprint {
+			BadRequestResponse(c, "Cursor does not belong to this query")
+			return
 		}
+		req.Offset = cursor.Offset
+		parsedQuery = cursor.ParsedQuery
 	}
 
-	// 2. 验证解析结果
-	if err := h.serviceManager.FunctionCalling.ValidateQuery(parsedQuery); err != nil {
-		logrus.Warnf("Query validation failed: %v", err)
-		// 继续处理，但记录警告
+	if req.Offset < 0 {
+		BadRequestResponse(c, "Offset cannot be negative")
+		return
+	}
+	if maxWindow := config.AppConfig.Search.MaxWindow; maxWindow > 0 && req.Offset+req.Limit > maxWindow {
+		BadRequestResponse(c, fmt.Sprintf("Offset + limit cannot exceed %d", maxWindow))
+		return
 	}
 
-	// 3. 增强查询（同义词、纠错等）
-	enhancedQuery := h.serviceManager.FunctionCalling.EnhanceQuery(parsedQuery)
+	startTime := time.Now()
+	logrus.Infof("Processing search query: %s (offset=%d, limit=%d)", req.Query, req.Offset, req.Limit)
+
+	if parsedQuery == nil {
+		parsedQuery = h.parseQuery(c.Request.Context(), req.Query)
+	}
 
-	// 4. 生成搜索向量
-	searchText := enhancedQuery.GetSearchQuery()
+	// 生成搜索向量
+	searchText := parsedQuery.GetSearchQuery()
 	if searchText == "" {
 		searchText = req.Query
 	}
 
-	queryVector, err := h.serviceManager.Embedding.GetEmbedding(searchText)
-	if err != nil {
-		logrus.Errorf("Failed to generate query vector: %v", err)
-		InternalErrorResponse(c, "Failed to process search query")
-		return
+	// 构建过滤条件（解析结果与请求中的显式过滤条件取交集）
+	filter := parsedQuery.ToFilter().And(req.Filter)
+	if !req.IncludeInactive {
+		filter = filter.And(models.VisibleStatusFilter())
 	}
 
-	// 5. 构建过滤条件
-	filter := enhancedQuery.ToQdrantFilter()
+	// 相似度阈值：请求中的值优先，0 表示不限制
+	threshold := config.AppConfig.Search.SimilarityThreshold
+	if req.SimilarityThreshold != nil {
+		threshold = *req.SimilarityThreshold
+	}
+	var scoreThreshold *float64
+	if threshold > 0 {
+		scoreThreshold = &threshold
+	}
 
-	// 6. 执行混合检索
-	results, err := h.serviceManager.Qdrant.SearchProducts(queryVector, filter, req.Limit)
+	// 混合检索权重：请求中的值优先
+	weights := models.HybridWeights{
+		Dense:  config.AppConfig.Search.Hybrid.DenseWeight,
+		Sparse: config.AppConfig.Search.Hybrid.SparseWeight,
+	}
+	if req.HybridWeights != nil {
+		weights = *req.HybridWeights
+	}
+
+	// 混合检索参数（关键词检索使用原始查询，保留型号等精确词）
+	params := services.SearchParams{
+		Filter:         filter,
+		Limit:          req.Limit,
+		Offset:         req.Offset,
+		ScoreThreshold: scoreThreshold,
+		QueryText:      req.Query,
+		DenseWeight:    weights.Dense,
+		SparseWeight:   weights.Sparse,
+	}
+
+	// 有相似度阈值时，命中的商品是阈值筛选后的候选集，总数和分面都按这个集合统计，
+	// 最多统计到 max_window（超过的部分无法翻页到）
+	wantFacets := len(req.Facets) > 0 || len(req.PriceBuckets) > 0
+	var candidates []string
+	var candidatesErr error
+
+	// 向量化时不持有锁，检索时确认线上模型没有被切换（否则用新模型重新向量化）
+	var results []models.SearchResult
+	var hasMore bool
+	var embedErr error
+	err := services.WithServing(func() error {
+		params.Vector, embedErr = h.serviceManager.Embedding.GetEmbedding(c.Request.Context(), searchText)
+		return embedErr
+	}, func() error {
+		var err error
+		results, hasMore, err = h.serviceManager.Qdrant.SearchProducts(params)
+		if err != nil {
+			return err
+		}
+		if scoreThreshold != nil && (hasMore || wantFacets) {
+			candidates, candidatesErr = h.serviceManager.Qdrant.SearchMatchIDs(params, config.AppConfig.Search.MaxWindow)
+			if candidatesErr != nil {
+				logrus.Warnf("Failed to collect matched products: %v", candidatesErr)
+			}
+		}
+		return nil
+	})
+	if embedErr != nil {
+		logrus.Errorf("Failed to generate query vector: %v", embedErr)
+		if errors.Is(embedErr, llm.ErrRateLimited) {
+			ErrorResponse(c, http.StatusTooManyRequests, "Embedding service is rate limited, please retry later")
+			return
+		}
+		InternalErrorResponse(c, "Failed to process search query")
+		return
+	}
 	if err != nil {
 		logrus.Errorf("Failed to search products: %v", err)
 		InternalErrorResponse(c, "Search failed")
 		return
 	}
 
-	// 7. 构建响应
+	// 统计总数：最后一页时可以精确得出；没有相似度阈值时每个满足过滤条件的商品都会命中，按过滤条件计数
+	total := req.Offset + len(results)
+	if hasMore {
+		if scoreThreshold != nil {
+			if candidatesErr == nil && len(candidates) > total {
+				total = len(candidates)
+			}
+		} else if count, err := h.serviceManager.Qdrant.CountProducts(filter); err != nil {
+			logrus.Warnf("Failed to count products: %v", err)
+		} else if count > total {
+			total = count
+		}
+	}
+
+	// 构建响应
 	timeTaken := time.Since(startTime).Milliseconds()
-	
+
 	response := models.SearchResponse{
 		Query:       req.Query,
-		Total:       len(results),
+		Total:       total,
+		Offset:      req.Offset,
+		Limit:       req.Limit,
+		HasMore:     hasMore,
 		Results:     results,
-		ParsedQuery: enhancedQuery,
+		ParsedQuery: parsedQuery,
 		TimeTaken:   timeTaken,
 	}
 
-	logrus.Infof("Search completed: query='%s', results=%d, time=%dms", 
-		req.Query, len(results), timeTaken)
+	// 分面统计失败不影响搜索结果；统计范围与 total 一致
+	if wantFacets && candidatesErr == nil {
+		facetFilter := filter
+		if scoreThreshold != nil {
+			facetFilter = candidateFilter(filter, candidates)
+		}
+
+		if len(req.Facets) > 0 {
+			facetLimit := req.FacetLimit
+			if facetLimit <= 0 {
+				facetLimit = config.AppConfig.Search.FacetLimit
+			}
+			if facetLimit <= 0 {
+				facetLimit = 10
+			}
+			if facets, err := h.serviceManager.Qdrant.FacetCounts(facetFilter, req.Facets, facetLimit); err != nil {
+				logrus.Warnf("Failed to compute facets: %v", err)
+			} else {
+				response.Facets = facets
+			}
+		}
+		if len(req.PriceBuckets) > 0 {
+			if buckets, err := h.serviceManager.Qdrant.PriceBucketCounts(facetFilter, req.PriceBuckets); err != nil {
+				logrus.Warnf("Failed to compute price buckets: %v", err)
+			} else {
+				response.PriceBuckets = buckets
+			}
+		}
+	}
+
+	if hasMore {
+		nextCursor, err := models.EncodeCursor(models.SearchCursor{
+			Offset:      req.Offset + len(results),
+			Fingerprint: fingerprint,
+			ParsedQuery: parsedQuery,
+		})
+		if err != nil {
+			logrus.Errorf("Failed to encode cursor: %v", err)
+		} else {
+			response.NextCursor = nextCursor
+		}
+	}
+
+	logrus.Infof("Search completed: query='%s', results=%d, total=%d, time=%dms",
+		req.Query, len(results), total, timeTaken)
 
 	SuccessResponse(c, response)
 }
 
+// 分面请求上限
+const (
+	maxFacetFields  = 10
+	maxPriceBuckets = 20
+)
+
+// validateFacetRequest 校验分面统计参数：字段必须在属性注册表中标记为 facetable，价格边界必须递增
+func validateFacetRequest(req *models.SearchRequest) error {
+	if len(req.Facets) > maxFacetFields {
+		return fmt.Errorf("at most %d facets can be requested", maxFacetFields)
+	}
+	for _, field := range req.Facets {
+		attr, ok := config.AttributeRegistry().Lookup(field)
+		if !ok || !attr.Facetable {
+			return fmt.Errorf("attribute %q is not facetable", field)
+		}
+	}
+
+	if len(req.PriceBuckets) > maxPriceBuckets {
+		return fmt.Errorf("at most %d price bucket bounds are allowed", maxPriceBuckets)
+	}
+	for i := 1; i < len(req.PriceBuckets); i++ {
+		if req.PriceBuckets[i] <= req.PriceBuckets[i-1] {
+			return fmt.Errorf("price_buckets must be strictly increasing")
+		}
+	}
+	return nil
+}
+
+// parseQuery 解析、验证并增强用户查询意图
+func (h *SearchHandler) parseQuery(ctx context.Context, query string) *models.ParsedQuery {
+	// 1. 解析用户查询意图
+	parsedQuery, err := h.serviceManager.FunctionCalling.ParseQuery(ctx, query)
+	if err != nil {
+		logrus.Errorf("Failed to parse query: %v", err)
+		// 如果解析失败，使用原始查询进行向量搜索
+		parsedQuery = &models.ParsedQuery{
+			ProductType: query,
+		}
+	}
+
+	// 2. 验证解析结果
+	if err := h.serviceManager.FunctionCalling.ValidateQuery(parsedQuery); err != nil {
+		logrus.Warnf("Query validation failed: %v", err)
+		// 继续处理，但记录警告
+	}
+
+	// 3. 增强查询（同义词、纠错等）
+	return h.serviceManager.FunctionCalling.EnhanceQuery(parsedQuery)
+}
+
 // GetSuggestions 获取搜索建议
 func (h *SearchHandler) GetSuggestions(c *gin.Context) {
 	query := c.Query("query")
@@ -126,7 +332,7 @@ func (h *SearchHandler) GetSuggestions(c *gin.Context) {
 	logrus.Infof("Generating suggestions for query: %s", query)
 
 	// 使用 Function Calling 服务生成建议
-	suggestions, err := h.serviceManager.FunctionCalling.GetQuerySuggestions(query)
+	suggestions, err := h.serviceManager.FunctionCalling.GetQuerySuggestions(c.Request.Context(), query)
 	if err != nil {
 		logrus.Errorf("Failed to generate suggestions: %v", err)
 		// 返回默认建议
@@ -166,3 +372,15 @@ func (h *SearchHandler) getDefaultSuggestions(query string, limit int) []string
 
 	return suggestions
 }
+
+// candidateFilter 将过滤条件限定到命中的商品 ID；没有命中时返回不匹配任何商品的条件
+func candidateFilter(filter *models.Filter, productIDs []string) *models.Filter {
+	values := make([]interface{}, 0, len(productIDs))
+	for _, id := range productIDs {
+		values = append(values, id)
+	}
+	if len(values) == 0 {
+		return filter.And(&models.Filter{Must: []models.Condition{models.NewExistsCondition("product_id", false)}})
+	}
+	return filter.And(&models.Filter{Must: []models.Condition{models.NewMatchAnyCondition("product_id", values...)}})
+}
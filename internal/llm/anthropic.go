@@ -0,0 +1,244 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"search-ec2/internal/models"
+	"strings"
+)
+
+const (
+	anthropicVersion        = "2023-06-01"
+	bedrockAnthropicVersion = "bedrock-2023-05-31"
+	anthropicMaxTokens      = 1024 // Messages API 要求 max_tokens，请求未设置时使用
+)
+
+// anthropicProvider Anthropic Messages API（/messages），base_url 形如 https://api.anthropic.com/v1
+type anthropicProvider struct{}
+
+// anthropicRequest Messages API 请求
+type anthropicRequest struct {
+	Model            string             `json:"model,omitempty"`             // Bedrock 的模型在 URL 中，不放在请求体
+	AnthropicVersion string             `json:"anthropic_version,omitempty"` // 仅 Bedrock 使用
+	System           string             `json:"system,omitempty"`
+	Messages         []anthropicMessage `json:"messages"`
+	MaxTokens        int                `json:"max_tokens"`
+	Temperature      *float64           `json:"temperature,omitempty"`
+	Tools            []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice       map[string]string  `json:"tool_choice,omitempty"`
+}
+
+// anthropicMessage Messages API 消息
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// anthropicTool Messages API 工具定义
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+// anthropicResponse Messages API 响应
+type anthropicResponse struct {
+	ID         string             `json:"id"`
+	Model      string             `json:"model"`
+	Content    []anthropicContent `json:"content"`
+	StopReason string             `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// anthropicContent 响应内容块（text / tool_use）
+type anthropicContent struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+// setHeaders x-api-key 鉴权
+func (anthropicProvider) setHeaders(header http.Header, apiKey string) {
+	header.Set("x-api-key", apiKey)
+	header.Set("anthropic-version", anthropicVersion)
+}
+
+// chat 调用 /messages
+func (anthropicProvider) chat(ctx context.Context, c *Client, request *models.OpenAIRequest) (*models.OpenAIResponse, error) {
+	body, schemaTool := toAnthropicRequest(request)
+	body.Model = request.Model
+	return postAnthropic(ctx, c, "/messages", body, request, schemaTool)
+}
+
+// embeddings Anthropic 没有向量化接口
+func (anthropicProvider) embeddings(context.Context, *Client, *models.EmbeddingRequest) (*models.EmbeddingResponse, error) {
+	return nil, &APIError{Kind: ErrBadRequest, Message: "anthropic provider does not support embeddings"}
+}
+
+// postAnthropic 发送 Messages 格式的请求并把响应转换为 OpenAI 格式（Anthropic 与 Bedrock 共用）
+func postAnthropic(ctx context.Context, c *Client, path string, body *anthropicRequest, request *models.OpenAIRequest, schemaTool string) (*models.OpenAIResponse, error) {
+	var response *models.OpenAIResponse
+	err := c.post(ctx, path, body, estimateChatTokens(request), func(data []byte) (int, error) {
+		var parsed anthropicResponse
+		if err := json.Unmarshal(data, &parsed); err != nil {
+			return 0, invalidResponse(err)
+		}
+		response = fromAnthropicResponse(&parsed, request, schemaTool)
+		return response.Usage.TotalTokens, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// toAnthropicRequest 把 OpenAI 格式的请求转换为 Messages 格式
+// functions / tools 转换为 tools，response_format 为 json_schema 时用一个强制调用的工具承载 schema，
+// 返回该工具名，响应中该工具的参数会作为文本内容返回
+func toAnthropicRequest(request *models.OpenAIRequest) (*anthropicRequest, string) {
+	body := &anthropicRequest{MaxTokens: request.MaxTokens}
+	if body.MaxTokens <= 0 {
+		body.MaxTokens = anthropicMaxTokens
+	}
+	if request.Temperature > 0 {
+		// OpenAI 的温度范围是 0-2，Anthropic 是 0-1
+		temperature := min(request.Temperature, 1)
+		body.Temperature = &temperature
+	}
+
+	var system []string
+	for _, message := range request.Messages {
+		if message.Role == "system" {
+			system = append(system, message.Content)
+			continue
+		}
+		body.Messages = append(body.Messages, anthropicMessage{Role: message.Role, Content: message.Content})
+	}
+	body.System = strings.Join(system, "\n\n")
+
+	for _, tool := range request.Tools {
+		body.Tools = append(body.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: tool.Function.Parameters,
+		})
+	}
+	for _, function := range request.Functions {
+		body.Tools = append(body.Tools, anthropicTool{
+			Name:        function.Name,
+			Description: function.Description,
+			InputSchema: function.Parameters,
+		})
+	}
+	body.ToolChoice = anthropicToolChoice(request.ToolChoice)
+	if body.ToolChoice == nil {
+		body.ToolChoice = anthropicToolChoice(request.FunctionCall)
+	}
+
+	schemaTool := ""
+	if format := request.ResponseFormat; format != nil && format.Type == "json_schema" && format.JSONSchema != nil {
+		schemaTool = format.JSONSchema.Name
+		body.Tools = append(body.Tools, anthropicTool{
+			Name:        schemaTool,
+			Description: format.JSONSchema.Description,
+			InputSchema: format.JSONSchema.Schema,
+		})
+		body.ToolChoice = map[string]string{"type": "tool", "name": schemaTool}
+	}
+	return body, schemaTool
+}
+
+// anthropicToolChoice 转换 tool_choice / function_call
+func anthropicToolChoice(choice interface{}) map[string]string {
+	switch v := choice.(type) {
+	case string:
+		switch v {
+		case "auto":
+			return map[string]string{"type": "auto"}
+		case "required":
+			return map[string]string{"type": "any"}
+		case "none":
+			return map[string]string{"type": "none"}
+		}
+	case map[string]string:
+		if name := v["name"]; name != "" {
+			return map[string]string{"type": "tool", "name": name}
+		}
+	case map[string]interface{}:
+		if name, _ := v["name"].(string); name != "" {
+			return map[string]string{"type": "tool", "name": name}
+		}
+		if function, ok := v["function"].(map[string]string); ok && function["name"] != "" {
+			return map[string]string{"type": "tool", "name": function["name"]}
+		}
+		if function, ok := v["function"].(map[string]interface{}); ok {
+			if name, _ := function["name"].(string); name != "" {
+				return map[string]string{"type": "tool", "name": name}
+			}
+		}
+	}
+	return nil
+}
+
+// fromAnthropicResponse 把 Messages 响应转换为 OpenAI 格式
+func fromAnthropicResponse(parsed *anthropicResponse, request *models.OpenAIRequest, schemaTool string) *models.OpenAIResponse {
+	message := models.OpenAIMessage{Role: "assistant"}
+	var text []string
+	for _, block := range parsed.Content {
+		switch block.Type {
+		case "text":
+			text = append(text, block.Text)
+		case "tool_use":
+			arguments := string(block.Input)
+			if schemaTool != "" && block.Name == schemaTool {
+				text = append(text, arguments)
+				continue
+			}
+			message.ToolCalls = append(message.ToolCalls, models.OpenAIToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: models.OpenAIFunctionCall{Name: block.Name, Arguments: arguments},
+			})
+		}
+	}
+	message.Content = strings.Join(text, "")
+	// 使用旧的 functions 字段的请求同时填充 function_call
+	if len(request.Functions) > 0 && len(message.ToolCalls) > 0 {
+		call := message.ToolCalls[0].Function
+		message.FunctionCall = &call
+	}
+
+	return &models.OpenAIResponse{
+		ID:     parsed.ID,
+		Object: "chat.completion",
+		Model:  parsed.Model,
+		Choices: []models.OpenAIChoice{{
+			Message:      message,
+			FinishReason: anthropicFinishReason(parsed.StopReason),
+		}},
+		Usage: models.OpenAIUsage{
+			PromptTokens:     parsed.Usage.InputTokens,
+			CompletionTokens: parsed.Usage.OutputTokens,
+			TotalTokens:      parsed.Usage.InputTokens + parsed.Usage.OutputTokens,
+		},
+	}
+}
+
+// anthropicFinishReason 转换 stop_reason
+func anthropicFinishReason(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	}
+	return reason
+}
@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"search-ec2/internal/models"
+)
+
+// bedrockProvider Bedrock InvokeModel 风格的协议（POST /model/{modelId}/invoke）
+// 对话使用 Claude 的 Messages 格式，向量化使用 Titan Embeddings 格式（每次请求一条文本）
+// 鉴权使用 Bearer（Bedrock API Key 或网关的 Key），不做 SigV4 签名
+type bedrockProvider struct{}
+
+// titanEmbeddingRequest Titan Embeddings 请求
+type titanEmbeddingRequest struct {
+	InputText string `json:"inputText"`
+}
+
+// titanEmbeddingResponse Titan Embeddings 响应
+type titanEmbeddingResponse struct {
+	Embedding           []float32 `json:"embedding"`
+	InputTextTokenCount int       `json:"inputTextTokenCount"`
+}
+
+// setHeaders Bearer 鉴权
+func (bedrockProvider) setHeaders(header http.Header, apiKey string) {
+	header.Set("Authorization", "Bearer "+apiKey)
+	header.Set("Accept", "application/json")
+}
+
+// chat 以 Messages 格式调用 InvokeModel
+func (bedrockProvider) chat(ctx context.Context, c *Client, request *models.OpenAIRequest) (*models.OpenAIResponse, error) {
+	body, schemaTool := toAnthropicRequest(request)
+	body.AnthropicVersion = bedrockAnthropicVersion
+	response, err := postAnthropic(ctx, c, bedrockInvokePath(request.Model), body, request, schemaTool)
+	if err != nil {
+		return nil, err
+	}
+	if response.Model == "" {
+		response.Model = request.Model
+	}
+	return response, nil
+}
+
+// embeddings 逐条文本调用 Titan Embeddings
+func (bedrockProvider) embeddings(ctx context.Context, c *Client, request *models.EmbeddingRequest) (*models.EmbeddingResponse, error) {
+	path := bedrockInvokePath(request.Model)
+	response := &models.EmbeddingResponse{
+		Object: "list",
+		Model:  request.Model,
+		Data:   make([]models.EmbeddingData, 0, len(request.Input)),
+	}
+
+	for i, text := range request.Input {
+		var parsed titanEmbeddingResponse
+		err := c.post(ctx, path, titanEmbeddingRequest{InputText: text}, estimateTokens(text), func(data []byte) (int, error) {
+			parsed = titanEmbeddingResponse{}
+			if err := json.Unmarshal(data, &parsed); err != nil {
+				return 0, invalidResponse(err)
+			}
+			return parsed.InputTextTokenCount, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(parsed.Embedding) == 0 {
+			return nil, &APIError{Kind: ErrUpstream, StatusCode: http.StatusOK, Message: "empty embedding in response"}
+		}
+
+		response.Data = append(response.Data, models.EmbeddingData{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: parsed.Embedding,
+		})
+		response.Usage.PromptTokens += parsed.InputTextTokenCount
+		response.Usage.TotalTokens += parsed.InputTextTokenCount
+	}
+	return response, nil
+}
+
+// bedrockInvokePath InvokeModel 路径，模型 ID（可能是 ARN）需要转义
+func bedrockInvokePath(model string) string {
+	return "/model/" + url.PathEscape(model) + "/invoke"
+}
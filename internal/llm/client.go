@@ -0,0 +1,308 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"search-ec2/internal/config"
+	"search-ec2/internal/models"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMaxRetries     = 3
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 20 * time.Second
+	defaultTimeout        = 30 * time.Second
+)
+
+// Options LLM 客户端配置
+type Options struct {
+	Provider          string // openai / anthropic / bedrock，默认 openai
+	BaseURL           string
+	APIKey            string
+	Timeout           time.Duration // 单次请求超时，每次重试单独计时
+	MaxRetries        int           // 最大重试次数，0 使用默认值 3，负数表示不重试
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	RequestsPerMinute int      // 0 表示不限制
+	TokensPerMinute   int      // 0 表示不限制
+	Limiter           *Limiter // 多个客户端共享额度时传入，为空时按上面两项创建
+	Dimensions        int      // hash 协议的向量维度
+}
+
+// OptionsFromConfig 从应用配置构建指定协议的客户端配置
+func OptionsFromConfig(provider string) Options {
+	cfg := config.AppConfig
+	connection := cfg.OpenAI.Provider(provider)
+	dimensions := connection.Dimensions
+	if dimensions <= 0 {
+		dimensions = cfg.Qdrant.VectorSize
+	}
+	// 配置中 0 表示不重试，Options 中 0 表示使用默认值
+	maxRetries := 0
+	if cfg.LLM.MaxRetries != nil {
+		maxRetries = *cfg.LLM.MaxRetries
+		if maxRetries == 0 {
+			maxRetries = -1
+		}
+	}
+	return Options{
+		Provider:          provider,
+		BaseURL:           connection.BaseURL,
+		APIKey:            connection.APIKey,
+		Timeout:           time.Duration(cfg.OpenAI.Timeout) * time.Second,
+		MaxRetries:        maxRetries,
+		InitialBackoff:    time.Duration(cfg.LLM.InitialBackoffMs) * time.Millisecond,
+		MaxBackoff:        time.Duration(cfg.LLM.MaxBackoffMs) * time.Millisecond,
+		RequestsPerMinute: cfg.LLM.RequestsPerMinute,
+		TokensPerMinute:   cfg.LLM.TokensPerMinute,
+		Dimensions:        dimensions,
+	}
+}
+
+// Client 模型服务客户端，负责超时、重试、退避和限流，协议差异由 provider 处理
+type Client struct {
+	http     *http.Client
+	opts     Options
+	provider provider
+	limiter  *Limiter
+}
+
+// New 创建客户端，未设置的超时、重试和退避参数使用默认值
+func New(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = defaultMaxRetries
+	} else if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = defaultInitialBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+	if opts.Provider == "" {
+		opts.Provider = config.ProviderOpenAI
+	}
+	opts.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+
+	limiter := opts.Limiter
+	if limiter == nil {
+		limiter = NewLimiter(opts.RequestsPerMinute, opts.TokensPerMinute)
+	}
+
+	return &Client{
+		http:     &http.Client{},
+		opts:     opts,
+		provider: newProvider(opts.Provider),
+		limiter:  limiter,
+	}
+}
+
+var (
+	clientsMu     sync.Mutex
+	clients       = make(map[string]*Client)
+	sharedLimiter *Limiter
+)
+
+// ForProvider 返回按应用配置创建的指定协议的共享客户端
+// 所有客户端共用同一个限流器，额度在对话和向量化请求之间共享
+func ForProvider(name string) *Client {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	if client, ok := clients[name]; ok {
+		return client
+	}
+	if sharedLimiter == nil {
+		sharedLimiter = NewLimiter(config.AppConfig.LLM.RequestsPerMinute, config.AppConfig.LLM.TokensPerMinute)
+	}
+
+	opts := OptionsFromConfig(name)
+	opts.Limiter = sharedLimiter
+	client := New(opts)
+	clients[name] = client
+	return client
+}
+
+// ChatCompletion 发送对话请求，请求和响应使用 OpenAI 格式，由协议适配器转换
+func (c *Client) ChatCompletion(ctx context.Context, request *models.OpenAIRequest) (*models.OpenAIResponse, error) {
+	if c.provider == nil {
+		return nil, &APIError{Kind: ErrBadRequest, Message: fmt.Sprintf("unknown provider %q", c.opts.Provider)}
+	}
+	return c.provider.chat(ctx, c, request)
+}
+
+// Embeddings 发送向量化请求，请求和响应使用 OpenAI 格式，由协议适配器转换
+func (c *Client) Embeddings(ctx context.Context, request *models.EmbeddingRequest) (*models.EmbeddingResponse, error) {
+	if c.provider == nil {
+		return nil, &APIError{Kind: ErrBadRequest, Message: fmt.Sprintf("unknown provider %q", c.opts.Provider)}
+	}
+	return c.provider.embeddings(ctx, c, request)
+}
+
+// post 发送请求并在限流和上游错误时重试
+// decode 解析 200 响应并返回实际消耗的 token 数，用于校正限流额度。
+// 调用方没有设置截止时间时按 maxElapsed 限制总耗时，避免后台任务无限等待
+func (c *Client) post(ctx context.Context, path string, payload any, estimate int, decode func([]byte) (int, error)) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.maxElapsed())
+		defer cancel()
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := c.limiter.Wait(ctx, estimate); err != nil {
+			return err
+		}
+
+		used, err := c.attempt(ctx, path, body, decode)
+		if err == nil {
+			if used > 0 {
+				c.limiter.Adjust(used - estimate)
+			}
+			return nil
+		}
+		// 请求失败时退还预扣的 token
+		c.limiter.Adjust(-estimate)
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			return err
+		}
+		apiErr.Attempts = attempt
+		if !apiErr.Retryable() || attempt > c.opts.MaxRetries {
+			return apiErr
+		}
+
+		// Retry-After 同样不超过 MaxBackoff，上游要求等待更久时也只等待 MaxBackoff
+		delay := c.backoff(attempt)
+		if apiErr.RetryAfter > 0 {
+			delay = min(apiErr.RetryAfter, c.opts.MaxBackoff)
+		}
+		if apiErr.Kind == ErrRateLimited {
+			c.limiter.Pause(delay)
+		}
+		// 等待时间超过调用方的截止时间时不再重试
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return apiErr
+		}
+
+		logrus.Warnf("LLM request %s failed (attempt %d/%d), retrying in %v: %v",
+			path, attempt, c.opts.MaxRetries+1, delay, apiErr)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt 发送一次请求，超时按 Options.Timeout 单独计算
+func (c *Client) attempt(ctx context.Context, path string, body []byte, decode func([]byte) (int, error)) (int, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(attemptCtx, http.MethodPost, c.opts.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.provider.setHeaders(req.Header, c.opts.APIKey)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// 调用方取消或超时直接返回，单次请求超时按上游故障重试
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, &APIError{Kind: ErrUpstream, Message: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, &APIError{Kind: ErrUpstream, StatusCode: resp.StatusCode, Message: "failed to read response: " + err.Error()}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, newStatusError(resp.StatusCode, responseBody, resp.Header)
+	}
+	return decode(responseBody)
+}
+
+// maxElapsed 一次调用（包括全部重试和等待）的最长耗时
+func (c *Client) maxElapsed() time.Duration {
+	attempts := time.Duration(c.opts.MaxRetries + 1)
+	return attempts*c.opts.Timeout + (attempts-1)*c.opts.MaxBackoff
+}
+
+// backoff 第 attempt 次失败后的等待时间：指数增长，加 ±20% 随机抖动，不超过 MaxBackoff
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.opts.InitialBackoff << (attempt - 1)
+	if delay <= 0 || delay > c.opts.MaxBackoff {
+		delay = c.opts.MaxBackoff
+	}
+	jitter := 0.8 + rand.Float64()*0.4
+	return min(time.Duration(float64(delay)*jitter), c.opts.MaxBackoff)
+}
+
+// bodyError 状态码为 200 但响应体带有错误时构建错误
+func bodyError(e *models.OpenAIError) *APIError {
+	return &APIError{
+		Kind:       kindForErrorType(e.Type, e.Code),
+		StatusCode: http.StatusOK,
+		Message:    e.Message,
+	}
+}
+
+// estimateChatTokens 估算对话请求的 token 数（输入加上最大输出）
+func estimateChatTokens(request *models.OpenAIRequest) int {
+	estimate := request.MaxTokens
+	for _, message := range request.Messages {
+		estimate += estimateTokens(message.Content)
+	}
+	return estimate
+}
+
+// invalidResponse 200 响应无法解析时的错误
+func invalidResponse(err error) *APIError {
+	return &APIError{Kind: ErrUpstream, StatusCode: http.StatusOK, Message: "invalid response: " + err.Error()}
+}
+
+// estimateTokens 粗略估算 token 数：ASCII 约 4 个字符一个 token，其他字符（中文等）按一个字一个 token
+func estimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < 128 {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return ascii/4 + other + 1
+}
@@ -0,0 +1,395 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"search-ec2/internal/config"
+	"search-ec2/internal/models"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient 创建请求发往 handler 的客户端，重试等待为 1ms
+func newTestClient(t *testing.T, provider string, maxRetries int, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return New(Options{
+		Provider:       provider,
+		BaseURL:        server.URL,
+		APIKey:         "test-key",
+		Timeout:        5 * time.Second,
+		MaxRetries:     maxRetries,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+	})
+}
+
+// decodeBody 解析请求体，失败时标记测试失败
+func decodeBody(t *testing.T, r *http.Request, v any) {
+	t.Helper()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Errorf("read body: %v", err)
+		return
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Errorf("decode body %s: %v", data, err)
+	}
+}
+
+// parseFunction 测试用的函数定义
+var parseFunction = models.OpenAIFunction{
+	Name:        "parse_product_query",
+	Description: "解析查询",
+	Parameters: map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"product_type": map[string]interface{}{"type": "string"}},
+	},
+}
+
+func TestOpenAIChat(t *testing.T) {
+	client := newTestClient(t, config.ProviderOpenAI, 0, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		var request models.OpenAIRequest
+		decodeBody(t, r, &request)
+		if request.Model != "gpt-test" || len(request.Tools) != 1 || request.Tools[0].Function.Name != parseFunction.Name {
+			t.Errorf("unexpected request: %+v", request)
+		}
+
+		w.Write([]byte(`{"id":"chatcmpl-1","model":"gpt-test","choices":[{"index":0,"finish_reason":"tool_calls",
+			"message":{"role":"assistant","tool_calls":[{"id":"call_1","type":"function",
+			"function":{"name":"parse_product_query","arguments":"{\"product_type\":\"手机\"}"}}]}}],
+			"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`))
+	})
+
+	response, err := client.ChatCompletion(context.Background(), &models.OpenAIRequest{
+		Model:    "gpt-test",
+		Messages: []models.OpenAIMessage{{Role: "user", Content: "手机"}},
+		Tools:    []models.OpenAITool{{Type: "function", Function: parseFunction}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	calls := response.Choices[0].Message.ToolCalls
+	if len(calls) != 1 || calls[0].Function.Arguments != `{"product_type":"手机"}` {
+		t.Fatalf("tool calls = %+v", calls)
+	}
+	if response.Usage.TotalTokens != 15 {
+		t.Errorf("usage = %+v", response.Usage)
+	}
+}
+
+func TestOpenAIEmbeddings(t *testing.T) {
+	client := newTestClient(t, config.ProviderOpenAI, 0, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		var request models.EmbeddingRequest
+		decodeBody(t, r, &request)
+		if len(request.Input) != 2 {
+			t.Errorf("input = %v", request.Input)
+		}
+		w.Write([]byte(`{"object":"list","data":[{"index":0,"embedding":[0.1,0.2]},{"index":1,"embedding":[0.3,0.4]}],
+			"usage":{"prompt_tokens":4,"total_tokens":4}}`))
+	})
+
+	response, err := client.Embeddings(context.Background(), &models.EmbeddingRequest{Model: "embed-test", Input: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("Embeddings: %v", err)
+	}
+	if len(response.Data) != 2 || response.Data[1].Embedding[1] != 0.4 {
+		t.Fatalf("data = %+v", response.Data)
+	}
+}
+
+func TestAnthropicChat(t *testing.T) {
+	client := newTestClient(t, config.ProviderAnthropic, 0, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") != anthropicVersion {
+			t.Errorf("headers = %v", r.Header)
+		}
+		var request anthropicRequest
+		decodeBody(t, r, &request)
+		if request.Model != "claude-test" || request.System != "你是助手" || len(request.Messages) != 1 {
+			t.Errorf("unexpected request: %+v", request)
+		}
+		if request.MaxTokens != anthropicMaxTokens {
+			t.Errorf("max_tokens = %d", request.MaxTokens)
+		}
+		if request.Temperature == nil || *request.Temperature != 1 {
+			t.Errorf("temperature = %v, want clamped to 1", request.Temperature)
+		}
+		if len(request.Tools) != 1 || request.ToolChoice["type"] != "tool" || request.ToolChoice["name"] != parseFunction.Name {
+			t.Errorf("tools = %+v, tool_choice = %v", request.Tools, request.ToolChoice)
+		}
+
+		w.Write([]byte(`{"id":"msg_1","model":"claude-test","stop_reason":"tool_use",
+			"content":[{"type":"text","text":"好的"},{"type":"tool_use","id":"toolu_1","name":"parse_product_query","input":{"product_type":"手机"}}],
+			"usage":{"input_tokens":12,"output_tokens":8}}`))
+	})
+
+	response, err := client.ChatCompletion(context.Background(), &models.OpenAIRequest{
+		Model: "claude-test",
+		Messages: []models.OpenAIMessage{
+			{Role: "system", Content: "你是助手"},
+			{Role: "user", Content: "手机"},
+		},
+		Temperature: 1.5,
+		Tools:       []models.OpenAITool{{Type: "function", Function: parseFunction}},
+		ToolChoice:  map[string]interface{}{"type": "function", "function": map[string]string{"name": parseFunction.Name}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+
+	choice := response.Choices[0]
+	if choice.FinishReason != "tool_calls" || choice.Message.Content != "好的" {
+		t.Errorf("choice = %+v", choice)
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != `{"product_type":"手机"}` {
+		t.Errorf("tool calls = %+v", choice.Message.ToolCalls)
+	}
+	if response.Usage.TotalTokens != 20 {
+		t.Errorf("usage = %+v", response.Usage)
+	}
+}
+
+func TestAnthropicJSONSchema(t *testing.T) {
+	client := newTestClient(t, config.ProviderAnthropic, 0, func(w http.ResponseWriter, r *http.Request) {
+		var request anthropicRequest
+		decodeBody(t, r, &request)
+		if len(request.Tools) != 1 || request.Tools[0].Name != "query" || request.ToolChoice["name"] != "query" {
+			t.Errorf("schema tool not forced: %+v %v", request.Tools, request.ToolChoice)
+		}
+		w.Write([]byte(`{"content":[{"type":"tool_use","id":"toolu_1","name":"query","input":{"product_type":"耳机"}}],
+			"stop_reason":"tool_use"}`))
+	})
+
+	response, err := client.ChatCompletion(context.Background(), &models.OpenAIRequest{
+		Model:    "claude-test",
+		Messages: []models.OpenAIMessage{{Role: "user", Content: "耳机"}},
+		ResponseFormat: &models.OpenAIResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &models.OpenAIJSONSchema{Name: "query", Schema: parseFunction.Parameters},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	message := response.Choices[0].Message
+	if message.Content != `{"product_type":"耳机"}` || len(message.ToolCalls) != 0 {
+		t.Fatalf("schema output should be returned as content: %+v", message)
+	}
+}
+
+func TestBedrockChat(t *testing.T) {
+	model := "anthropic.claude-3-haiku-20240307-v1:0"
+	client := newTestClient(t, config.ProviderBedrock, 0, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/model/anthropic.claude-3-haiku-20240307-v1:0/invoke" {
+			t.Errorf("path = %s", r.URL.EscapedPath())
+		}
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		var request anthropicRequest
+		decodeBody(t, r, &request)
+		if request.Model != "" || request.AnthropicVersion != bedrockAnthropicVersion {
+			t.Errorf("model = %q, anthropic_version = %q", request.Model, request.AnthropicVersion)
+		}
+		w.Write([]byte(`{"content":[{"type":"text","text":"[\"变体\"]"}],"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":2}}`))
+	})
+
+	response, err := client.ChatCompletion(context.Background(), &models.OpenAIRequest{
+		Model:    model,
+		Messages: []models.OpenAIMessage{{Role: "user", Content: "生成变体"}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if response.Model != model || response.Choices[0].FinishReason != "stop" || response.Choices[0].Message.Content != `["变体"]` {
+		t.Fatalf("response = %+v", response)
+	}
+}
+
+func TestBedrockEmbeddings(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestClient(t, config.ProviderBedrock, 0, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.EscapedPath() != "/model/amazon.titan-embed-text-v2:0/invoke" {
+			t.Errorf("path = %s", r.URL.EscapedPath())
+		}
+		var request titanEmbeddingRequest
+		decodeBody(t, r, &request)
+		json.NewEncoder(w).Encode(titanEmbeddingResponse{
+			Embedding:           []float32{float32(len(request.InputText))},
+			InputTextTokenCount: 2,
+		})
+	})
+
+	response, err := client.Embeddings(context.Background(), &models.EmbeddingRequest{
+		Model: "amazon.titan-embed-text-v2:0",
+		Input: []string{"a", "bbb"},
+	})
+	if err != nil {
+		t.Fatalf("Embeddings: %v", err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("expected one request per input, got %d", requests.Load())
+	}
+	if len(response.Data) != 2 || response.Data[1].Index != 1 || response.Data[1].Embedding[0] != 3 {
+		t.Errorf("data = %+v", response.Data)
+	}
+	if response.Usage.TotalTokens != 4 {
+		t.Errorf("usage = %+v", response.Usage)
+	}
+}
+
+func TestErrorMapping(t *testing.T) {
+	const maxRetries = 2
+	cases := []struct {
+		status   int
+		kind     error
+		attempts int32
+	}{
+		{http.StatusTooManyRequests, ErrRateLimited, maxRetries + 1},
+		{http.StatusServiceUnavailable, ErrUpstream, maxRetries + 1},
+		{http.StatusInternalServerError, ErrUpstream, maxRetries + 1},
+		{http.StatusBadRequest, ErrBadRequest, 1},
+		{http.StatusUnauthorized, ErrAuth, 1},
+	}
+
+	for _, provider := range []string{config.ProviderOpenAI, config.ProviderAnthropic, config.ProviderBedrock} {
+		for _, tc := range cases {
+			var attempts atomic.Int32
+			client := newTestClient(t, provider, maxRetries, func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(tc.status)
+				w.Write([]byte(`{"error":{"type":"error","message":"upstream says no"}}`))
+			})
+
+			_, err := client.ChatCompletion(context.Background(), &models.OpenAIRequest{
+				Model:    "model",
+				Messages: []models.OpenAIMessage{{Role: "user", Content: "hi"}},
+			})
+
+			var apiErr *APIError
+			if !errors.Is(err, tc.kind) || !errors.As(err, &apiErr) {
+				t.Errorf("%s %d: err = %v, want %v", provider, tc.status, err, tc.kind)
+				continue
+			}
+			if apiErr.StatusCode != tc.status || apiErr.Message != "upstream says no" {
+				t.Errorf("%s %d: status = %d, message = %q", provider, tc.status, apiErr.StatusCode, apiErr.Message)
+			}
+			if attempts.Load() != tc.attempts {
+				t.Errorf("%s %d: %d attempts, want %d", provider, tc.status, attempts.Load(), tc.attempts)
+			}
+		}
+	}
+}
+
+func TestErrorInSuccessfulResponse(t *testing.T) {
+	client := newTestClient(t, config.ProviderOpenAI, 0, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error":{"type":"invalid_request_error","message":"bad model"}}`))
+	})
+
+	_, err := client.ChatCompletion(context.Background(), &models.OpenAIRequest{Model: "model"})
+	if !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("err = %v, want ErrBadRequest", err)
+	}
+}
+
+func TestShortEmbeddingResponse(t *testing.T) {
+	openai := newTestClient(t, config.ProviderOpenAI, -1, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}]}`))
+	})
+	bedrock := newTestClient(t, config.ProviderBedrock, -1, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"inputTextTokenCount":3}`))
+	})
+
+	for name, client := range map[string]*Client{"openai": openai, "bedrock": bedrock} {
+		_, err := client.Embeddings(context.Background(), &models.EmbeddingRequest{Model: "model", Input: []string{"手机", "耳机"}})
+		if !errors.Is(err, ErrUpstream) {
+			t.Errorf("%s: err = %v, want ErrUpstream", name, err)
+		}
+	}
+}
+
+func TestRetryAfterIsClampedToMaxBackoff(t *testing.T) {
+	var attempts atomic.Int32
+	client := newTestClient(t, config.ProviderOpenAI, 1, func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	})
+
+	start := time.Now()
+	response, err := client.ChatCompletion(context.Background(), &models.OpenAIRequest{Model: "model"})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("waited %v, Retry-After should be clamped to MaxBackoff", elapsed)
+	}
+	if response.Choices[0].Message.Content != "ok" || attempts.Load() != 2 {
+		t.Fatalf("content = %q, attempts = %d", response.Choices[0].Message.Content, attempts.Load())
+	}
+}
+
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	var attempts atomic.Int32
+	client := newTestClient(t, config.ProviderOpenAI, 5, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	client.opts.MaxBackoff = time.Second
+	client.opts.InitialBackoff = time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err := client.ChatCompletion(ctx, &models.OpenAIRequest{Model: "model"})
+	if !errors.Is(err, ErrUpstream) {
+		t.Fatalf("err = %v, want ErrUpstream without waiting past the deadline", err)
+	}
+	if attempts.Load() != 1 {
+		t.Fatalf("%d attempts, want 1", attempts.Load())
+	}
+}
+
+func TestOptionsFromConfigMaxRetries(t *testing.T) {
+	previous := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = previous })
+
+	zero, two := 0, 2
+	cases := []struct {
+		name       string
+		configured *int
+		want       int
+	}{
+		{"unset", nil, defaultMaxRetries},
+		{"disabled", &zero, 0},
+		{"explicit", &two, 2},
+	}
+	for _, tc := range cases {
+		config.AppConfig = &config.Config{LLM: config.LLMConfig{MaxRetries: tc.configured}}
+		client := New(OptionsFromConfig(config.ProviderOpenAI))
+		if client.opts.MaxRetries != tc.want {
+			t.Errorf("%s: MaxRetries = %d, want %d", tc.name, client.opts.MaxRetries, tc.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 错误类型，使用 errors.Is 判断
+var (
+	// ErrRateLimited 触发上游限流（429），可以重试
+	ErrRateLimited = errors.New("llm rate limited")
+	// ErrAuth API Key 无效或无权限（401 / 403），不重试
+	ErrAuth = errors.New("llm authentication failed")
+	// ErrBadRequest 请求本身有误（其他 4xx），不重试
+	ErrBadRequest = errors.New("llm bad request")
+	// ErrUpstream 网关或模型服务故障（5xx、超时、连接失败、无法解析的响应），可以重试
+	ErrUpstream = errors.New("llm upstream failure")
+)
+
+// APIError LLM 调用错误
+type APIError struct {
+	Kind       error         // ErrRateLimited / ErrAuth / ErrBadRequest / ErrUpstream
+	StatusCode int           // HTTP 状态码，连接失败时为 0
+	Message    string        // 上游返回的错误信息
+	RetryAfter time.Duration // 上游要求的等待时间（Retry-After）
+	Attempts   int           // 已尝试次数
+}
+
+// Error 实现 error 接口
+func (e *APIError) Error() string {
+	message := e.Kind.Error()
+	if e.StatusCode != 0 {
+		message += fmt.Sprintf(": status %d", e.StatusCode)
+	}
+	if e.Message != "" {
+		message += ": " + e.Message
+	}
+	if e.Attempts > 1 {
+		message += fmt.Sprintf(" (after %d attempts)", e.Attempts)
+	}
+	return message
+}
+
+// Unwrap 返回错误类型，支持 errors.Is(err, llm.ErrRateLimited)
+func (e *APIError) Unwrap() error {
+	return e.Kind
+}
+
+// Retryable 是否可以重试
+func (e *APIError) Retryable() bool {
+	return e.Kind == ErrRateLimited || e.Kind == ErrUpstream
+}
+
+// errorBody 错误响应体：OpenAI 和 Anthropic 使用 error.message，Bedrock 使用顶层的 message
+type errorBody struct {
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    any    `json:"code"`
+	} `json:"error"`
+	Message string `json:"message"`
+}
+
+// newStatusError 根据 HTTP 状态码和响应体构建错误
+func newStatusError(status int, body []byte, header http.Header) *APIError {
+	return &APIError{
+		Kind:       kindForStatus(status),
+		StatusCode: status,
+		Message:    errorMessage(body),
+		RetryAfter: parseRetryAfter(header, time.Now()),
+	}
+}
+
+// kindForStatus HTTP 状态码对应的错误类型
+func kindForStatus(status int) error {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrAuth
+	case status == http.StatusRequestTimeout || status >= 500:
+		return ErrUpstream
+	default:
+		return ErrBadRequest
+	}
+}
+
+// kindForErrorType 状态码为 200 但响应体带有错误时，按错误类型和错误码分类
+func kindForErrorType(errorType, code string) error {
+	value := strings.ToLower(errorType + " " + code)
+	switch {
+	case strings.Contains(value, "rate_limit") || strings.Contains(value, "quota"):
+		return ErrRateLimited
+	case strings.Contains(value, "auth") || strings.Contains(value, "api_key") || strings.Contains(value, "permission"):
+		return ErrAuth
+	case strings.Contains(value, "invalid_request"):
+		return ErrBadRequest
+	default:
+		return ErrUpstream
+	}
+}
+
+// errorMessage 提取错误响应中的信息，无法解析时返回截断的原文
+func errorMessage(body []byte) string {
+	var parsed errorBody
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Error != nil && parsed.Error.Message != "" {
+		return parsed.Error.Message
+	}
+	if parsed.Message != "" {
+		return parsed.Message
+	}
+	message := strings.TrimSpace(string(body))
+	if len(message) > 512 {
+		message = message[:512] + "..."
+	}
+	return message
+}
+
+// parseRetryAfter 解析 Retry-After（秒数或 HTTP 日期），兼容 OpenAI 的 retry-after-ms
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if value := header.Get("Retry-After-Ms"); value != "" {
+		if ms, err := strconv.ParseFloat(value, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package llm
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"search-ec2/internal/models"
+	"strings"
+	"unicode"
+)
+
+// hashProvider 进程内的确定性向量化：按词和相邻汉字做特征哈希，不调用任何外部服务
+// 相同文本总是得到相同向量，共享词语越多的文本越相似，但没有真正的语义能力，只用于测试和离线开发
+type hashProvider struct{}
+
+// setHeaders 不发送请求
+func (hashProvider) setHeaders(http.Header, string) {}
+
+// chat 不支持对话
+func (hashProvider) chat(context.Context, *Client, *models.OpenAIRequest) (*models.OpenAIResponse, error) {
+	return nil, &APIError{Kind: ErrBadRequest, Message: "hash provider does not support chat"}
+}
+
+// embeddings 在本地计算向量
+func (hashProvider) embeddings(ctx context.Context, c *Client, request *models.EmbeddingRequest) (*models.EmbeddingResponse, error) {
+	if c.opts.Dimensions <= 0 {
+		return nil, &APIError{Kind: ErrBadRequest, Message: "hash provider requires dimensions"}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	response := &models.EmbeddingResponse{Object: "list", Model: request.Model}
+	for i, text := range request.Input {
+		response.Data = append(response.Data, models.EmbeddingData{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: HashEmbedding(text, c.opts.Dimensions),
+		})
+	}
+	return response, nil
+}
+
+// HashEmbedding 计算文本的确定性哈希向量（L2 归一化）
+// 英文和数字按词切分，汉字等按单字和相邻两字切分，每个特征哈希到一个维度并带正负号
+func HashEmbedding(text string, dimensions int) []float32 {
+	vector := make([]float32, dimensions)
+	features := hashFeatures(strings.ToLower(text))
+	if len(features) == 0 {
+		features = []string{""}
+	}
+
+	for _, feature := range features {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		index := int(sum % uint64(dimensions))
+		if sum&(1<<63) != 0 {
+			vector[index]--
+		} else {
+			vector[index]++
+		}
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		// 所有特征正负抵消时退化为固定方向，避免零向量
+		vector[0] = 1
+		return vector
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vector {
+		vector[i] *= scale
+	}
+	return vector
+}
+
+// hashFeatures 切分文本特征
+// 与关键词检索的切词（services/sparse.go 的 tokenize）刻意分开：后者决定已写入索引的稀疏向量，
+// 修改就需要重建索引；这里的特征只影响测试用的假向量，可以随时调整而不牵连线上索引
+func hashFeatures(text string) []string {
+	var features []string
+	var word []rune
+	var prev rune
+
+	flush := func() {
+		if len(word) > 0 {
+			features = append(features, string(word))
+			word = word[:0]
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			word = append(word, r)
+			prev = 0
+		case unicode.IsLetter(r):
+			flush()
+			features = append(features, string(r))
+			if prev != 0 {
+				features = append(features, string([]rune{prev, r}))
+			}
+			prev = r
+		default:
+			flush()
+			prev = 0
+		}
+	}
+	flush()
+	return features
+}
@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"search-ec2/internal/config"
+	"search-ec2/internal/models"
+	"testing"
+)
+
+func TestHashFeatures(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"sony wh-1000xm5", []string{"sony", "wh", "1000xm5"}},
+		{"红色连衣裙", []string{"红", "色", "红色", "连", "色连", "衣", "连衣", "裙", "衣裙"}},
+		{"iphone 15 pro 黑色", []string{"iphone", "15", "pro", "黑", "色", "黑色"}},
+		{"耐克air", []string{"耐", "克", "耐克", "air"}},
+		{"café, 5g!", []string{"caf", "é", "5g"}},
+	}
+	for _, tc := range cases {
+		if got := hashFeatures(tc.text); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("hashFeatures(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
+
+// cosine 两个向量的余弦相似度
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+func TestHashEmbedding(t *testing.T) {
+	const dimensions = 256
+	a := HashEmbedding("Sony WH-1000XM5 降噪耳机", dimensions)
+	if len(a) != dimensions {
+		t.Fatalf("len = %d, want %d", len(a), dimensions)
+	}
+	if !reflect.DeepEqual(a, HashEmbedding("sony wh-1000xm5 降噪耳机", dimensions)) {
+		t.Errorf("embedding should be deterministic and case insensitive")
+	}
+
+	var norm float64
+	for _, v := range a {
+		norm += float64(v) * float64(v)
+	}
+	if math.Abs(norm-1) > 1e-5 {
+		t.Errorf("norm = %v, want 1", norm)
+	}
+
+	// 共享型号和词语的文本比无关文本更相似
+	related := HashEmbedding("WH-1000XM5 耳机", dimensions)
+	unrelated := HashEmbedding("红色连衣裙", dimensions)
+	if cosine(a, related) <= cosine(a, unrelated) {
+		t.Errorf("related %v should be closer than unrelated %v", cosine(a, related), cosine(a, unrelated))
+	}
+
+	// 没有任何特征的文本也返回单位向量
+	empty := HashEmbedding("!!!", dimensions)
+	if math.Abs(cosine(empty, empty)-1) > 1e-6 {
+		t.Errorf("empty text embedding = %v", empty)
+	}
+}
+
+func TestHashProviderEmbeddings(t *testing.T) {
+	client := New(Options{Provider: config.ProviderHash, Dimensions: 32})
+	response, err := client.Embeddings(context.Background(), &models.EmbeddingRequest{Model: "hash", Input: []string{"手机", "耳机"}})
+	if err != nil {
+		t.Fatalf("Embeddings: %v", err)
+	}
+	if len(response.Data) != 2 || response.Data[1].Index != 1 || !reflect.DeepEqual(response.Data[1].Embedding, HashEmbedding("耳机", 32)) {
+		t.Fatalf("response = %+v", response)
+	}
+
+	_, err = New(Options{Provider: config.ProviderHash}).Embeddings(context.Background(), &models.EmbeddingRequest{Input: []string{"手机"}})
+	if !errors.Is(err, ErrBadRequest) {
+		t.Errorf("missing dimensions: err = %v, want ErrBadRequest", err)
+	}
+}
@@ -0,0 +1,133 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter 令牌桶限流器，同时限制每分钟请求数和 token 数
+// token 按请求前的估算值预扣，拿到响应后按实际用量校正（Adjust），额度可以暂时为负
+type Limiter struct {
+	mu          sync.Mutex
+	requests    *bucket // nil 表示不限制
+	tokens      *bucket // nil 表示不限制
+	pausedUntil time.Time
+}
+
+// bucket 令牌桶
+type bucket struct {
+	capacity  float64
+	available float64
+	rate      float64 // 每秒补充的令牌数
+	last      time.Time
+}
+
+// NewLimiter 创建限流器，参数为 0 时不限制对应维度
+func NewLimiter(requestsPerMinute, tokensPerMinute int) *Limiter {
+	return &Limiter{
+		requests: newBucket(requestsPerMinute),
+		tokens:   newBucket(tokensPerMinute),
+	}
+}
+
+// newBucket 创建每分钟补满的令牌桶，初始为满
+func newBucket(perMinute int) *bucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &bucket{
+		capacity:  float64(perMinute),
+		available: float64(perMinute),
+		rate:      float64(perMinute) / 60,
+		last:      time.Now(),
+	}
+}
+
+// refill 按经过的时间补充令牌
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.available = min(b.capacity, b.available+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// wait 获取 n 个令牌还需等待的时间
+func (b *bucket) wait(n float64) time.Duration {
+	if b.available >= n {
+		return 0
+	}
+	return time.Duration((n - b.available) / b.rate * float64(time.Second))
+}
+
+// Wait 等待请求数和 token 额度都足够后扣减；ctx 结束时返回 ctx.Err()
+// 单次请求的 token 数超过每分钟上限时按上限计，避免永远等待
+func (l *Limiter) Wait(ctx context.Context, tokens int) error {
+	for {
+		delay := l.reserve(time.Now(), tokens)
+		if delay <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve 额度足够时扣减并返回 0，否则返回需要等待的时间
+func (l *Limiter) reserve(now time.Time, tokens int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+
+	var delay time.Duration
+	if l.requests != nil {
+		l.requests.refill(now)
+		delay = max(delay, l.requests.wait(1))
+	}
+	need := float64(tokens)
+	if l.tokens != nil {
+		l.tokens.refill(now)
+		need = min(need, l.tokens.capacity)
+		delay = max(delay, l.tokens.wait(need))
+	}
+	if delay > 0 {
+		return delay
+	}
+
+	if l.requests != nil {
+		l.requests.available--
+	}
+	if l.tokens != nil {
+		l.tokens.available -= need
+	}
+	return 0
+}
+
+// Adjust 按实际用量校正 token 额度，delta 为实际用量减去预扣值（可以为负，即退还）
+func (l *Limiter) Adjust(delta int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.tokens != nil {
+		l.tokens.available = min(l.tokens.capacity, l.tokens.available-float64(delta))
+	}
+}
+
+// Pause 上游返回限流时暂停所有请求一段时间，避免并发的请求继续撞上限流
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
@@ -0,0 +1,62 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"search-ec2/internal/models"
+)
+
+// openAIProvider OpenAI 兼容协议（/chat/completions、/embeddings），请求和响应无需转换
+type openAIProvider struct{}
+
+// setHeaders Bearer 鉴权
+func (openAIProvider) setHeaders(header http.Header, apiKey string) {
+	header.Set("Authorization", "Bearer "+apiKey)
+}
+
+// chat 调用 /chat/completions
+func (openAIProvider) chat(ctx context.Context, c *Client, request *models.OpenAIRequest) (*models.OpenAIResponse, error) {
+	var response models.OpenAIResponse
+	err := c.post(ctx, "/chat/completions", request, estimateChatTokens(request), func(body []byte) (int, error) {
+		response = models.OpenAIResponse{}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return 0, invalidResponse(err)
+		}
+		if response.Error != nil {
+			return 0, bodyError(response.Error)
+		}
+		return response.Usage.TotalTokens, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// embeddings 调用 /embeddings
+func (openAIProvider) embeddings(ctx context.Context, c *Client, request *models.EmbeddingRequest) (*models.EmbeddingResponse, error) {
+	estimate := 0
+	for _, text := range request.Input {
+		estimate += estimateTokens(text)
+	}
+
+	var response models.EmbeddingResponse
+	err := c.post(ctx, "/embeddings", request, estimate, func(body []byte) (int, error) {
+		response = models.EmbeddingResponse{}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return 0, invalidResponse(err)
+		}
+		if response.Error != nil {
+			return 0, bodyError(response.Error)
+		}
+		return response.Usage.TotalTokens, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Data) != len(request.Input) {
+		return nil, &APIError{Kind: ErrUpstream, StatusCode: http.StatusOK, Message: "embedding count does not match input count"}
+	}
+	return &response, nil
+}
@@ -0,0 +1,36 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"search-ec2/internal/config"
+	"search-ec2/internal/models"
+)
+
+// provider 协议适配器：把 OpenAI 格式的请求转换为具体服务的请求，再把响应转换回 OpenAI 格式
+// 发送、重试和限流统一由 Client.post 完成
+type provider interface {
+	// setHeaders 设置鉴权等协议相关的请求头
+	setHeaders(header http.Header, apiKey string)
+	// chat 发送对话请求
+	chat(ctx context.Context, c *Client, request *models.OpenAIRequest) (*models.OpenAIResponse, error)
+	// embeddings 发送向量化请求
+	embeddings(ctx context.Context, c *Client, request *models.EmbeddingRequest) (*models.EmbeddingResponse, error)
+}
+
+// newProvider 按名称创建协议适配器，未知名称返回 nil
+func newProvider(name string) provider {
+	switch name {
+	case config.ProviderOpenAI:
+		return openAIProvider{}
+	case config.ProviderAnthropic:
+		return anthropicProvider{}
+	case config.ProviderBedrock:
+		return bedrockProvider{}
+	case config.ProviderTEI:
+		return teiProvider{}
+	case config.ProviderHash:
+		return hashProvider{}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"search-ec2/internal/config"
+	"search-ec2/internal/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Target 模型链中的一个模型
+type Target struct {
+	Client      *Client
+	Provider    string
+	Model       string   // 为空时使用请求中的模型
+	Temperature *float64 // 为空时使用请求中的温度
+	MaxTokens   int      // 0 使用请求中的值
+	Timeout     time.Duration
+}
+
+// Route 单个任务的模型路由，主模型失败后按顺序尝试备用模型
+type Route struct {
+	Task    string
+	Targets []Target
+}
+
+// NewRoute 按应用配置（models.<task>）创建任务的模型路由
+func NewRoute(task string) *Route {
+	route := &Route{Task: task}
+	for _, model := range config.AppConfig.ModelRoute(task) {
+		route.Targets = append(route.Targets, Target{
+			Client:      ForProvider(model.Provider),
+			Provider:    model.Provider,
+			Model:       model.Model,
+			Temperature: model.Temperature,
+			MaxTokens:   model.MaxTokens,
+			Timeout:     time.Duration(model.Timeout) * time.Second,
+		})
+	}
+	return route
+}
+
+// Model 主模型名称
+func (r *Route) Model() string {
+	if len(r.Targets) == 0 {
+		return ""
+	}
+	return r.Targets[0].Model
+}
+
+// ChatCompletion 依次使用模型链中的模型发送对话请求，返回第一个成功的响应
+// request 中的模型、温度和 max_tokens 会被目标模型的配置覆盖，调用方的请求不会被修改
+func (r *Route) ChatCompletion(ctx context.Context, request *models.OpenAIRequest) (*models.OpenAIResponse, error) {
+	var response *models.OpenAIResponse
+	err := r.Each(ctx, func(ctx context.Context, target Target) error {
+		var err error
+		response, err = target.ChatCompletion(ctx, request)
+		return err
+	})
+	return response, err
+}
+
+// ChatCompletion 使用单个模型发送对话请求，模型、温度和 max_tokens 按目标配置覆盖
+func (t Target) ChatCompletion(ctx context.Context, request *models.OpenAIRequest) (*models.OpenAIResponse, error) {
+	attempt := *request
+	if t.Model != "" {
+		attempt.Model = t.Model
+	}
+	if t.Temperature != nil {
+		attempt.Temperature = *t.Temperature
+	}
+	if t.MaxTokens > 0 {
+		attempt.MaxTokens = t.MaxTokens
+	}
+	return t.Client.ChatCompletion(ctx, &attempt)
+}
+
+// Embeddings 依次使用模型链中的协议发送向量化请求（向量化的备用项只更换协议，模型不变）
+func (r *Route) Embeddings(ctx context.Context, request *models.EmbeddingRequest) (*models.EmbeddingResponse, error) {
+	var response *models.EmbeddingResponse
+	err := r.Each(ctx, func(ctx context.Context, target Target) error {
+		var err error
+		response, err = target.Client.Embeddings(ctx, request)
+		return err
+	})
+	return response, err
+}
+
+// Each 依次调用模型链中的模型直到成功；调用方的 ctx 结束时不再尝试备用模型
+// 每个模型的 Timeout 限制该模型包含重试在内的总时长
+func (r *Route) Each(ctx context.Context, call func(context.Context, Target) error) error {
+	if len(r.Targets) == 0 {
+		return &APIError{Kind: ErrBadRequest, Message: fmt.Sprintf("no model configured for task %s", r.Task)}
+	}
+
+	var lastErr error
+	for i, target := range r.Targets {
+		err := r.call(ctx, target, call)
+		if err == nil {
+			if i > 0 {
+				logrus.Infof("Task %s served by fallback model %s/%s", r.Task, target.Provider, target.Model)
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+
+		lastErr = err
+		if i < len(r.Targets)-1 {
+			logrus.Warnf("Task %s failed with %s/%s, trying fallback: %v", r.Task, target.Provider, target.Model, err)
+		}
+	}
+	return lastErr
+}
+
+// call 调用单个模型，Timeout 限制包含重试在内的总时长
+func (r *Route) call(ctx context.Context, target Target, call func(context.Context, Target) error) error {
+	if target.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, target.Timeout)
+		defer cancel()
+	}
+	return call(ctx, target)
+}
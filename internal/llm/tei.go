@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"search-ec2/internal/models"
+)
+
+// teiProvider Text Embeddings Inference 兼容的本地向量化服务（POST /embed）
+// 模型由服务启动参数决定，请求中的模型名被忽略；api_key 为空时不发送鉴权头
+type teiProvider struct{}
+
+// teiEmbedRequest /embed 请求
+type teiEmbedRequest struct {
+	Inputs   []string `json:"inputs"`
+	Truncate bool     `json:"truncate"` // 超过模型最大长度时截断而不是报错
+}
+
+// setHeaders 可选的 Bearer 鉴权
+func (teiProvider) setHeaders(header http.Header, apiKey string) {
+	if apiKey != "" {
+		header.Set("Authorization", "Bearer "+apiKey)
+	}
+}
+
+// chat 不支持对话
+func (teiProvider) chat(context.Context, *Client, *models.OpenAIRequest) (*models.OpenAIResponse, error) {
+	return nil, &APIError{Kind: ErrBadRequest, Message: "tei provider does not support chat"}
+}
+
+// embeddings 调用 /embed，响应为按输入顺序排列的向量数组
+func (teiProvider) embeddings(ctx context.Context, c *Client, request *models.EmbeddingRequest) (*models.EmbeddingResponse, error) {
+	estimate := 0
+	for _, text := range request.Input {
+		estimate += estimateTokens(text)
+	}
+
+	var vectors [][]float32
+	err := c.post(ctx, "/embed", teiEmbedRequest{Inputs: request.Input, Truncate: true}, estimate, func(body []byte) (int, error) {
+		vectors = nil
+		if err := json.Unmarshal(body, &vectors); err != nil {
+			return 0, invalidResponse(err)
+		}
+		return 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(request.Input) {
+		return nil, &APIError{Kind: ErrUpstream, StatusCode: http.StatusOK, Message: "embedding count does not match input count"}
+	}
+
+	response := &models.EmbeddingResponse{Object: "list", Model: request.Model}
+	for i, vector := range vectors {
+		response.Data = append(response.Data, models.EmbeddingData{Object: "embedding", Index: i, Embedding: vector})
+	}
+	return response, nil
+}
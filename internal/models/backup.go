@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// RestoreResult 从导出文件恢复商品的结果
+type RestoreResult struct {
+	Restored int                `json:"restored"`
+	Failed   int                `json:"failed"`
+	Errors   []BatchImportError `json:"errors,omitempty"` // 只保留前若干条错误
+}
+
+// SnapshotInfo Qdrant 集合快照
+type SnapshotInfo struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+	Checksum  string    `json:"checksum,omitempty"` // SHA256
+}
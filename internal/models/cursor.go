@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// EncodeCursor 将分页状态编码为不透明的游标字符串
+func EncodeCursor(state interface{}) (string, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor 解析游标字符串到分页状态
+func DecodeCursor(cursor string, state interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return fmt.Errorf("malformed cursor")
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return fmt.Errorf("malformed cursor")
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	state := SearchCursor{
+		Offset:      40,
+		Fingerprint: "0123456789abcdef",
+		ParsedQuery: &ParsedQuery{ProductType: "牛仔裤", PriceMax: floatPtr(300)},
+	}
+
+	cursor, err := EncodeCursor(state)
+	if err != nil {
+		t.Fatalf("EncodeCursor: %v", err)
+	}
+	if strings.ContainsAny(cursor, "+/=") {
+		t.Errorf("cursor %q is not URL safe", cursor)
+	}
+
+	var decoded SearchCursor
+	if err := DecodeCursor(cursor, &decoded); err != nil {
+		t.Fatalf("DecodeCursor: %v", err)
+	}
+	if decoded.Offset != 40 || decoded.Fingerprint != state.Fingerprint ||
+		decoded.ParsedQuery == nil || decoded.ParsedQuery.ProductType != "牛仔裤" || *decoded.ParsedQuery.PriceMax != 300 {
+		t.Fatalf("decoded = %+v", decoded)
+	}
+}
+
+func TestDecodeCursorRejectsMalformed(t *testing.T) {
+	notJSON, _ := EncodeCursor("plain string")
+	for _, cursor := range []string{"***", "bm90IGpzb24", notJSON} {
+		var state SearchCursor
+		if err := DecodeCursor(cursor, &state); err == nil || err.Error() != "malformed cursor" {
+			t.Errorf("DecodeCursor(%q) = %v, want malformed cursor", cursor, err)
+		}
+	}
+}
+
+func TestSearchRequestFingerprint(t *testing.T) {
+	base := SearchRequest{Query: "红色连衣裙"}
+	fingerprint := base.Fingerprint()
+
+	// 分页参数不影响指纹
+	paged := base
+	paged.Offset, paged.Limit = 20, 10
+	if paged.Fingerprint() != fingerprint {
+		t.Errorf("offset and limit should not change the fingerprint")
+	}
+
+	threshold := 0.5
+	variants := []SearchRequest{
+		{Query: "蓝色连衣裙"},
+		{Query: base.Query, SimilarityThreshold: &threshold},
+		{Query: base.Query, IncludeInactive: true},
+		{Query: base.Query, Filter: &Filter{Must: []Condition{NewMatchCondition("brand", "Nike")}}},
+		{Query: base.Query, HybridWeights: &HybridWeights{Dense: 1, Sparse: 0.5}},
+	}
+	for i, req := range variants {
+		if req.Fingerprint() == fingerprint {
+			t.Errorf("variant %d should change the fingerprint", i)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// maxFilterDepth 嵌套布尔组合的最大深度
+const maxFilterDepth = 5
+
+// Filter 过滤条件 DSL，结构与 Qdrant 的 must/should/must_not 一致
+// 由 Function Calling 解析结果生成，也可以直接出现在搜索请求中
+type Filter struct {
+	Must    []Condition `json:"must,omitempty"`
+	Should  []Condition `json:"should,omitempty"`
+	MustNot []Condition `json:"must_not,omitempty"`
+}
+
+// Condition 单个过滤条件
+// 叶子条件需要 Key 以及 Match / Range / Exists 之一；
+// Filter 非空时表示嵌套布尔组合，若同时指定 Key 则作用于对象数组字段
+type Condition struct {
+	Key    string      `json:"key,omitempty"`
+	Match  *MatchValue `json:"match,omitempty"`
+	Range  *RangeValue `json:"range,omitempty"`
+	Exists *bool       `json:"exists,omitempty"`
+	Filter *Filter     `json:"filter,omitempty"`
+}
+
+// MatchValue 匹配条件，Value / Any / Except 三选一
+type MatchValue struct {
+	Value  interface{}   `json:"value,omitempty"`  // 精确匹配（字符串、整数、布尔）
+	Any    []interface{} `json:"any,omitempty"`    // 匹配任意一个
+	Except []interface{} `json:"except,omitempty"` // 不匹配其中任何一个
+}
+
+// RangeValue 数值范围条件
+type RangeValue struct {
+	Gt  *float64 `json:"gt,omitempty"`
+	Gte *float64 `json:"gte,omitempty"`
+	Lt  *float64 `json:"lt,omitempty"`
+	Lte *float64 `json:"lte,omitempty"`
+}
+
+// NewMatchCondition 创建精确匹配条件
+func NewMatchCondition(key string, value interface{}) Condition {
+	return Condition{Key: key, Match: &MatchValue{Value: value}}
+}
+
+// NewMatchAnyCondition 创建任意匹配条件
+func NewMatchAnyCondition(key string, values ...interface{}) Condition {
+	return Condition{Key: key, Match: &MatchValue{Any: values}}
+}
+
+// NewRangeCondition 创建闭区间范围条件，nil 表示该侧不限
+func NewRangeCondition(key string, gte, lte *float64) Condition {
+	return Condition{Key: key, Range: &RangeValue{Gte: gte, Lte: lte}}
+}
+
+// NewExistsCondition 创建字段存在性条件
+func NewExistsCondition(key string, exists bool) Condition {
+	return Condition{Key: key, Exists: &exists}
+}
+
+// NewGroupCondition 创建嵌套布尔组合条件
+func NewGroupCondition(filter *Filter) Condition {
+	return Condition{Filter: filter}
+}
+
+// IsEmpty 判断过滤条件是否为空
+func (f *Filter) IsEmpty() bool {
+	return f == nil || (len(f.Must) == 0 && len(f.Should) == 0 && len(f.MustNot) == 0)
+}
+
+// And 以 AND 语义合并两个过滤条件
+// 至多一侧带 should 时直接拼接各组，不增加嵌套深度；
+// 两侧都带 should 时分别作为嵌套组合放入 must，避免 should 语义被改变
+func (f *Filter) And(other *Filter) *Filter {
+	if f.IsEmpty() {
+		return other
+	}
+	if other.IsEmpty() {
+		return f
+	}
+	if len(f.Should) > 0 && len(other.Should) > 0 {
+		return &Filter{
+			Must: []Condition{NewGroupCondition(f), NewGroupCondition(other)},
+		}
+	}
+	return &Filter{
+		Must:    append(append([]Condition{}, f.Must...), other.Must...),
+		Should:  append(append([]Condition{}, f.Should...), other.Should...),
+		MustNot: append(append([]Condition{}, f.MustNot...), other.MustNot...),
+	}
+}
+
+// Keys 返回过滤条件中涉及的所有字段（去重，按出现顺序）
+func (f *Filter) Keys() []string {
+	seen := make(map[string]bool)
+	keys := make([]string, 0)
+
+	var walk func(filter *Filter)
+	walk = func(filter *Filter) {
+		if filter == nil {
+			return
+		}
+		for _, group := range [][]Condition{filter.Must, filter.Should, filter.MustNot} {
+			for _, cond := range group {
+				if cond.Key != "" && !seen[cond.Key] {
+					seen[cond.Key] = true
+					keys = append(keys, cond.Key)
+				}
+				walk(cond.Filter)
+			}
+		}
+	}
+	walk(f)
+
+	return keys
+}
+
+// Validate 校验过滤条件结构
+func (f *Filter) Validate() error {
+	return f.validate(1)
+}
+
+// validate 按深度递归校验
+func (f *Filter) validate(depth int) error {
+	if f == nil {
+		return nil
+	}
+	if depth > maxFilterDepth {
+		return fmt.Errorf("filter nesting exceeds max depth %d", maxFilterDepth)
+	}
+
+	names := []string{"must", "should", "must_not"}
+	for g, group := range [][]Condition{f.Must, f.Should, f.MustNot} {
+		for i, cond := range group {
+			if err := cond.validate(depth); err != nil {
+				return fmt.Errorf("%s[%d]: %w", names[g], i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validate 校验单个条件
+func (c *Condition) validate(depth int) error {
+	if c.Filter != nil {
+		if c.Match != nil || c.Range != nil || c.Exists != nil {
+			return fmt.Errorf("group condition cannot combine filter with match/range/exists")
+		}
+		if c.Filter.IsEmpty() {
+			return fmt.Errorf("group condition has empty filter")
+		}
+		return c.Filter.validate(depth + 1)
+	}
+
+	if c.Key == "" {
+		return fmt.Errorf("key is required")
+	}
+
+	kinds := 0
+	if c.Match != nil {
+		kinds++
+	}
+	if c.Range != nil {
+		kinds++
+	}
+	if c.Exists != nil {
+		kinds++
+	}
+	if kinds != 1 {
+		return fmt.Errorf("condition on %q must have exactly one of match, range, exists", c.Key)
+	}
+
+	if c.Match != nil {
+		if err := c.Match.validate(); err != nil {
+			return fmt.Errorf("condition on %q: %w", c.Key, err)
+		}
+	}
+
+	if c.Range != nil {
+		r := c.Range
+		if r.Gt == nil && r.Gte == nil && r.Lt == nil && r.Lte == nil {
+			return fmt.Errorf("range on %q needs at least one bound", c.Key)
+		}
+	}
+
+	return nil
+}
+
+// validate 校验匹配条件
+func (m *MatchValue) validate() error {
+	kinds := 0
+	if m.Value != nil {
+		kinds++
+	}
+	if len(m.Any) > 0 {
+		kinds++
+	}
+	if len(m.Except) > 0 {
+		kinds++
+	}
+	if kinds != 1 {
+		return fmt.Errorf("match must have exactly one of value, any, except")
+	}
+
+	if m.Value != nil {
+		return validateMatchScalar(m.Value)
+	}
+	for _, v := range append(append([]interface{}{}, m.Any...), m.Except...) {
+		if _, isBool := v.(bool); isBool {
+			return fmt.Errorf("any/except only support strings or integers")
+		}
+		if err := validateMatchScalar(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateMatchScalar 校验匹配值类型：字符串、布尔或整数
+func validateMatchScalar(value interface{}) error {
+	switch v := value.(type) {
+	case string, bool, int, int32, int64:
+		return nil
+	case float64:
+		if v != math.Trunc(v) {
+			return fmt.Errorf("cannot match on fractional number %v, use range instead", v)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported match value type %T", value)
+	}
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestFilterValidate(t *testing.T) {
+	nested := &Filter{Must: []Condition{NewMatchCondition("color", "红色")}}
+	for i := 0; i < maxFilterDepth; i++ {
+		nested = &Filter{Must: []Condition{NewGroupCondition(nested)}}
+	}
+
+	cases := []struct {
+		name    string
+		filter  *Filter
+		wantErr string
+	}{
+		{"nil", nil, ""},
+		{"keyword", &Filter{Must: []Condition{NewMatchCondition("brand", "Nike")}}, ""},
+		{"integer from JSON", &Filter{Must: []Condition{NewMatchCondition("attributes.storage_gb", float64(256))}}, ""},
+		{"range", &Filter{Must: []Condition{NewRangeCondition("price", floatPtr(100), nil)}}, ""},
+		{"exists", &Filter{MustNot: []Condition{NewExistsCondition("image_urls", true)}}, ""},
+		{"any", &Filter{Should: []Condition{NewMatchAnyCondition("color", "红色", "黑色")}}, ""},
+		{"missing key", &Filter{Must: []Condition{{Match: &MatchValue{Value: "x"}}}}, "key is required"},
+		{"two kinds", &Filter{Must: []Condition{{Key: "price", Match: &MatchValue{Value: "x"}, Range: &RangeValue{Gte: floatPtr(1)}}}}, "exactly one of match, range, exists"},
+		{"empty range", &Filter{Must: []Condition{{Key: "price", Range: &RangeValue{}}}}, "at least one bound"},
+		{"fractional match", &Filter{Must: []Condition{NewMatchCondition("price", 9.9)}}, "use range instead"},
+		{"bool in any", &Filter{Must: []Condition{NewMatchAnyCondition("waterproof", true, false)}}, "strings or integers"},
+		{"value and any", &Filter{Must: []Condition{{Key: "color", Match: &MatchValue{Value: "红色", Any: []interface{}{"黑色"}}}}}, "exactly one of value, any, except"},
+		{"empty group", &Filter{Must: []Condition{NewGroupCondition(&Filter{})}}, "empty filter"},
+		{"too deep", nested, "max depth"},
+	}
+
+	for _, tc := range cases {
+		err := tc.filter.Validate()
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%s: error = %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestFilterValidateReportsPath(t *testing.T) {
+	filter := &Filter{
+		Must:    []Condition{NewMatchCondition("brand", "Nike")},
+		MustNot: []Condition{NewMatchCondition("brand", "Nike"), {Key: "price"}},
+	}
+	err := filter.Validate()
+	if err == nil || !strings.HasPrefix(err.Error(), "must_not[1]:") {
+		t.Fatalf("error = %v, want must_not[1] prefix", err)
+	}
+}
+
+func TestFilterAnd(t *testing.T) {
+	a := &Filter{Must: []Condition{NewMatchCondition("brand", "Nike")}}
+	b := &Filter{MustNot: []Condition{NewMatchCondition("status", "deleted")}}
+
+	if got := (*Filter)(nil).And(b); got != b {
+		t.Errorf("nil.And(b) should return b")
+	}
+	if got := a.And(&Filter{}); got != a {
+		t.Errorf("a.And(empty) should return a")
+	}
+
+	merged := a.And(b)
+	if len(merged.Must) != 1 || len(merged.MustNot) != 1 || len(merged.Should) != 0 {
+		t.Fatalf("merged = %+v", merged)
+	}
+	merged.Must[0].Key = "changed"
+	if a.Must[0].Key != "brand" {
+		t.Errorf("And must not alias the operands")
+	}
+
+	// 两侧都带 should 时各自作为嵌套组合，保持 should 的语义
+	x := &Filter{Should: []Condition{NewMatchCondition("color", "红色"), NewMatchCondition("color", "黑色")}}
+	y := &Filter{Should: []Condition{NewMatchCondition("size", "M"), NewMatchCondition("size", "L")}}
+	both := x.And(y)
+	if len(both.Should) != 0 || len(both.Must) != 2 || both.Must[0].Filter != x || both.Must[1].Filter != y {
+		t.Fatalf("x.And(y) = %+v", both)
+	}
+	if err := both.Validate(); err != nil {
+		t.Errorf("combined filter invalid: %v", err)
+	}
+}
+
+func TestFilterKeys(t *testing.T) {
+	filter := &Filter{
+		Must: []Condition{
+			NewMatchCondition("brand", "Nike"),
+			NewGroupCondition(&Filter{Should: []Condition{
+				NewMatchCondition("color", "红色"),
+				NewMatchCondition("brand", "Adidas"),
+			}}),
+		},
+		MustNot: []Condition{NewRangeCondition("price", nil, floatPtr(10))},
+	}
+	want := []string{"brand", "color", "price"}
+	if got := filter.Keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+}
+
+func TestFilterJSON(t *testing.T) {
+	var filter Filter
+	data := `{"must":[{"key":"brand","match":{"any":["Nike","Adidas"]}},{"key":"price","range":{"gte":100,"lt":500}}],
+		"must_not":[{"key":"status","match":{"value":"deleted"}}]}`
+	if err := json.Unmarshal([]byte(data), &filter); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if err := filter.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if r := filter.Must[1].Range; r == nil || *r.Gte != 100 || *r.Lt != 500 || r.Lte != nil {
+		t.Errorf("range = %+v", r)
+	}
+	if m := filter.Must[0].Match; m == nil || len(m.Any) != 2 {
+		t.Errorf("match = %+v", m)
+	}
+}
+
+func TestParsedQueryToFilter(t *testing.T) {
+	pq := &ParsedQuery{
+		ProductType: "登山鞋",
+		Color:       "黑色",
+		PriceMax:    floatPtr(800),
+		Filters: map[string]interface{}{
+			"waterproof": true,
+			"weight_g":   map[string]interface{}{"lte": float64(500)},
+			"tags":       []interface{}{"户外", "徒步"},
+			"rating":     4.5, // 小数精确匹配不合法，被忽略
+			"model":      "",  // 空字符串被忽略
+			"note":       nil, // null 被忽略
+		},
+	}
+
+	filter := pq.ToFilter()
+	if err := filter.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	// 动态条件按 key 排序追加在基础字段之后
+	got := make([]string, 0, len(filter.Must))
+	for _, cond := range filter.Must {
+		got = append(got, cond.Key)
+	}
+	want := []string{"color", "price", "tags", "attributes.waterproof", "attributes.weight_g"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+}
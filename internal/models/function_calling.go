@@ -6,6 +6,9 @@ type OpenAIRequest struct {
 	Messages    []OpenAIMessage        `json:"messages"`
 	Functions   []OpenAIFunction       `json:"functions,omitempty"`
 	FunctionCall interface{}           `json:"function_call,omitempty"`
+	Tools       []OpenAITool           `json:"tools,omitempty"`
+	ToolChoice  interface{}            `json:"tool_choice,omitempty"`
+	ResponseFormat *OpenAIResponseFormat `json:"response_format,omitempty"`
 	MaxTokens   int                    `json:"max_tokens,omitempty"`
 	Temperature float64                `json:"temperature,omitempty"`
 }
@@ -15,6 +18,7 @@ type OpenAIMessage struct {
 	Role         string                 `json:"role"`
 	Content      string                 `json:"content,omitempty"`
 	FunctionCall *OpenAIFunctionCall    `json:"function_call,omitempty"`
+	ToolCalls    []OpenAIToolCall       `json:"tool_calls,omitempty"`
 }
 
 // OpenAIFunction OpenAI Function 定义
@@ -30,6 +34,33 @@ type OpenAIFunctionCall struct {
 	Arguments string `json:"arguments"`
 }
 
+// OpenAITool OpenAI 工具定义（目前只有 function 类型）
+type OpenAITool struct {
+	Type     string         `json:"type"`
+	Function OpenAIFunction `json:"function"`
+}
+
+// OpenAIToolCall 模型返回的工具调用
+type OpenAIToolCall struct {
+	ID       string             `json:"id,omitempty"`
+	Type     string             `json:"type"`
+	Function OpenAIFunctionCall `json:"function"`
+}
+
+// OpenAIResponseFormat 结构化输出格式
+type OpenAIResponseFormat struct {
+	Type       string            `json:"type"` // json_schema / json_object / text
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+// OpenAIJSONSchema response_format 为 json_schema 时的 schema 定义
+type OpenAIJSONSchema struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Schema      map[string]interface{} `json:"schema"`
+	Strict      bool                   `json:"strict,omitempty"`
+}
+
 // OpenAIResponse OpenAI API 响应结构
 type OpenAIResponse struct {
 	ID      string           `json:"id"`
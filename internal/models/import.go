@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+// 导入任务状态
+const (
+	ImportJobQueued    = "queued"
+	ImportJobRunning   = "running"
+	ImportJobCompleted = "completed"
+	ImportJobCancelled = "cancelled"
+	ImportJobFailed    = "failed" // 任务本身出错（如读取数据文件失败），单个商品失败不影响任务状态
+)
+
+// ImportJob 批量导入任务
+type ImportJob struct {
+	ID         string             `json:"id"`
+	Status     string             `json:"status"`
+	Total      int                `json:"total"`
+	Processed  int                `json:"processed"`
+	Success    int                `json:"success"`
+	Failed     int                `json:"failed"`
+	Unchanged  int                `json:"unchanged"` // 内容未变化、跳过变体生成的商品数（计入 success）
+	Errors     []BatchImportError `json:"errors,omitempty"`
+	Message    string             `json:"message,omitempty"` // 任务失败原因
+	CreatedAt  time.Time          `json:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+	StartedAt  *time.Time         `json:"started_at,omitempty"`
+	FinishedAt *time.Time         `json:"finished_at,omitempty"`
+}
+
+// IsFinished 判断任务是否已结束（不会再自动执行）
+func (j *ImportJob) IsFinished() bool {
+	return j.Status == ImportJobCompleted || j.Status == ImportJobCancelled || j.Status == ImportJobFailed
+}
+
+// ImportItem 导入任务中的单个商品，商品 ID 取自外部 ID 或在入队时分配，重试时保持不变
+type ImportItem struct {
+	ProductID string               `json:"product_id"`
+	Line      int                  `json:"line,omitempty"`  // 在上传文件中的行号
+	Error     string               `json:"error,omitempty"` // 解析失败的原因，不会被处理
+	Product   ProductCreateRequest `json:"product"`
+}
@@ -1,9 +1,70 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 )
 
+// 商品状态
+const (
+	ProductStatusActive   = "active"   // 上架，可被搜索
+	ProductStatusInactive = "inactive" // 下架，不参与搜索
+	ProductStatusDeleted  = "deleted"  // 软删除，可以恢复
+)
+
+// AttributesField 自定义属性在 payload 中的字段名
+// 属性以嵌套对象保存并保留原始类型，过滤时使用 attributes.<key> 路径，例如 attributes.weight_g
+const AttributesField = "attributes"
+
+// productPayloadFields 商品基础字段对应的 payload 字段
+var productPayloadFields = map[string]bool{
+	"product_id": true, "product_name": true, "category": true, "description": true,
+	"price": true, "currency": true, "brand": true, "color": true, "size": true,
+	"material": true, "style": true, "gender": true, "occasion": true, "tags": true,
+	"image_urls": true, "status": true, "content_hash": true, "variant_hash": true,
+	"generation": true, "created_at": true, "updated_at": true,
+}
+
+// AttributeFilterKey 将过滤字段名映射为 payload 路径：基础字段保持不变，其余视为自定义属性
+func AttributeFilterKey(key string) string {
+	if productPayloadFields[key] || strings.HasPrefix(key, AttributesField+".") {
+		return key
+	}
+	return AttributesField + "." + key
+}
+
+// productIDPattern 外部商品 ID 允许的格式（会出现在 URL 路径中）
+var productIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,127}$`)
+
+// IsValidProductID 判断外部商品 ID 是否合法：1-128 个字符，只包含字母、数字和 . _ : -
+func IsValidProductID(id string) bool {
+	return productIDPattern.MatchString(id)
+}
+
+// IsValidProductStatus 判断商品状态是否合法
+func IsValidProductStatus(status string) bool {
+	switch status {
+	case ProductStatusActive, ProductStatusInactive, ProductStatusDeleted:
+		return true
+	}
+	return false
+}
+
+// VisibleStatusFilter 只保留可见商品（排除下架和已删除）的过滤条件
+// 使用 must_not 而不是 status == active，没有写入状态的旧数据仍然可见
+func VisibleStatusFilter() *Filter {
+	return &Filter{
+		MustNot: []Condition{
+			NewMatchAnyCondition("status", ProductStatusInactive, ProductStatusDeleted),
+		},
+	}
+}
+
 // Product 商品数据结构
 type Product struct {
 	ID          string                 `json:"id" binding:"required"`
@@ -21,23 +82,28 @@ type Product struct {
 	Occasion    string                 `json:"occasion"`
 	ImageURLs   []string               `json:"image_urls"`
 	Tags        []string               `json:"tags"`
-	Attributes  map[string]interface{} `json:"attributes"` // 动态字段
-	Status      string                 `json:"status"`     // active, inactive, deleted
+	Attributes  map[string]interface{} `json:"attributes"`             // 动态字段
+	Status      string                 `json:"status"`                 // active, inactive, deleted
+	ContentHash string                 `json:"content_hash,omitempty"` // 商品内容摘要，内容不变时跳过写入
+	VariantHash string                 `json:"variant_hash,omitempty"` // 生成变体所用字段的指纹，不变时只更新 payload
+	Generation  int64                  `json:"generation"`             // 变体代数，每次重新生成变体加一
 	CreatedAt   time.Time              `json:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at"`
+	Variants    []ProductVariant       `json:"variants,omitempty"` // 已存储的变体（仅详情接口返回）
 }
 
 // ProductVariant 商品变体结构
 type ProductVariant struct {
 	ID          string    `json:"id"`
 	ProductID   string    `json:"product_id"`
-	Text        string    `json:"text"`        // 变体描述文本
-	Vector      []float32 `json:"vector"`      // 向量表示
+	Text        string    `json:"text"`             // 变体描述文本
+	Vector      []float32 `json:"vector,omitempty"` // 向量表示
 	GeneratedAt time.Time `json:"generated_at"`
 }
 
 // ProductCreateRequest 创建商品请求
 type ProductCreateRequest struct {
+	ID          string                 `json:"id"` // 外部商品 ID（如 ERP SKU），为空时自动生成；已存在时按 upsert 处理
 	Name        string                 `json:"name" binding:"required"`
 	Category    string                 `json:"category" binding:"required"`
 	Description string                 `json:"description"`
@@ -80,26 +146,67 @@ type BatchImportRequest struct {
 	Products []ProductCreateRequest `json:"products" binding:"required,min=1"`
 }
 
-// BatchImportResponse 批量导入响应
-type BatchImportResponse struct {
-	Total     int                    `json:"total"`
-	Success   int                    `json:"success"`
-	Failed    int                    `json:"failed"`
-	Errors    []BatchImportError     `json:"errors,omitempty"`
-	ProcessID string                 `json:"process_id"`
-}
-
 // BatchImportError 批量导入错误
 type BatchImportError struct {
 	Index   int    `json:"index"`
+	Line    int    `json:"line,omitempty"` // 上传文件中的行号
 	Product string `json:"product"`
 	Error   string `json:"error"`
 }
 
+// ProductBatchGetRequest 批量获取商品请求
+type ProductBatchGetRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1,max=100"`
+}
+
+// ProductBatchGetResponse 批量获取商品响应
+type ProductBatchGetResponse struct {
+	Products []*Product `json:"products"`
+	Missing  []string   `json:"missing,omitempty"` // 不存在的商品 ID
+}
+
+// ProductUpsertResult 创建或更新（upsert）商品的结果
+type ProductUpsertResult struct {
+	ProductID     string    `json:"product_id"`
+	Name          string    `json:"name"`
+	Created       bool      `json:"created"`              // 新建商品；false 表示更新已存在的商品
+	Unchanged     bool      `json:"unchanged"`            // 内容未变化，未写入任何数据
+	Restored      bool      `json:"restored"`             // 已软删除的商品被重新创建，恢复为上架状态
+	Regenerated   bool      `json:"variants_regenerated"` // 重新生成了变体；false 时只更新了商品字段
+	VariantsCount int       `json:"variants_count"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ProductListResponse 商品列表响应
+type ProductListResponse struct {
+	Products   []Product `json:"products"`
+	Count      int       `json:"count"`
+	NextCursor string    `json:"next_cursor,omitempty"` // 为空表示已到最后一页
+}
+
+// Validate 校验创建请求的必填字段（用于未经过 HTTP 绑定校验的文件导入）
+func (req *ProductCreateRequest) Validate() error {
+	switch {
+	case req.ID != "" && !IsValidProductID(req.ID):
+		return fmt.Errorf("invalid id %q", req.ID)
+	case req.Name == "":
+		return fmt.Errorf("name is required")
+	case req.Category == "":
+		return fmt.Errorf("category is required")
+	case req.Currency == "":
+		return fmt.Errorf("currency is required")
+	case req.Price < 0:
+		return fmt.Errorf("price cannot be negative")
+	}
+	return nil
+}
+
 // ToProduct 将创建请求转换为商品对象
 func (req *ProductCreateRequest) ToProduct() *Product {
 	now := time.Now()
 	return &Product{
+		ID:          req.ID,
 		Name:        req.Name,
 		Category:    req.Category,
 		Description: req.Description,
@@ -115,12 +222,45 @@ func (req *ProductCreateRequest) ToProduct() *Product {
 		ImageURLs:   req.ImageURLs,
 		Tags:        req.Tags,
 		Attributes:  req.Attributes,
-		Status:      "active",
+		Status:      ProductStatusActive,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
 }
 
+// ComputeContentHash 计算商品内容摘要
+// 覆盖全部商品内容字段，不包括 ID、状态和时间戳；空列表与未设置视为相同
+func (p *Product) ComputeContentHash() string {
+	content := struct {
+		Name        string                 `json:"name"`
+		Category    string                 `json:"category"`
+		Description string                 `json:"description"`
+		Price       float64                `json:"price"`
+		Currency    string                 `json:"currency"`
+		Brand       string                 `json:"brand"`
+		Color       string                 `json:"color"`
+		Size        string                 `json:"size"`
+		Material    string                 `json:"material"`
+		Style       string                 `json:"style"`
+		Gender      string                 `json:"gender"`
+		Occasion    string                 `json:"occasion"`
+		ImageURLs   []string               `json:"image_urls,omitempty"`
+		Tags        []string               `json:"tags,omitempty"`
+		Attributes  map[string]interface{} `json:"attributes,omitempty"`
+	}{
+		p.Name, p.Category, p.Description, p.Price, p.Currency, p.Brand, p.Color, p.Size,
+		p.Material, p.Style, p.Gender, p.Occasion, p.ImageURLs, p.Tags, p.Attributes,
+	}
+
+	// map 按键排序序列化，结果是确定的
+	data, err := json.Marshal(content)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 // ApplyUpdate 应用更新请求
 func (p *Product) ApplyUpdate(req *ProductUpdateRequest) {
 	if req.Name != nil {
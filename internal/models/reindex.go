@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+)
+
+// 重建索引任务状态
+const (
+	ReindexRunning          = "running"
+	ReindexReady            = "ready"             // 新集合已构建并通过校验，等待切换
+	ReindexValidationFailed = "validation_failed" // 新集合已构建但数量不一致或有失败的商品
+	ReindexSwitched         = "switched"          // 别名已指向新集合
+	ReindexRolledBack       = "rolled_back"       // 已切回原集合
+	ReindexCancelled        = "cancelled"
+	ReindexFailed           = "failed"
+)
+
+// ReindexOptions 重建索引选项
+type ReindexOptions struct {
+	EmbeddingModel     string `json:"embedding_model,omitempty"` // 新集合使用的 embedding 模型，为空时使用当前模型
+	VectorSize         int    `json:"vector_size,omitempty"`     // 新模型的向量维度，为空时使用当前维度
+	RegenerateVariants bool   `json:"regenerate_variants"`       // 重新调用 LLM 生成变体（提示词模板变化时），否则只重新向量化已有变体
+	AutoSwitch         bool   `json:"auto_switch"`               // 校验通过后自动切换别名
+	DropLegacy         bool   `json:"drop_legacy"`               // collection_name 是旧的物理集合时，允许切换时删除它以创建同名别名
+}
+
+// ReindexValidation 新旧集合的商品数量校验
+type ReindexValidation struct {
+	SourceCount int  `json:"source_count"`
+	TargetCount int  `json:"target_count"`
+	Passed      bool `json:"passed"`
+}
+
+// ReindexJob 重建索引任务
+type ReindexJob struct {
+	ID               string             `json:"id"`
+	Status           string             `json:"status"`
+	Options          ReindexOptions     `json:"options"`
+	SourceCollection string             `json:"source_collection"` // 任务开始时别名指向的集合
+	TargetCollection string             `json:"target_collection"` // 新建的版本化集合
+	Total            int                `json:"total"`
+	Processed        int                `json:"processed"`
+	Failed           int                `json:"failed"`
+	CaughtUp         int                `json:"caught_up"` // 追平阶段重新处理（期间更新或删除）的商品数
+	Errors           []BatchImportError `json:"errors,omitempty"`
+	Validation       *ReindexValidation `json:"validation,omitempty"`
+	Message          string             `json:"message,omitempty"`
+
+	// 切换前的模型参数，用于回滚
+	PreviousEmbeddingModel string `json:"previous_embedding_model,omitempty"`
+	PreviousVectorSize     int    `json:"previous_vector_size,omitempty"`
+
+	SyncedAt   time.Time  `json:"synced_at"` // 最近一次从源集合同步的起始时间，之后更新的商品在切换前再同步一次
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	SwitchedAt *time.Time `json:"switched_at,omitempty"`
+}
+
+// CollectionVersion 版本化集合
+type CollectionVersion struct {
+	Name       string `json:"name"`
+	Points     uint64 `json:"points"`
+	VectorSize uint64 `json:"vector_size"`
+	Live       bool   `json:"live"` // 别名当前指向该集合
+}
@@ -1,27 +1,108 @@
 package models
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
 // SearchRequest 搜索请求
 type SearchRequest struct {
-	Query  string `json:"query" binding:"required"`
-	Limit  int    `json:"limit,omitempty"`
-	Offset int    `json:"offset,omitempty"`
+	Query  string  `json:"query" binding:"required"`
+	Limit  int     `json:"limit,omitempty"`
+	Offset int     `json:"offset,omitempty"`
+	Cursor string  `json:"cursor,omitempty"` // 上一页返回的 next_cursor，优先于 offset
+	Filter *Filter `json:"filter,omitempty"` // 显式过滤条件，与解析出的条件以 AND 合并
+
+	SimilarityThreshold *float64       `json:"similarity_threshold,omitempty"` // 覆盖配置中的相似度阈值，0 表示不限制
+	HybridWeights       *HybridWeights `json:"hybrid_weights,omitempty"`       // 覆盖配置中的混合检索权重
+	IncludeInactive     bool           `json:"include_inactive,omitempty"`     // 包含下架和已删除的商品
+
+	Facets       []string  `json:"facets,omitempty"`        // 需要分面统计的字段，必须在属性注册表中标记为 facetable
+	FacetLimit   int       `json:"facet_limit,omitempty"`   // 每个字段返回的取值数量
+	PriceBuckets []float64 `json:"price_buckets,omitempty"` // 价格分段边界（递增），如 [100, 300, 500]
+}
+
+// HybridWeights 混合检索中稠密检索与关键词检索的权重，sparse 为 0 时只做稠密检索
+type HybridWeights struct {
+	Dense  float64 `json:"dense"`
+	Sparse float64 `json:"sparse"`
 }
 
 // SearchResponse 搜索响应
 type SearchResponse struct {
-	Query     string          `json:"query"`
-	Total     int             `json:"total"`
-	Results   []SearchResult  `json:"results"`
-	ParsedQuery *ParsedQuery  `json:"parsed_query,omitempty"`
-	TimeTaken int64           `json:"time_taken_ms"`
+	Query       string         `json:"query"`
+	Total       int            `json:"total"` // 满足过滤条件和相似度阈值的商品数量（非变体数量），设置阈值时最多为 max_window
+	Offset      int            `json:"offset"`
+	Limit       int            `json:"limit"`
+	HasMore     bool           `json:"has_more"`
+	NextCursor  string         `json:"next_cursor,omitempty"`
+	Results     []SearchResult `json:"results"`
+	ParsedQuery *ParsedQuery   `json:"parsed_query,omitempty"`
+	TimeTaken   int64          `json:"time_taken_ms"`
+
+	Facets       map[string][]FacetValue `json:"facets,omitempty"`
+	PriceBuckets []PriceBucket           `json:"price_buckets,omitempty"`
+}
+
+// FacetValue 分面取值及商品数量
+type FacetValue struct {
+	Value interface{} `json:"value"`
+	Count int         `json:"count"`
+}
+
+// PriceBucket 价格区间 [from, to) 内的商品数量，nil 表示该侧不限
+type PriceBucket struct {
+	From  *float64 `json:"from,omitempty"`
+	To    *float64 `json:"to,omitempty"`
+	Count int      `json:"count"`
+}
+
+// SearchCursor 搜索分页游标状态
+// 携带首次解析的查询意图，后续翻页不再调用 LLM，保证各页的过滤条件一致
+type SearchCursor struct {
+	Offset      int          `json:"o"`
+	Fingerprint string       `json:"f"`
+	ParsedQuery *ParsedQuery `json:"p,omitempty"`
+}
+
+// Fingerprint 计算查询指纹，用于校验游标是否属于同一查询
+func (req *SearchRequest) Fingerprint() string {
+	hash := sha256.New()
+	hash.Write([]byte(req.Query))
+	if req.SimilarityThreshold != nil {
+		hash.Write([]byte(strconv.FormatFloat(*req.SimilarityThreshold, 'f', -1, 64)))
+	}
+	if req.HybridWeights != nil {
+		hash.Write([]byte(strconv.FormatFloat(req.HybridWeights.Dense, 'f', -1, 64)))
+		hash.Write([]byte(strconv.FormatFloat(req.HybridWeights.Sparse, 'f', -1, 64)))
+	}
+	if req.IncludeInactive {
+		hash.Write([]byte("include_inactive"))
+	}
+	if !req.Filter.IsEmpty() {
+		filterJSON, _ := json.Marshal(req.Filter)
+		hash.Write(filterJSON)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
 }
 
-// SearchResult 搜索结果
+// SearchResult 搜索结果（每个商品一条）
 type SearchResult struct {
-	Product     *Product `json:"product"`
-	Score       float64  `json:"score"`
-	MatchReason string   `json:"match_reason"`
-	Variant     string   `json:"variant,omitempty"` // 匹配的变体文本
+	Product         *Product         `json:"product"`
+	Score           float64          `json:"score"` // 最佳变体得分
+	MatchReason     string           `json:"match_reason"`
+	Variant         string           `json:"variant,omitempty"`          // 最佳匹配的变体文本
+	MatchedVariants []MatchedVariant `json:"matched_variants,omitempty"` // 命中的变体，按得分降序
+}
+
+// MatchedVariant 命中的商品变体
+type MatchedVariant struct {
+	VariantID string  `json:"variant_id"`
+	Text      string  `json:"text"`
+	Score     float64 `json:"score"`
 }
 
 // ParsedQuery Function Calling 解析结果
@@ -51,96 +132,82 @@ type SearchSuggestionsResponse struct {
 	Suggestions []string `json:"suggestions"`
 }
 
-// ToQdrantFilter 转换为 Qdrant 过滤条件
-func (pq *ParsedQuery) ToQdrantFilter() map[string]interface{} {
-	filter := make(map[string]interface{})
-	must := []map[string]interface{}{}
+// ToFilter 将解析结果转换为过滤条件 DSL
+func (pq *ParsedQuery) ToFilter() *Filter {
+	filter := &Filter{}
 
 	// 添加基础字段过滤
-	if pq.Color != "" {
-		must = append(must, map[string]interface{}{
-			"key":   "color",
-			"match": map[string]interface{}{"value": pq.Color},
-		})
+	fields := []struct {
+		key   string
+		value string
+	}{
+		{"color", pq.Color},
+		{"brand", pq.Brand},
+		{"size", pq.Size},
+		{"material", pq.Material},
+		{"style", pq.Style},
+		{"occasion", pq.Occasion},
+		{"gender", pq.Gender},
 	}
-
-	if pq.Brand != "" {
-		must = append(must, map[string]interface{}{
-			"key":   "brand",
-			"match": map[string]interface{}{"value": pq.Brand},
-		})
-	}
-
-	if pq.Size != "" {
-		must = append(must, map[string]interface{}{
-			"key":   "size",
-			"match": map[string]interface{}{"value": pq.Size},
-		})
-	}
-
-	if pq.Material != "" {
-		must = append(must, map[string]interface{}{
-			"key":   "material",
-			"match": map[string]interface{}{"value": pq.Material},
-		})
+	for _, field := range fields {
+		if field.value != "" {
+			filter.Must = append(filter.Must, NewMatchCondition(field.key, field.value))
+		}
 	}
 
-	if pq.Style != "" {
-		must = append(must, map[string]interface{}{
-			"key":   "style",
-			"match": map[string]interface{}{"value": pq.Style},
-		})
+	// 价格范围过滤
+	if pq.PriceMin != nil || pq.PriceMax != nil {
+		filter.Must = append(filter.Must, NewRangeCondition("price", pq.PriceMin, pq.PriceMax))
 	}
 
-	if pq.Occasion != "" {
-		must = append(must, map[string]interface{}{
-			"key":   "occasion",
-			"match": map[string]interface{}{"value": pq.Occasion},
-		})
+	// 添加动态过滤条件（按 key 排序，保证生成结果稳定），非基础字段按自定义属性过滤
+	keys := make([]string, 0, len(pq.Filters))
+	for key := range pq.Filters {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
-	if pq.Gender != "" {
-		must = append(must, map[string]interface{}{
-			"key":   "gender",
-			"match": map[string]interface{}{"value": pq.Gender},
-		})
+	for _, key := range keys {
+		// LLM 可能返回不合法的值（如小数精确匹配），直接忽略而不是让整个搜索失败
+		if cond, ok := dynamicCondition(AttributeFilterKey(key), pq.Filters[key]); ok && cond.validate(1) == nil {
+			filter.Must = append(filter.Must, cond)
+		}
 	}
 
-	// 价格范围过滤
-	if pq.PriceMin != nil || pq.PriceMax != nil {
-		priceRange := map[string]interface{}{"key": "price"}
-		rangeCondition := map[string]interface{}{}
+	return filter
+}
 
-		if pq.PriceMin != nil {
-			rangeCondition["gte"] = *pq.PriceMin
+// dynamicCondition 将动态过滤值转换为条件
+// 数组视为任意匹配，包含 gt/gte/lt/lte 的对象视为范围，其余视为精确匹配
+func dynamicCondition(key string, value interface{}) (Condition, bool) {
+	switch v := value.(type) {
+	case nil:
+		return Condition{}, false
+	case []interface{}:
+		if len(v) == 0 {
+			return Condition{}, false
 		}
-		if pq.PriceMax != nil {
-			rangeCondition["lte"] = *pq.PriceMax
+		return NewMatchAnyCondition(key, v...), true
+	case map[string]interface{}:
+		r := &RangeValue{}
+		bounds := map[string]**float64{"gt": &r.Gt, "gte": &r.Gte, "lt": &r.Lt, "lte": &r.Lte}
+		found := false
+		for name, target := range bounds {
+			if n, ok := v[name].(float64); ok {
+				*target = &n
+				found = true
+			}
+		}
+		if !found {
+			return Condition{}, false
+		}
+		return Condition{Key: key, Range: r}, true
+	case string:
+		if v == "" {
+			return Condition{}, false
 		}
-
-		priceRange["range"] = rangeCondition
-		must = append(must, priceRange)
-	}
-
-	// 状态过滤 - 只返回活跃商品
-	must = append(must, map[string]interface{}{
-		"key":   "status",
-		"match": map[string]interface{}{"value": "active"},
-	})
-
-	// 添加动态过滤条件
-	for key, value := range pq.Filters {
-		must = append(must, map[string]interface{}{
-			"key":   key,
-			"match": map[string]interface{}{"value": value},
-		})
-	}
-
-	if len(must) > 0 {
-		filter["must"] = must
 	}
-
-	return filter
+	return NewMatchCondition(key, value), true
 }
 
 // GetSearchQuery 获取用于向量检索的查询文本
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"search-ec2/internal/config"
+	"search-ec2/internal/models"
+	"strings"
+
+	"github.com/qdrant/go-client/qdrant"
+	"github.com/sirupsen/logrus"
+)
+
+// legacyAttributePrefix 旧版本以字符串平铺保存属性时使用的字段前缀
+const legacyAttributePrefix = "attr_"
+
+// normalizeAttributes 将自定义属性转换为 payload 支持的类型
+// qdrant.NewValueMap 遇到不支持的类型会 panic，因此写入前必须先规范化
+func normalizeAttributes(attributes map[string]interface{}) map[string]any {
+	result := make(map[string]any, len(attributes))
+	for key, value := range attributes {
+		if normalized, ok := normalizeAttributeValue(value); ok {
+			result[key] = normalized
+		}
+	}
+	return result
+}
+
+// normalizeAttributeValue 规范化单个属性值
+// 整数值的浮点数（JSON 解码的结果）保存为整数，以便同时支持精确匹配和范围过滤；
+// 其他类型先经过 JSON 往返转换为通用结构，无法转换时退化为字符串
+func normalizeAttributeValue(value interface{}) (any, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, false
+	case string, bool, int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case float32:
+		return normalizeNumber(float64(v)), true
+	case float64:
+		return normalizeNumber(v), true
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, true
+		}
+		if f, err := v.Float64(); err == nil {
+			return normalizeNumber(f), true
+		}
+		return v.String(), true
+	case []interface{}:
+		list := make([]any, 0, len(v))
+		for _, item := range v {
+			if normalized, ok := normalizeAttributeValue(item); ok {
+				list = append(list, normalized)
+			}
+		}
+		return list, true
+	case map[string]interface{}:
+		return normalizeAttributes(v), true
+	}
+
+	// 其他切片、结构体等类型
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		list := make([]any, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			if normalized, ok := normalizeAttributeValue(rv.Index(i).Interface()); ok {
+				list = append(list, normalized)
+			}
+		}
+		return list, true
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value), true
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return fmt.Sprintf("%v", value), true
+	}
+	return normalizeAttributeValue(generic)
+}
+
+// normalizeNumber 整数值的浮点数转换为 int64
+func normalizeNumber(f float64) any {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+	return f
+}
+
+// attributesFromPayload 从 payload 还原自定义属性
+// 优先读取嵌套的 attributes 字段，同时兼容旧版本的 attr_ 字段
+func attributesFromPayload(payload map[string]*qdrant.Value) map[string]interface{} {
+	attributes := make(map[string]interface{})
+
+	for key, val := range payload {
+		if strings.HasPrefix(key, legacyAttributePrefix) {
+			attributes[strings.TrimPrefix(key, legacyAttributePrefix)] = val.GetStringValue()
+		}
+	}
+
+	if fields := payload[models.AttributesField].GetStructValue().GetFields(); fields != nil {
+		for key, val := range fields {
+			attributes[key] = valueToInterface(val)
+		}
+	}
+
+	return attributes
+}
+
+// valueToInterface 将 qdrant.Value 转换为 Go 值
+func valueToInterface(value *qdrant.Value) interface{} {
+	switch v := value.GetKind().(type) {
+	case *qdrant.Value_BoolValue:
+		return v.BoolValue
+	case *qdrant.Value_IntegerValue:
+		return v.IntegerValue
+	case *qdrant.Value_DoubleValue:
+		return v.DoubleValue
+	case *qdrant.Value_StringValue:
+		return v.StringValue
+	case *qdrant.Value_ListValue:
+		list := make([]interface{}, 0, len(v.ListValue.GetValues()))
+		for _, item := range v.ListValue.GetValues() {
+			list = append(list, valueToInterface(item))
+		}
+		return list
+	case *qdrant.Value_StructValue:
+		fields := make(map[string]interface{}, len(v.StructValue.GetFields()))
+		for key, item := range v.StructValue.GetFields() {
+			fields[key] = valueToInterface(item)
+		}
+		return fields
+	}
+	return nil
+}
+
+// attributeIndexTypes 属性类型对应的 payload 索引类型
+var attributeIndexTypes = map[string]qdrant.FieldType{
+	config.AttributeTypeKeyword: qdrant.FieldType_FieldTypeKeyword,
+	config.AttributeTypeText:    qdrant.FieldType_FieldTypeText,
+	config.AttributeTypeInteger: qdrant.FieldType_FieldTypeInteger,
+	config.AttributeTypeFloat:   qdrant.FieldType_FieldTypeFloat,
+	config.AttributeTypeBool:    qdrant.FieldType_FieldTypeBool,
+}
+
+// EnsureAttributeIndexes 按属性注册表创建 payload 索引，返回成功创建（或已存在）的索引数量
+// 基础字段直接索引顶层字段，自定义属性索引 attributes.<name>；重复创建是幂等的
+func (s *QdrantService) EnsureAttributeIndexes() (int, error) {
+	if err := s.ensureInitialized(); err != nil {
+		return 0, err
+	}
+	return s.ensureAttributeIndexes(), nil
+}
+
+// ensureAttributeIndexes 创建属性索引，失败只记录警告
+func (s *QdrantService) ensureAttributeIndexes() int {
+	ctx := context.Background()
+	created := 0
+	for _, attr := range config.AttributeRegistry().Attributes {
+		if !attr.Filterable && !attr.Facetable {
+			continue
+		}
+
+		field := models.AttributeFilterKey(attr.Name)
+		if _, ok := systemIndexes[field]; ok {
+			continue
+		}
+
+		_, err := s.client.CreateFieldIndex(ctx, &qdrant.CreateFieldIndexCollection{
+			CollectionName: s.collectionName,
+			Wait:           qdrant.PtrOf(true),
+			FieldName:      field,
+			FieldType:      qdrant.PtrOf(attributeIndexTypes[attr.Type]),
+		})
+		if err != nil {
+			logrus.Warnf("Failed to create payload index on %s: %v", field, err)
+			continue
+		}
+		created++
+	}
+
+	logrus.Infof("Ensured %d attribute payload indexes", created)
+	return created
+}
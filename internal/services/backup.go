@@ -0,0 +1,158 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"search-ec2/internal/models"
+
+	"github.com/qdrant/go-client/qdrant"
+	"github.com/sirupsen/logrus"
+)
+
+// 商品目录导出与恢复
+// 导出文件为 JSONL，每行一个商品（models.Product），包含全部已存储的变体；带向量导出时可以在不调用
+// LLM 和 embedding 的情况下恢复。关键词稀疏向量不导出，恢复时由变体文本重新计算。
+
+const (
+	exportBatchSize       = 100 // 每批读取的商品数
+	maxRestoreErrorReport = 100 // 恢复结果中最多保留的错误条数
+)
+
+// ExportOptions 导出选项
+type ExportOptions struct {
+	WithVectors bool           // 导出变体向量，恢复时必须带向量
+	Filter      *models.Filter // 只导出满足条件的商品，nil 表示全部（包括下架和已删除）
+}
+
+// ExportProducts 将商品逐个写入 w（JSONL），返回导出的商品数
+// 按批读取，不会把整个目录加载到内存
+func (s *QdrantService) ExportProducts(w io.Writer, opts ExportOptions) (int, error) {
+	if err := s.ensureInitialized(); err != nil {
+		return 0, err
+	}
+
+	qdrantFilter, err := productFilter(opts.Filter)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	encoder := json.NewEncoder(w)
+	seen := make(map[string]bool) // 重新生成变体的过程中同一商品可能有两个首变体
+	exported := 0
+
+	var offset *qdrant.PointId
+	for {
+		points, nextOffset, err := s.client.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+			CollectionName: s.collectionName,
+			Filter:         qdrantFilter,
+			Limit:          qdrant.PtrOf(uint32(exportBatchSize)),
+			Offset:         offset,
+			WithPayload:    qdrant.NewWithPayloadInclude("product_id"),
+		})
+		if err != nil {
+			return exported, fmt.Errorf("failed to scroll products for export: %w", err)
+		}
+
+		productIDs := make([]string, 0, len(points))
+		for _, point := range points {
+			productID := s.extractStringFromValue(point.Payload["product_id"])
+			if productID == "" || seen[productID] {
+				continue
+			}
+			seen[productID] = true
+			productIDs = append(productIDs, productID)
+		}
+
+		products, err := s.getProducts(productIDs, opts.WithVectors)
+		if err != nil {
+			return exported, err
+		}
+		for _, product := range products {
+			if err := encoder.Encode(product); err != nil {
+				return exported, fmt.Errorf("failed to write exported product: %w", err)
+			}
+			exported++
+		}
+
+		if nextOffset == nil {
+			break
+		}
+		offset = nextOffset
+	}
+
+	logrus.Infof("Exported %d products from collection %s", exported, s.collectionName)
+	return exported, nil
+}
+
+// RestoreProducts 从导出文件恢复商品，使用文件中的变体文本和向量，不调用 LLM 和 embedding
+// 已存在的商品被覆盖（保留导出时的状态和时间戳）；单个商品失败不影响其他商品
+func (s *QdrantService) RestoreProducts(r io.Reader) (*models.RestoreResult, error) {
+	if err := s.ensureInitialized(); err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), importMaxLineSize)
+	result := &models.RestoreResult{}
+
+	for line := 1; scanner.Scan(); line++ {
+		data := scanner.Bytes()
+		if len(data) == 0 {
+			continue
+		}
+
+		var product models.Product
+		err := json.Unmarshal(data, &product)
+		if err == nil {
+			err = s.validateRestoredProduct(&product)
+		}
+		if err == nil {
+			err = s.InsertProduct(&product, product.Variants)
+		}
+
+		if err != nil {
+			result.Failed++
+			if len(result.Errors) < maxRestoreErrorReport {
+				result.Errors = append(result.Errors, models.BatchImportError{
+					Index:   line - 1,
+					Line:    line,
+					Product: product.ID,
+					Error:   err.Error(),
+				})
+			}
+			continue
+		}
+		result.Restored++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("failed to read restore file: %w", err)
+	}
+
+	logrus.Infof("Restored %d products (%d failed) into collection %s", result.Restored, result.Failed, s.collectionName)
+	return result, nil
+}
+
+// validateRestoredProduct 校验导出记录可以直接写入：有商品 ID，且每个变体都带有维度正确的向量
+func (s *QdrantService) validateRestoredProduct(product *models.Product) error {
+	if product.ID == "" {
+		return fmt.Errorf("product id is required")
+	}
+	if len(product.Variants) == 0 {
+		return fmt.Errorf("product %s has no variants", product.ID)
+	}
+	for i, variant := range product.Variants {
+		if len(variant.Vector) == 0 {
+			return fmt.Errorf("variant %d of product %s has no vector, export with vectors to restore", i, product.ID)
+		}
+		if len(variant.Vector) != s.VectorSize() {
+			return fmt.Errorf("%w: variant %d of product %s has dimension %d, collection expects %d",
+				ErrVectorParamsMismatch, i, product.ID, len(variant.Vector), s.VectorSize())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"search-ec2/internal/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qdrant/go-client/qdrant"
+	"github.com/sirupsen/logrus"
+)
+
+// 版本化集合与别名
+// qdrant.collection_name 是 Qdrant 别名，指向实际存储数据的版本化集合 <collection_name>_<UTC 时间戳>，
+// 所有读写都经过别名。重建索引时在新的版本化集合中写入全部数据，校验通过后原子地切换别名，
+// 旧集合保留用于回滚。
+// 旧版本部署中 collection_name 是物理集合，继续直接读写；第一次切换时需要先删除它才能创建同名别名
+// （drop_legacy），之后无法再回滚到它。
+
+var (
+	// ErrLegacyCollection collection_name 是物理集合，切换别名需要删除它
+	ErrLegacyCollection = errors.New("collection_name is a physical collection, not an alias")
+	// ErrCollectionInUse 集合正在提供服务或被重建任务使用
+	ErrCollectionInUse = errors.New("collection is in use")
+	// ErrCollectionNotFound 集合不存在或不是版本化集合
+	ErrCollectionNotFound = errors.New("collection not found")
+)
+
+// versionTimeLayout 版本化集合名称中的时间戳格式
+const versionTimeLayout = "20060102150405"
+
+// versionedCollectionName 生成版本化集合名称
+func versionedCollectionName(alias string, t time.Time) string {
+	return alias + "_" + t.UTC().Format(versionTimeLayout)
+}
+
+// isCollectionVersion 判断集合是否为别名的版本化集合
+func (s *QdrantService) isCollectionVersion(name string) bool {
+	suffix, ok := strings.CutPrefix(name, s.collectionName+"_")
+	if !ok {
+		return false
+	}
+	_, err := time.Parse(versionTimeLayout, suffix)
+	return err == nil
+}
+
+// resolveAlias 返回别名指向的集合；collection_name 不是别名时第二个返回值为 false
+func (s *QdrantService) resolveAlias(ctx context.Context) (string, bool, error) {
+	aliases, err := s.client.ListAliases(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to list aliases: %w", err)
+	}
+	for _, alias := range aliases {
+		if alias.GetAliasName() == s.collectionName {
+			return alias.GetCollectionName(), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// LiveCollection 返回当前提供服务的物理集合
+func (s *QdrantService) LiveCollection() (string, error) {
+	if err := s.ensureInitialized(); err != nil {
+		return "", err
+	}
+
+	target, isAlias, err := s.resolveAlias(context.Background())
+	if err != nil {
+		return "", err
+	}
+	if !isAlias {
+		return s.collectionName, nil
+	}
+	return target, nil
+}
+
+// ListCollectionVersions 列出版本化集合（以及旧版本的物理集合），按名称即创建时间排序
+func (s *QdrantService) ListCollectionVersions() ([]models.CollectionVersion, error) {
+	live, err := s.LiveCollection()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	collections, err := s.client.ListCollections(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	versions := make([]models.CollectionVersion, 0)
+	for _, name := range collections {
+		if name != s.collectionName && !s.isCollectionVersion(name) {
+			continue
+		}
+
+		version := models.CollectionVersion{Name: name, Live: name == live}
+		info, err := s.client.GetCollectionInfo(ctx, name)
+		if err != nil {
+			logrus.Warnf("Failed to get collection info for %s: %v", name, err)
+		} else {
+			version.Points = info.GetPointsCount()
+			version.VectorSize = info.GetConfig().GetParams().GetVectorsConfig().GetParams().GetSize()
+		}
+		versions = append(versions, version)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Name < versions[j].Name
+	})
+	return versions, nil
+}
+
+// CreateCollectionVersion 创建新的版本化集合及其 payload 索引，返回集合名称
+func (s *QdrantService) CreateCollectionVersion(vectorSize int) (string, error) {
+	if err := s.ensureInitialized(); err != nil {
+		return "", err
+	}
+
+	name := versionedCollectionName(s.collectionName, time.Now())
+	if err := s.createCollection(context.Background(), name, uint64(vectorSize)); err != nil {
+		return "", err
+	}
+
+	target, err := s.forCollection(name, vectorSize)
+	if err != nil {
+		return "", err
+	}
+	target.ensureSystemIndexes()
+	target.ensureAttributeIndexes()
+
+	return name, nil
+}
+
+// forCollection 返回直接读写指定物理集合的服务实例（与当前实例共用连接），用于重建索引
+func (s *QdrantService) forCollection(name string, vectorSize int) (*QdrantService, error) {
+	if err := s.ensureInitialized(); err != nil {
+		return nil, err
+	}
+
+	service := &QdrantService{
+		client:         s.client,
+		collectionName: name,
+		config:         s.config,
+		vectorSize:     uint64(vectorSize),
+		vectorDistance: s.vectorDistance,
+		sparseEncoder:  s.sparseEncoder,
+		initialized:    true,
+	}
+	if err := service.loadVectorParams(); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// SwitchCollection 原子地把别名指向 target，返回切换前别名指向的集合
+// vectorSize 为 target 的向量维度，切换后当前实例按新的维度重新加载集合参数。
+// collection_name 是物理集合时，dropLegacy 为 true 才会删除它并创建别名（返回空字符串），否则返回 ErrLegacyCollection
+func (s *QdrantService) SwitchCollection(target string, vectorSize int, dropLegacy bool) (string, error) {
+	if err := s.ensureInitialized(); err != nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+	previous, isAlias, err := s.resolveAlias(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	exists, err := s.client.CollectionExists(ctx, target)
+	if err != nil {
+		return "", fmt.Errorf("failed to check collection: %w", err)
+	}
+	if !exists {
+		return "", fmt.Errorf("%w: %s", ErrCollectionNotFound, target)
+	}
+
+	operations := make([]*qdrant.AliasOperations, 0, 2)
+	if isAlias {
+		operations = append(operations, qdrant.NewAliasDelete(s.collectionName))
+	} else {
+		if !dropLegacy {
+			return "", fmt.Errorf("%w: set drop_legacy to delete %s and replace it with an alias",
+				ErrLegacyCollection, s.collectionName)
+		}
+		// 删除后到别名创建前的短暂时间内请求会失败
+		if err := s.client.DeleteCollection(ctx, s.collectionName); err != nil {
+			return "", fmt.Errorf("failed to delete legacy collection %s: %w", s.collectionName, err)
+		}
+		logrus.Warnf("Legacy collection %s deleted to make room for the alias", s.collectionName)
+	}
+	operations = append(operations, qdrant.NewAliasCreate(s.collectionName, target))
+
+	// 删除和创建在同一个请求中执行，对读写方是原子的
+	if err := s.client.UpdateAliases(ctx, operations); err != nil {
+		return "", fmt.Errorf("failed to switch alias %s to %s: %w", s.collectionName, target, err)
+	}
+
+	// 下次使用时按新集合重新加载向量参数
+	s.initMu.Lock()
+	s.vectorSize = uint64(vectorSize)
+	s.initialized = false
+	s.initMu.Unlock()
+
+	logrus.Infof("Alias %s switched from %s to %s", s.collectionName, previous, target)
+	return previous, nil
+}
+
+// DeleteCollectionVersion 删除不再使用的版本化集合，不能删除别名当前指向的集合
+func (s *QdrantService) DeleteCollectionVersion(name string) error {
+	if !s.isCollectionVersion(name) {
+		return fmt.Errorf("%w: %s is not a version of %s", ErrCollectionNotFound, name, s.collectionName)
+	}
+
+	live, err := s.LiveCollection()
+	if err != nil {
+		return err
+	}
+	if name == live {
+		return fmt.Errorf("%w: %s is serving alias %s", ErrCollectionInUse, name, s.collectionName)
+	}
+
+	ctx := context.Background()
+	exists, err := s.client.CollectionExists(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to check collection: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+
+	if err := s.client.DeleteCollection(ctx, name); err != nil {
+		return fmt.Errorf("failed to delete collection %s: %w", name, err)
+	}
+	logrus.Infof("Collection %s deleted", name)
+	return nil
+}
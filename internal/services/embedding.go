@@ -1,13 +1,12 @@
 package services
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"search-ec2/internal/config"
+	"search-ec2/internal/llm"
 	"search-ec2/internal/models"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -15,27 +14,36 @@ import (
 
 // EmbeddingService 向量化服务
 type EmbeddingService struct {
-	client  *http.Client
-	baseURL string
-	apiKey  string
-	model   string
+	route *llm.Route // 向量化使用的协议（models.embedding），备用项只更换协议
+	model string
+	mu    sync.RWMutex // 保护 model，切换集合时会修改
 }
 
 // NewEmbeddingService 创建向量化服务
 func NewEmbeddingService() *EmbeddingService {
 	return &EmbeddingService{
-		client: &http.Client{
-			Timeout: time.Duration(config.AppConfig.OpenAI.Timeout) * time.Second,
-		},
-		baseURL: config.AppConfig.OpenAI.BaseURL,
-		apiKey:  config.AppConfig.OpenAI.APIKey,
-		model:   config.AppConfig.OpenAI.EmbeddingModel,
+		route: llm.NewRoute(config.TaskEmbedding),
+		model: config.AppConfig.OpenAI.EmbeddingModel,
 	}
 }
 
+// Model 返回当前使用的 embedding 模型
+func (s *EmbeddingService) Model() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.model
+}
+
+// SetModel 切换 embedding 模型（重建索引切换集合时使用）
+func (s *EmbeddingService) SetModel(model string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.model = model
+}
+
 // GetEmbedding 获取单个文本的向量
-func (s *EmbeddingService) GetEmbedding(text string) ([]float32, error) {
-	embeddings, err := s.GetEmbeddings([]string{text})
+func (s *EmbeddingService) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	embeddings, err := s.GetEmbeddings(ctx, []string{text})
 	if err != nil {
 		return nil, err
 	}
@@ -48,63 +56,22 @@ func (s *EmbeddingService) GetEmbedding(text string) ([]float32, error) {
 }
 
 // GetEmbeddings 批量获取文本向量
-func (s *EmbeddingService) GetEmbeddings(texts []string) ([][]float32, error) {
+func (s *EmbeddingService) GetEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
 	if len(texts) == 0 {
 		return nil, fmt.Errorf("no texts provided")
 	}
 
 	// 构建请求
 	request := models.EmbeddingRequest{
-		Model: s.model,
+		Model: s.Model(),
 		Input: texts,
 	}
 
-	// 序列化请求
-	requestBody, err := json.Marshal(request)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	// 创建 HTTP 请求
-	url := fmt.Sprintf("%s/embeddings", s.baseURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// 设置请求头
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.apiKey))
-
-	// 发送请求
+	// 发送请求（超时、重试和限流由共享的 LLM 客户端处理）
 	logrus.Debugf("Sending embedding request for %d texts", len(texts))
-	resp, err := s.client.Do(req)
+	response, err := s.route.Embeddings(ctx, &request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// 读取响应
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	// 检查 HTTP 状态码
-	if resp.StatusCode != http.StatusOK {
-		logrus.Errorf("OpenAI API error: %s", string(responseBody))
-		return nil, fmt.Errorf("OpenAI API error: status %d", resp.StatusCode)
-	}
-
-	// 解析响应
-	var response models.EmbeddingResponse
-	if err := json.Unmarshal(responseBody, &response); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
-
-	// 检查 API 错误
-	if response.Error != nil {
-		return nil, fmt.Errorf("OpenAI API error: %s", response.Error.Message)
+		return nil, err
 	}
 
 	// 提取向量
@@ -120,13 +87,13 @@ func (s *EmbeddingService) GetEmbeddings(texts []string) ([][]float32, error) {
 }
 
 // GetProductVariantEmbeddings 为商品变体生成向量
-func (s *EmbeddingService) GetProductVariantEmbeddings(variants []string) ([]models.ProductVariant, error) {
+func (s *EmbeddingService) GetProductVariantEmbeddings(ctx context.Context, variants []string) ([]models.ProductVariant, error) {
 	if len(variants) == 0 {
 		return nil, fmt.Errorf("no variants provided")
 	}
 
 	// 获取向量
-	embeddings, err := s.GetEmbeddings(variants)
+	embeddings, err := s.GetEmbeddings(ctx, variants)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get embeddings: %w", err)
 	}
@@ -135,7 +102,7 @@ func (s *EmbeddingService) GetProductVariantEmbeddings(variants []string) ([]mod
 	productVariants := make([]models.ProductVariant, len(variants))
 	for i, variant := range variants {
 		productVariants[i] = models.ProductVariant{
-			ID:          fmt.Sprintf("variant_%d_%d", time.Now().UnixNano(), i),
+			ID:          fmt.Sprintf("variant_%d", i), // 按序号生成，保证点 ID 可重复推导
 			Text:        variant,
 			Vector:      embeddings[i],
 			GeneratedAt: time.Now(),
@@ -148,12 +115,12 @@ func (s *EmbeddingService) GetProductVariantEmbeddings(variants []string) ([]mod
 // HealthCheck 健康检查
 func (s *EmbeddingService) HealthCheck() error {
 	// 尝试获取一个简单文本的向量
-	_, err := s.GetEmbedding("test")
+	_, err := s.GetEmbedding(context.Background(), "test")
 	return err
 }
 
 // BatchEmbedding 批量向量化处理（支持大量文本）
-func (s *EmbeddingService) BatchEmbedding(texts []string, batchSize int) ([][]float32, error) {
+func (s *EmbeddingService) BatchEmbedding(ctx context.Context, texts []string, batchSize int) ([][]float32, error) {
 	if batchSize <= 0 {
 		batchSize = 100 // 默认批次大小
 	}
@@ -168,7 +135,7 @@ func (s *EmbeddingService) BatchEmbedding(texts []string, batchSize int) ([][]fl
 		}
 
 		batch := texts[i:end]
-		embeddings, err := s.GetEmbeddings(batch)
+		embeddings, err := s.GetEmbeddings(ctx, batch)
 		if err != nil {
 			return nil, fmt.Errorf("failed to process batch %d-%d: %w", i, end, err)
 		}
@@ -184,8 +151,9 @@ func (s *EmbeddingService) BatchEmbedding(texts []string, batchSize int) ([][]fl
 	return allEmbeddings, nil
 }
 
-// EmbeddingCache 向量缓存（简单内存缓存）
+// EmbeddingCache 向量缓存（简单内存缓存，并发安全）
 type EmbeddingCache struct {
+	mu    sync.RWMutex
 	cache map[string][]float32
 }
 
@@ -198,22 +166,30 @@ func NewEmbeddingCache() *EmbeddingCache {
 
 // Get 获取缓存的向量
 func (c *EmbeddingCache) Get(text string) ([]float32, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	embedding, exists := c.cache[text]
 	return embedding, exists
 }
 
 // Set 设置缓存的向量
 func (c *EmbeddingCache) Set(text string, embedding []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.cache[text] = embedding
 }
 
 // Clear 清空缓存
 func (c *EmbeddingCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.cache = make(map[string][]float32)
 }
 
 // Size 获取缓存大小
 func (c *EmbeddingCache) Size() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return len(c.cache)
 }
 
@@ -231,8 +207,14 @@ func NewCachedEmbeddingService() *CachedEmbeddingService {
 	}
 }
 
+// SetModel 切换 embedding 模型并清空缓存（缓存的向量属于旧模型）
+func (s *CachedEmbeddingService) SetModel(model string) {
+	s.EmbeddingService.SetModel(model)
+	s.cache.Clear()
+}
+
 // GetEmbedding 获取向量（带缓存）
-func (s *CachedEmbeddingService) GetEmbedding(text string) ([]float32, error) {
+func (s *CachedEmbeddingService) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
 	// 检查缓存
 	if embedding, exists := s.cache.Get(text); exists {
 		logrus.Debugf("Cache hit for text: %s", text[:min(50, len(text))])
@@ -240,7 +222,7 @@ func (s *CachedEmbeddingService) GetEmbedding(text string) ([]float32, error) {
 	}
 
 	// 获取向量
-	embedding, err := s.EmbeddingService.GetEmbedding(text)
+	embedding, err := s.EmbeddingService.GetEmbedding(ctx, text)
 	if err != nil {
 		return nil, err
 	}
@@ -251,7 +233,7 @@ func (s *CachedEmbeddingService) GetEmbedding(text string) ([]float32, error) {
 }
 
 // GetEmbeddings 批量获取向量（带缓存）
-func (s *CachedEmbeddingService) GetEmbeddings(texts []string) ([][]float32, error) {
+func (s *CachedEmbeddingService) GetEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
 	embeddings := make([][]float32, len(texts))
 	uncachedTexts := []string{}
 	uncachedIndices := []int{}
@@ -268,7 +250,7 @@ func (s *CachedEmbeddingService) GetEmbeddings(texts []string) ([][]float32, err
 
 	// 获取未缓存的向量
 	if len(uncachedTexts) > 0 {
-		newEmbeddings, err := s.EmbeddingService.GetEmbeddings(uncachedTexts)
+		newEmbeddings, err := s.EmbeddingService.GetEmbeddings(ctx, uncachedTexts)
 		if err != nil {
 			return nil, err
 		}
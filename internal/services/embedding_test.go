@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"search-ec2/internal/config"
+	"search-ec2/internal/llm"
+	"testing"
+)
+
+// hashEmbeddingService 使用进程内 hash 协议的向量化服务，不依赖外部模型
+func hashEmbeddingService(dimensions int) *EmbeddingService {
+	client := llm.New(llm.Options{Provider: config.ProviderHash, Dimensions: dimensions})
+	return &EmbeddingService{
+		route: &llm.Route{Task: config.TaskEmbedding, Targets: []llm.Target{{Client: client, Provider: config.ProviderHash, Model: "hash"}}},
+		model: "hash",
+	}
+}
+
+func TestEmbeddingServiceWithHashProvider(t *testing.T) {
+	service := hashEmbeddingService(64)
+	texts := []string{"黑色 iPhone 15 Pro", "Sony WH-1000XM5 降噪耳机", "红色连衣裙"}
+
+	variants, err := service.GetProductVariantEmbeddings(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("GetProductVariantEmbeddings: %v", err)
+	}
+	for i, variant := range variants {
+		if variant.ID != fmt.Sprintf("variant_%d", i) || variant.Text != texts[i] {
+			t.Errorf("variant %d = %+v", i, variant)
+		}
+		if !reflect.DeepEqual(variant.Vector, llm.HashEmbedding(texts[i], 64)) {
+			t.Errorf("variant %d vector differs from llm.HashEmbedding", i)
+		}
+	}
+
+	// 分批结果与一次请求一致
+	batched, err := service.BatchEmbedding(context.Background(), texts, 2)
+	if err != nil {
+		t.Fatalf("BatchEmbedding: %v", err)
+	}
+	for i := range texts {
+		if !reflect.DeepEqual(batched[i], variants[i].Vector) {
+			t.Errorf("batched embedding %d differs", i)
+		}
+	}
+
+	if _, err := service.GetEmbeddings(context.Background(), nil); err == nil {
+		t.Errorf("empty input should be rejected")
+	}
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"search-ec2/internal/config"
+	"search-ec2/internal/models"
+	"sort"
+	"strings"
+
+	"github.com/qdrant/go-client/qdrant"
+	"github.com/sirupsen/logrus"
+)
+
+// 分面统计
+// 统计范围是满足过滤条件的商品（每个商品只统计首个变体），与搜索响应中的 total 口径一致，不考虑相似度阈值。
+// 优先使用 Qdrant 的 Facet API；该 API 不可用（旧版本 Qdrant、字段没有索引）时退化为有上限的滚动扫描。
+
+// defaultFacetScanLimit 退化扫描时最多读取的商品数
+const defaultFacetScanLimit = 10000
+
+// productFilter 构建只匹配每个商品当前一代首个变体的 qdrant.Filter
+// 重新生成变体时新一代在旧一代清理完成前标记为非当前（见 InsertProduct），每个商品只会匹配一个点
+func productFilter(filter *models.Filter) (*qdrant.Filter, error) {
+	qdrantFilter, err := buildQdrantFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if qdrantFilter == nil {
+		qdrantFilter = &qdrant.Filter{}
+	}
+	qdrantFilter.Must = append(qdrantFilter.Must, qdrant.NewMatchInt("variant_index", 0))
+	qdrantFilter.MustNot = append(qdrantFilter.MustNot, qdrant.NewMatchBool(currentGenerationField, false))
+	return qdrantFilter, nil
+}
+
+// FacetCounts 统计各字段取值的商品数量，每个字段最多返回 limit 个取值（按数量降序）
+func (s *QdrantService) FacetCounts(filter *models.Filter, fields []string, limit int) (map[string][]models.FacetValue, error) {
+	if err := s.ensureInitialized(); err != nil {
+		return nil, err
+	}
+
+	qdrantFilter, err := productFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	result := make(map[string][]models.FacetValue, len(fields))
+	fallback := make([]string, 0)
+
+	for _, field := range fields {
+		hits, err := s.client.Facet(ctx, &qdrant.FacetCounts{
+			CollectionName: s.collectionName,
+			Key:            models.AttributeFilterKey(field),
+			Filter:         qdrantFilter,
+			Limit:          qdrant.PtrOf(uint64(limit)),
+			Exact:          qdrant.PtrOf(true),
+		})
+		if err != nil {
+			logrus.Warnf("Facet API failed for %s, falling back to scan: %v", field, err)
+			fallback = append(fallback, field)
+			continue
+		}
+
+		values := make([]models.FacetValue, 0, len(hits))
+		for _, hit := range hits {
+			values = append(values, models.FacetValue{
+				Value: facetValueToInterface(hit.GetValue()),
+				Count: int(hit.GetCount()),
+			})
+		}
+		result[field] = values
+	}
+
+	if len(fallback) > 0 {
+		scanned, err := s.scanFacetCounts(ctx, qdrantFilter, fallback, limit)
+		if err != nil {
+			return nil, err
+		}
+		for field, values := range scanned {
+			result[field] = values
+		}
+	}
+
+	return result, nil
+}
+
+// scanFacetCounts 滚动读取商品并在本地统计取值，最多读取 search.facet_scan_limit 个商品
+func (s *QdrantService) scanFacetCounts(ctx context.Context, filter *qdrant.Filter, fields []string, limit int) (map[string][]models.FacetValue, error) {
+	scanLimit := config.AppConfig.Search.FacetScanLimit
+	if scanLimit <= 0 {
+		scanLimit = defaultFacetScanLimit
+	}
+
+	paths := make([]string, 0, len(fields))
+	for _, field := range fields {
+		paths = append(paths, models.AttributeFilterKey(field))
+	}
+
+	counts := make(map[string]map[string]*models.FacetValue, len(fields))
+	for _, field := range fields {
+		counts[field] = make(map[string]*models.FacetValue)
+	}
+
+	scanned := 0
+	var offset *qdrant.PointId
+	for scanned < scanLimit {
+		batch := scanLimit - scanned
+		if batch > 256 {
+			batch = 256
+		}
+
+		points, nextOffset, err := s.client.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+			CollectionName: s.collectionName,
+			Filter:         filter,
+			Limit:          qdrant.PtrOf(uint32(batch)),
+			Offset:         offset,
+			WithPayload:    qdrant.NewWithPayloadInclude(paths...),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan facet values: %w", err)
+		}
+
+		for _, point := range points {
+			for i, field := range fields {
+				for _, value := range facetValuesAt(point.Payload, paths[i]) {
+					key := fmt.Sprintf("%T:%v", value, value)
+					if counter, ok := counts[field][key]; ok {
+						counter.Count++
+					} else {
+						counts[field][key] = &models.FacetValue{Value: value, Count: 1}
+					}
+				}
+			}
+		}
+		scanned += len(points)
+
+		if nextOffset == nil {
+			break
+		}
+		offset = nextOffset
+	}
+
+	if scanned >= scanLimit {
+		logrus.Warnf("Facet scan stopped at %d products, counts are partial", scanLimit)
+	}
+
+	result := make(map[string][]models.FacetValue, len(fields))
+	for _, field := range fields {
+		values := make([]models.FacetValue, 0, len(counts[field]))
+		for _, counter := range counts[field] {
+			values = append(values, *counter)
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if values[i].Count != values[j].Count {
+				return values[i].Count > values[j].Count
+			}
+			return fmt.Sprint(values[i].Value) < fmt.Sprint(values[j].Value)
+		})
+		if len(values) > limit {
+			values = values[:limit]
+		}
+		result[field] = values
+	}
+	return result, nil
+}
+
+// facetValuesAt 读取 payload 中指定路径（支持 a.b 嵌套）的取值，数组展开为多个取值
+func facetValuesAt(payload map[string]*qdrant.Value, path string) []interface{} {
+	parts := strings.Split(path, ".")
+	value := payload[parts[0]]
+	for _, part := range parts[1:] {
+		value = value.GetStructValue().GetFields()[part]
+	}
+	if value == nil {
+		return nil
+	}
+
+	if list := value.GetListValue(); list != nil {
+		values := make([]interface{}, 0, len(list.GetValues()))
+		for _, item := range list.GetValues() {
+			if v := valueToInterface(item); v != nil {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+
+	if v := valueToInterface(value); v != nil {
+		return []interface{}{v}
+	}
+	return nil
+}
+
+// facetValueToInterface 将 qdrant.FacetValue 转换为 Go 值
+func facetValueToInterface(value *qdrant.FacetValue) interface{} {
+	switch v := value.GetVariant().(type) {
+	case *qdrant.FacetValue_StringValue:
+		return v.StringValue
+	case *qdrant.FacetValue_IntegerValue:
+		return v.IntegerValue
+	case *qdrant.FacetValue_BoolValue:
+		return v.BoolValue
+	}
+	return nil
+}
+
+// PriceBucketCounts 按价格分段统计商品数量
+// bounds 为递增的分段边界，例如 [100, 300, 500] 生成 <100、100-300、300-500、>=500 四个区间（左闭右开）
+func (s *QdrantService) PriceBucketCounts(filter *models.Filter, bounds []float64) ([]models.PriceBucket, error) {
+	if err := s.ensureInitialized(); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	buckets := make([]models.PriceBucket, 0, len(bounds)+1)
+
+	for i := 0; i <= len(bounds); i++ {
+		bucket := models.PriceBucket{}
+		priceRange := &qdrant.Range{}
+		if i > 0 {
+			bucket.From = &bounds[i-1]
+			priceRange.Gte = &bounds[i-1]
+		}
+		if i < len(bounds) {
+			bucket.To = &bounds[i]
+			priceRange.Lt = &bounds[i]
+		}
+
+		qdrantFilter, err := productFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		qdrantFilter.Must = append(qdrantFilter.Must, qdrant.NewRange("price", priceRange))
+
+		count, err := s.client.Count(ctx, &qdrant.CountPoints{
+			CollectionName: s.collectionName,
+			Filter:         qdrantFilter,
+			Exact:          qdrant.PtrOf(true),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to count price bucket: %w", err)
+		}
+
+		bucket.Count = int(count)
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, nil
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"fmt"
+	"search-ec2/internal/models"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// buildQdrantFilter 将过滤条件 DSL 转换为 qdrant.Filter
+// 搜索与分页浏览共用此转换，保证两者过滤语义一致
+func buildQdrantFilter(filter *models.Filter) (*qdrant.Filter, error) {
+	if filter.IsEmpty() {
+		return nil, nil
+	}
+
+	if err := filter.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+
+	return convertFilter(filter)
+}
+
+// convertFilter 递归转换布尔组合
+func convertFilter(filter *models.Filter) (*qdrant.Filter, error) {
+	result := &qdrant.Filter{}
+
+	var err error
+	if result.Must, err = convertConditions(filter.Must); err != nil {
+		return nil, err
+	}
+	if result.Should, err = convertConditions(filter.Should); err != nil {
+		return nil, err
+	}
+	if result.MustNot, err = convertConditions(filter.MustNot); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// convertConditions 批量转换条件
+func convertConditions(conditions []models.Condition) ([]*qdrant.Condition, error) {
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	result := make([]*qdrant.Condition, 0, len(conditions))
+	for _, cond := range conditions {
+		converted, err := convertCondition(cond)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, converted)
+	}
+	return result, nil
+}
+
+// convertCondition 转换单个条件
+func convertCondition(cond models.Condition) (*qdrant.Condition, error) {
+	switch {
+	case cond.Filter != nil:
+		nested, err := convertFilter(cond.Filter)
+		if err != nil {
+			return nil, err
+		}
+		if cond.Key != "" {
+			// 作用于对象数组字段的嵌套过滤
+			return qdrant.NewNestedFilter(cond.Key, nested), nil
+		}
+		return qdrant.NewFilterAsCondition(nested), nil
+
+	case cond.Range != nil:
+		return qdrant.NewRange(cond.Key, &qdrant.Range{
+			Gt:  cond.Range.Gt,
+			Gte: cond.Range.Gte,
+			Lt:  cond.Range.Lt,
+			Lte: cond.Range.Lte,
+		}), nil
+
+	case cond.Exists != nil:
+		if *cond.Exists {
+			return qdrant.NewFilterAsCondition(&qdrant.Filter{
+				MustNot: []*qdrant.Condition{qdrant.NewIsEmpty(cond.Key)},
+			}), nil
+		}
+		return qdrant.NewIsEmpty(cond.Key), nil
+
+	case cond.Match != nil:
+		return convertMatch(cond.Key, cond.Match)
+	}
+
+	return nil, fmt.Errorf("empty condition on %q", cond.Key)
+}
+
+// convertMatch 转换匹配条件，按值类型选择关键字 / 整数 / 布尔匹配
+func convertMatch(key string, match *models.MatchValue) (*qdrant.Condition, error) {
+	if match.Value != nil {
+		switch v := match.Value.(type) {
+		case string:
+			return qdrant.NewMatchKeyword(key, v), nil
+		case bool:
+			return qdrant.NewMatchBool(key, v), nil
+		}
+		n, ok := toInt64(match.Value)
+		if !ok {
+			return nil, fmt.Errorf("unsupported match value %v on %q", match.Value, key)
+		}
+		return qdrant.NewMatchInt(key, n), nil
+	}
+
+	values := match.Any
+	except := len(match.Except) > 0
+	if except {
+		values = match.Except
+	}
+
+	keywords, ints, err := splitMatchValues(key, values)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case except && keywords != nil:
+		return qdrant.NewMatchExceptKeywords(key, keywords...), nil
+	case except:
+		return qdrant.NewMatchExceptInts(key, ints...), nil
+	case keywords != nil:
+		return qdrant.NewMatchKeywords(key, keywords...), nil
+	default:
+		return qdrant.NewMatchInts(key, ints...), nil
+	}
+}
+
+// splitMatchValues 将多值匹配拆分为字符串或整数列表，不允许混用
+func splitMatchValues(key string, values []interface{}) ([]string, []int64, error) {
+	var keywords []string
+	var ints []int64
+
+	for _, value := range values {
+		if str, ok := value.(string); ok {
+			keywords = append(keywords, str)
+			continue
+		}
+		n, ok := toInt64(value)
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported match value %v on %q", value, key)
+		}
+		ints = append(ints, n)
+	}
+
+	if keywords != nil && ints != nil {
+		return nil, nil, fmt.Errorf("cannot mix strings and integers in match on %q", key)
+	}
+	return keywords, ints, nil
+}
+
+// toInt64 将整数或整数值的浮点数转换为 int64
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
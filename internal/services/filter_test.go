@@ -0,0 +1,150 @@
+package services
+
+import (
+	"reflect"
+	"search-ec2/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestBuildQdrantFilterEmpty(t *testing.T) {
+	for _, filter := range []*models.Filter{nil, {}} {
+		got, err := buildQdrantFilter(filter)
+		if err != nil || got != nil {
+			t.Errorf("buildQdrantFilter(%+v) = %v, %v; want nil, nil", filter, got, err)
+		}
+	}
+}
+
+func TestBuildQdrantFilterMatch(t *testing.T) {
+	filter := &models.Filter{Must: []models.Condition{
+		models.NewMatchCondition("brand", "Nike"),
+		models.NewMatchCondition("attributes.waterproof", true),
+		models.NewMatchCondition("attributes.storage_gb", float64(256)), // JSON 数字
+		models.NewMatchAnyCondition("color", "红色", "黑色"),
+		models.NewMatchAnyCondition("size", 38, 39),
+		{Key: "status", Match: &models.MatchValue{Except: []interface{}{"deleted"}}},
+		{Key: "year", Match: &models.MatchValue{Except: []interface{}{2020}}},
+	}}
+
+	got, err := buildQdrantFilter(filter)
+	if err != nil {
+		t.Fatalf("buildQdrantFilter: %v", err)
+	}
+	must := got.GetMust()
+	if len(must) != 7 {
+		t.Fatalf("got %d conditions, want 7", len(must))
+	}
+
+	match := func(i int) *qdrant.Match { return must[i].GetField().GetMatch() }
+	if key := must[0].GetField().GetKey(); key != "brand" || match(0).GetKeyword() != "Nike" {
+		t.Errorf("keyword match = %v", must[0])
+	}
+	if !match(1).GetBoolean() {
+		t.Errorf("bool match = %v", must[1])
+	}
+	if match(2).GetInteger() != 256 {
+		t.Errorf("integer match = %v", must[2])
+	}
+	if got := match(3).GetKeywords().GetStrings(); !reflect.DeepEqual(got, []string{"红色", "黑色"}) {
+		t.Errorf("keywords match = %v", got)
+	}
+	if got := match(4).GetIntegers().GetIntegers(); !reflect.DeepEqual(got, []int64{38, 39}) {
+		t.Errorf("integers match = %v", got)
+	}
+	if got := match(5).GetExceptKeywords().GetStrings(); !reflect.DeepEqual(got, []string{"deleted"}) {
+		t.Errorf("except keywords = %v", got)
+	}
+	if got := match(6).GetExceptIntegers().GetIntegers(); !reflect.DeepEqual(got, []int64{2020}) {
+		t.Errorf("except integers = %v", got)
+	}
+}
+
+func TestBuildQdrantFilterRangeExistsAndGroups(t *testing.T) {
+	filter := &models.Filter{
+		Must: []models.Condition{
+			models.NewRangeCondition("price", floatPtr(100), floatPtr(500)),
+			models.NewExistsCondition("image_urls", true),
+		},
+		Should: []models.Condition{
+			models.NewGroupCondition(&models.Filter{Must: []models.Condition{models.NewMatchCondition("brand", "Nike")}}),
+		},
+		MustNot: []models.Condition{
+			models.NewExistsCondition("description", false),
+			{Key: "reviews", Filter: &models.Filter{Must: []models.Condition{models.NewRangeCondition("rating", nil, floatPtr(2))}}},
+		},
+	}
+
+	got, err := buildQdrantFilter(filter)
+	if err != nil {
+		t.Fatalf("buildQdrantFilter: %v", err)
+	}
+
+	r := got.GetMust()[0].GetField().GetRange()
+	if r.GetGte() != 100 || r.GetLte() != 500 || r.Gt != nil || r.Lt != nil {
+		t.Errorf("range = %v", r)
+	}
+
+	// exists=true 表示“非空”，转换为对 IsEmpty 的取反
+	exists := got.GetMust()[1].GetFilter()
+	if len(exists.GetMustNot()) != 1 || exists.GetMustNot()[0].GetIsEmpty().GetKey() != "image_urls" {
+		t.Errorf("exists = %v", got.GetMust()[1])
+	}
+	if got.GetMustNot()[0].GetIsEmpty().GetKey() != "description" {
+		t.Errorf("not exists = %v", got.GetMustNot()[0])
+	}
+
+	group := got.GetShould()[0].GetFilter()
+	if group.GetMust()[0].GetField().GetMatch().GetKeyword() != "Nike" {
+		t.Errorf("group = %v", got.GetShould()[0])
+	}
+
+	nested := got.GetMustNot()[1].GetNested()
+	if nested.GetKey() != "reviews" || nested.GetFilter().GetMust()[0].GetField().GetRange().GetLte() != 2 {
+		t.Errorf("nested = %v", got.GetMustNot()[1])
+	}
+}
+
+func TestBuildQdrantFilterErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		filter  *models.Filter
+		wantErr string
+	}{
+		{"invalid", &models.Filter{Must: []models.Condition{{Key: "price"}}}, "invalid filter"},
+		{"mixed any", &models.Filter{Must: []models.Condition{models.NewMatchAnyCondition("size", "M", 38)}}, "cannot mix strings and integers"},
+	}
+	for _, tc := range cases {
+		_, err := buildQdrantFilter(tc.filter)
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: error = %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestProductFilter(t *testing.T) {
+	for _, filter := range []*models.Filter{nil, {Must: []models.Condition{models.NewMatchCondition("brand", "Nike")}}} {
+		got, err := productFilter(filter)
+		if err != nil {
+			t.Fatalf("productFilter: %v", err)
+		}
+
+		must := got.GetMust()
+		last := must[len(must)-1].GetField()
+		if last.GetKey() != "variant_index" || last.GetMatch().GetInteger() != 0 {
+			t.Errorf("missing variant_index=0 in %v", must)
+		}
+		// 旧数据没有 current 字段，只排除明确标记为非当前代的点
+		notCurrent := got.GetMustNot()
+		if len(notCurrent) != 1 || notCurrent[0].GetField().GetKey() != currentGenerationField || notCurrent[0].GetField().GetMatch().GetBoolean() {
+			t.Errorf("must_not = %v, want current=false", notCurrent)
+		}
+		if filter != nil && len(must) != 2 {
+			t.Errorf("caller conditions dropped: %v", must)
+		}
+	}
+}
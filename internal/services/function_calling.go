@@ -1,40 +1,115 @@
 package services
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"search-ec2/internal/config"
+	"search-ec2/internal/llm"
 	"search-ec2/internal/models"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// 查询解析的结构化输出方式
+const (
+	StructuredOutputTools      = "tools"       // tools + tool_choice
+	StructuredOutputJSONSchema = "json_schema" // response_format: json_schema
+	StructuredOutputFunctions  = "functions"   // 已废弃的 functions + function_call
+)
+
+// defaultStructuredOutputModes 协议未配置 structured_output 时的尝试顺序
+// anthropic / bedrock 的适配器把各种方式都转换为 tool_use，已废弃的 functions 没有必要再试
+func defaultStructuredOutputModes(provider string) []string {
+	if provider == config.ProviderOpenAI {
+		return []string{StructuredOutputTools, StructuredOutputJSONSchema, StructuredOutputFunctions}
+	}
+	return []string{StructuredOutputTools, StructuredOutputJSONSchema}
+}
+
+// structuredOutputParams 各方式使用的请求字段，网关的 400 错误信息提到这些字段时视为不支持该方式
+var structuredOutputParams = map[string][]string{
+	StructuredOutputTools:      {"tools", "tool_choice", "tool choice"},
+	StructuredOutputJSONSchema: {"response_format", "json_schema"},
+	StructuredOutputFunctions:  {"functions", "function_call"},
+}
+
+// modeDemotionTTL 不支持的方式被跳过的时长，过期后重新从首选方式开始尝试（网关可能已升级）
+const modeDemotionTTL = 30 * time.Minute
+
+var (
+	// errNoStructuredOutput 响应中没有所选方式对应的输出（网关忽略了 tools / response_format 等字段）
+	errNoStructuredOutput = errors.New("no structured output in response")
+	// errInvalidArguments 模型返回的参数不是合法 JSON 或不符合 schema
+	errInvalidArguments = errors.New("invalid function arguments")
+)
+
 // FunctionCallingService Function Calling 解析服务
 type FunctionCallingService struct {
-	client  *http.Client
-	baseURL string
-	apiKey  string
-	model   string
+	parse       *llm.Route              // 查询解析使用的模型（models.parse）
+	suggestions *llm.Route              // 搜索建议使用的模型（models.suggestions）
+	modes       map[string]*outputModes // 按协议的结构化输出方式（providers.<name>.structured_output）
+}
+
+// outputModes 单个协议的结构化输出方式及跳过状态
+type outputModes struct {
+	modes     []string     // 结构化输出方式，按顺序尝试
+	start     atomic.Int32 // 首选方式的下标，网关明确不支持的方式在 modeDemotionTTL 内不再尝试
+	demotedAt atomic.Int64 // 最近一次跳过方式的时间（UnixNano）
 }
 
 // NewFunctionCallingService 创建 Function Calling 服务
 func NewFunctionCallingService() *FunctionCallingService {
+	parse := llm.NewRoute(config.TaskParse)
 	return &FunctionCallingService{
-		client: &http.Client{
-			Timeout: time.Duration(config.AppConfig.OpenAI.Timeout) * time.Second,
-		},
-		baseURL: config.AppConfig.OpenAI.BaseURL,
-		apiKey:  config.AppConfig.OpenAI.APIKey,
-		model:   config.AppConfig.OpenAI.ChatModel,
+		parse:       parse,
+		suggestions: llm.NewRoute(config.TaskSuggestions),
+		modes:       routeOutputModes(parse),
+	}
+}
+
+// routeOutputModes 为路由中的每个协议读取结构化输出方式
+func routeOutputModes(route *llm.Route) map[string]*outputModes {
+	result := make(map[string]*outputModes)
+	for _, target := range route.Targets {
+		if _, ok := result[target.Provider]; !ok {
+			configured := config.AppConfig.OpenAI.Provider(target.Provider).StructuredOutput
+			result[target.Provider] = &outputModes{modes: structuredOutputModes(target.Provider, configured)}
+		}
 	}
+	return result
 }
 
-// ParseQuery 解析用户查询意图
-func (s *FunctionCallingService) ParseQuery(query string) (*models.ParsedQuery, error) {
+// structuredOutputModes 规范化协议配置的结构化输出方式，忽略未知和重复的值
+func structuredOutputModes(provider string, configured []string) []string {
+	modes := make([]string, 0, len(configured))
+	seen := make(map[string]bool)
+	for _, mode := range configured {
+		mode = strings.ToLower(strings.TrimSpace(mode))
+		switch mode {
+		case StructuredOutputTools, StructuredOutputJSONSchema, StructuredOutputFunctions:
+			if !seen[mode] {
+				seen[mode] = true
+				modes = append(modes, mode)
+			}
+		default:
+			logrus.Warnf("Unknown structured output mode %q for provider %s ignored", mode, provider)
+		}
+	}
+	if len(modes) == 0 {
+		return defaultStructuredOutputModes(provider)
+	}
+	return modes
+}
+
+// ParseQuery 解析用户查询意图，ctx 结束时停止等待和重试
+// 对模型链中的每个模型，按其协议配置的结构化输出方式依次尝试：请求被拒绝（400）、响应中没有对应输出或参数不符合 schema 时换下一种方式；
+// 限流、鉴权、上游故障或所有方式都失败时换备用模型
+func (s *FunctionCallingService) ParseQuery(ctx context.Context, query string) (*models.ParsedQuery, error) {
 	// 构建系统提示
 	systemPrompt := `你是一个专业的商品搜索查询解析助手。你需要分析用户的自然语言查询，提取出商品类型、属性和过滤条件。
 
@@ -48,118 +123,248 @@ func (s *FunctionCallingService) ParseQuery(query string) (*models.ParsedQuery,
 	// 构建用户消息
 	userMessage := fmt.Sprintf("请解析这个商品搜索查询：%s", query)
 
-	// 构建 Function 定义
-	function := models.OpenAIFunction{
-		Name:        config.FunctionSchema.FunctionName,
-		Description: config.FunctionSchema.Description,
-		Parameters:  config.FunctionSchema.Parameters,
-	}
-
-	// 构建请求
-	request := models.OpenAIRequest{
-		Model: s.model,
-		Messages: []models.OpenAIMessage{
-			{
-				Role:    "system",
-				Content: systemPrompt,
-			},
-			{
-				Role:    "user",
-				Content: userMessage,
-			},
+	messages := []models.OpenAIMessage{
+		{
+			Role:    "system",
+			Content: systemPrompt,
 		},
-		Functions: []models.OpenAIFunction{function},
-		FunctionCall: map[string]string{
-			"name": config.FunctionSchema.FunctionName,
+		{
+			Role:    "user",
+			Content: userMessage,
 		},
-		MaxTokens:   config.AppConfig.OpenAI.MaxTokens,
-		Temperature: 0.1, // 低温度确保一致性
 	}
 
-	// 发送请求
-	response, err := s.sendChatRequest(request)
+	schema := config.FunctionSchema
+	if prompt := filtersPrompt(schema); prompt != "" {
+		messages[0].Content += "\n\n" + prompt
+	}
+
+	var parsedQuery *models.ParsedQuery
+	err := s.parse.Each(ctx, func(ctx context.Context, target llm.Target) error {
+		var err error
+		parsedQuery, err = s.parseWithTarget(ctx, target, schema, messages)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to send chat request: %w", err)
+		return nil, err
 	}
+	return parsedQuery, nil
+}
 
-	// 解析 Function Call 结果
-	if len(response.Choices) == 0 {
-		return nil, fmt.Errorf("no response choices returned")
+// parseWithTarget 使用模型链中的一个模型解析查询，按该模型协议的结构化输出方式依次尝试
+func (s *FunctionCallingService) parseWithTarget(
+	ctx context.Context,
+	target llm.Target,
+	schema *config.FunctionCallingSchema,
+	messages []models.OpenAIMessage,
+) (*models.ParsedQuery, error) {
+	state := s.outputModes(target.Provider)
+
+	var lastErr error
+	for i := state.startMode(); i < len(state.modes); i++ {
+		mode := state.modes[i]
+		parsedQuery, err := s.parseWithMode(ctx, target, mode, schema, messages)
+		if err == nil {
+			logrus.Debugf("Parsed query (%s/%s): %+v", target.Provider, mode, parsedQuery)
+			return parsedQuery, nil
+		}
+
+		if !errors.Is(err, llm.ErrBadRequest) &&
+			!errors.Is(err, errNoStructuredOutput) &&
+			!errors.Is(err, errInvalidArguments) {
+			return nil, fmt.Errorf("failed to send chat request: %w", err)
+		}
+		// 网关明确表示不支持的方式在一段时间内直接跳过；其他 400（如单个查询触发的错误）只影响本次请求
+		if rejectsMode(mode, err) && i < len(state.modes)-1 {
+			state.demotedAt.Store(time.Now().UnixNano())
+			if state.start.CompareAndSwap(int32(i), int32(i+1)) {
+				logrus.Warnf("Structured output mode %s is not supported by %s, using %s for the next %v",
+					mode, target.Provider, state.modes[i+1], modeDemotionTTL)
+			}
+		}
+		logrus.Warnf("Query parsing with %s/%s failed: %v", target.Provider, mode, err)
+		lastErr = err
 	}
 
-	choice := response.Choices[0]
-	if choice.Message.FunctionCall == nil {
-		return nil, fmt.Errorf("no function call in response")
+	return nil, fmt.Errorf("all structured output modes failed: %w", lastErr)
+}
+
+// outputModes 协议的结构化输出方式，路由之外的协议使用默认顺序
+func (s *FunctionCallingService) outputModes(provider string) *outputModes {
+	if state, ok := s.modes[provider]; ok {
+		return state
 	}
+	return &outputModes{modes: defaultStructuredOutputModes(provider)}
+}
 
-	// 解析参数
-	var parsedQuery models.ParsedQuery
-	if err := json.Unmarshal([]byte(choice.Message.FunctionCall.Arguments), &parsedQuery); err != nil {
-		return nil, fmt.Errorf("failed to parse function arguments: %w", err)
+// startMode 本次解析从哪种方式开始尝试，跳过超过 modeDemotionTTL 后恢复首选方式
+func (m *outputModes) startMode() int {
+	start := m.start.Load()
+	if start > 0 && time.Since(time.Unix(0, m.demotedAt.Load())) > modeDemotionTTL {
+		if m.start.CompareAndSwap(start, 0) {
+			logrus.Infof("Retrying structured output mode %s", m.modes[0])
+		}
+		return 0
 	}
+	return int(start)
+}
 
-	logrus.Debugf("Parsed query: %+v", parsedQuery)
-	return &parsedQuery, nil
+// rejectsMode 判断错误是否表示网关不支持该方式：400 且错误信息提到了该方式使用的请求字段
+func rejectsMode(mode string, err error) bool {
+	var apiErr *llm.APIError
+	if !errors.As(err, &apiErr) || !errors.Is(apiErr, llm.ErrBadRequest) {
+		return false
+	}
+	message := strings.ToLower(apiErr.Message)
+	for _, param := range structuredOutputParams[mode] {
+		if strings.Contains(message, param) {
+			return true
+		}
+	}
+	return false
 }
 
-// sendChatRequest 发送聊天请求
-func (s *FunctionCallingService) sendChatRequest(request models.OpenAIRequest) (*models.OpenAIResponse, error) {
-	// 序列化请求
-	requestBody, err := json.Marshal(request)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+// filtersPrompt schema 声明了 filters 时，在系统提示中列出可以放入 filters 的已注册可过滤属性
+func filtersPrompt(schema *config.FunctionCallingSchema) string {
+	properties, _ := schema.Parameters["properties"].(map[string]interface{})
+	if _, ok := properties["filters"]; !ok {
+		return ""
 	}
 
-	// 创建 HTTP 请求
-	url := fmt.Sprintf("%s/chat/completions", s.baseURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	lines := make([]string, 0)
+	for _, attr := range config.AttributeRegistry().Attributes {
+		if _, ok := properties[attr.Name]; ok || !attr.Filterable {
+			continue // 已有独立参数的属性不重复列出
+		}
+		line := fmt.Sprintf("- %s（%s）", attr.Name, attr.Type)
+		if attr.Description != "" {
+			line += "：" + attr.Description
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return "查询中提到以下属性时放入 filters（键为属性名）：精确值直接填写，多个可选值用数组，" +
+		"数值范围用 {\"gte\": 最小值, \"lte\": 最大值}。\n" + strings.Join(lines, "\n")
+}
+
+// parseWithMode 使用指定的结构化输出方式解析查询，并按 schema 严格校验返回的参数
+func (s *FunctionCallingService) parseWithMode(
+	ctx context.Context,
+	target llm.Target,
+	mode string,
+	schema *config.FunctionCallingSchema,
+	messages []models.OpenAIMessage,
+) (*models.ParsedQuery, error) {
+	function := models.OpenAIFunction{
+		Name:        schema.FunctionName,
+		Description: schema.Description,
+		Parameters:  schema.Parameters,
+	}
+
+	request := models.OpenAIRequest{
+		Model:       target.Model,
+		Messages:    messages,
+		MaxTokens:   config.AppConfig.OpenAI.MaxTokens,
+		Temperature: 0.1, // 低温度确保一致性
 	}
 
-	// 设置请求头
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.apiKey))
+	switch mode {
+	case StructuredOutputTools:
+		request.Tools = []models.OpenAITool{{Type: "function", Function: function}}
+		request.ToolChoice = map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": function.Name},
+		}
+	case StructuredOutputJSONSchema:
+		// 严格校验在本地完成，不要求上游开启 strict（strict 要求所有字段必填）
+		request.ResponseFormat = &models.OpenAIResponseFormat{
+			Type: "json_schema",
+			JSONSchema: &models.OpenAIJSONSchema{
+				Name:        function.Name,
+				Description: function.Description,
+				Schema:      function.Parameters,
+			},
+		}
+	default:
+		request.Functions = []models.OpenAIFunction{function}
+		request.FunctionCall = map[string]string{"name": function.Name}
+	}
 
-	// 发送请求
-	logrus.Debugf("Sending function calling request")
-	resp, err := s.client.Do(req)
+	logrus.Debugf("Sending %s request to %s/%s", s.parse.Task, target.Provider, target.Model)
+	response, err := target.ChatCompletion(ctx, &request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// 读取响应
-	responseBody, err := io.ReadAll(resp.Body)
+	arguments, err := structuredArguments(mode, function.Name, response)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, err
+	}
+
+	// 严格校验参数
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidArguments, err)
+	}
+	if err := schema.ValidateArguments(raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidArguments, err)
+	}
+
+	var parsedQuery models.ParsedQuery
+	if err := json.Unmarshal([]byte(arguments), &parsedQuery); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidArguments, err)
 	}
+	return &parsedQuery, nil
+}
 
-	// 检查 HTTP 状态码
-	if resp.StatusCode != http.StatusOK {
-		logrus.Errorf("OpenAI API error: %s", string(responseBody))
-		return nil, fmt.Errorf("OpenAI API error: status %d", resp.StatusCode)
+// structuredArguments 从响应中取出结构化输出的 JSON 文本
+// 部分网关会把 tools 请求以 function_call 形式返回，两种字段都接受
+func structuredArguments(mode, functionName string, response *models.OpenAIResponse) (string, error) {
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("%w: no response choices returned", errNoStructuredOutput)
+	}
+	message := response.Choices[0].Message
+
+	if mode == StructuredOutputJSONSchema {
+		content := strings.TrimSpace(message.Content)
+		content = strings.TrimPrefix(content, "```json")
+		content = strings.Trim(content, "` \n")
+		if content == "" {
+			return "", fmt.Errorf("%w: empty content", errNoStructuredOutput)
+		}
+		return content, nil
 	}
 
-	// 解析响应
-	var response models.OpenAIResponse
-	if err := json.Unmarshal(responseBody, &response); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	for _, call := range message.ToolCalls {
+		if call.Function.Name == functionName {
+			return call.Function.Arguments, nil
+		}
+	}
+	if message.FunctionCall != nil && message.FunctionCall.Name == functionName {
+		return message.FunctionCall.Arguments, nil
 	}
+	return "", fmt.Errorf("%w: no call to %s", errNoStructuredOutput, functionName)
+}
 
-	// 检查 API 错误
-	if response.Error != nil {
-		return nil, fmt.Errorf("OpenAI API error: %s", response.Error.Message)
+// sendChatRequest 按任务的模型路由发送聊天请求（超时、重试和限流由共享的 LLM 客户端处理）
+func (s *FunctionCallingService) sendChatRequest(ctx context.Context, route *llm.Route, request models.OpenAIRequest) (*models.OpenAIResponse, error) {
+	logrus.Debugf("Sending %s request", route.Task)
+	response, err := route.ChatCompletion(ctx, &request)
+	if err != nil {
+		return nil, err
 	}
 
 	logrus.Debugf("Function calling completed, used %d tokens", response.Usage.TotalTokens)
-	return &response, nil
+	return response, nil
 }
 
 // HealthCheck 健康检查
 func (s *FunctionCallingService) HealthCheck() error {
 	// 尝试解析一个简单查询
-	_, err := s.ParseQuery("测试查询")
+	_, err := s.ParseQuery(context.Background(), "测试查询")
 	return err
 }
 
@@ -253,7 +458,7 @@ func (s *FunctionCallingService) EnhanceQuery(parsedQuery *models.ParsedQuery) *
 }
 
 // GetQuerySuggestions 获取查询建议
-func (s *FunctionCallingService) GetQuerySuggestions(query string) ([]string, error) {
+func (s *FunctionCallingService) GetQuerySuggestions(ctx context.Context, query string) ([]string, error) {
 	systemPrompt := `你是一个商品搜索建议助手。基于用户的部分查询，生成5个相关的完整搜索建议。
 
 要求：
@@ -267,7 +472,7 @@ func (s *FunctionCallingService) GetQuerySuggestions(query string) ([]string, er
 	userMessage := fmt.Sprintf("基于这个查询片段生成搜索建议：%s", query)
 
 	request := models.OpenAIRequest{
-		Model: s.model,
+		Model: s.suggestions.Model(),
 		Messages: []models.OpenAIMessage{
 			{
 				Role:    "system",
@@ -282,7 +487,7 @@ func (s *FunctionCallingService) GetQuerySuggestions(query string) ([]string, er
 		Temperature: 0.7,
 	}
 
-	response, err := s.sendChatRequest(request)
+	response, err := s.sendChatRequest(ctx, s.suggestions, request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get suggestions: %w", err)
 	}
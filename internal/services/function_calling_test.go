@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"search-ec2/internal/config"
+	"search-ec2/internal/llm"
+	"search-ec2/internal/models"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setupFunctionCalling 加载仓库中的 function_calling_schema.json，创建请求发往 handler 的解析服务
+func setupFunctionCalling(t *testing.T, handler http.HandlerFunc) *FunctionCallingService {
+	t.Helper()
+
+	data, err := os.ReadFile("../../config/function_calling_schema.json")
+	if err != nil {
+		t.Fatalf("read schema: %v", err)
+	}
+	schema := &config.FunctionCallingSchema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	if err := schema.Validate(); err != nil {
+		t.Fatalf("validate schema: %v", err)
+	}
+
+	previousConfig, previousSchema := config.AppConfig, config.FunctionSchema
+	config.AppConfig = &config.Config{}
+	config.FunctionSchema = schema
+	t.Cleanup(func() {
+		config.AppConfig, config.FunctionSchema = previousConfig, previousSchema
+	})
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := llm.New(llm.Options{
+		Provider:       config.ProviderOpenAI,
+		BaseURL:        server.URL,
+		APIKey:         "test-key",
+		MaxRetries:     -1,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+	})
+	parse := &llm.Route{Task: config.TaskParse, Targets: []llm.Target{{Client: client, Provider: config.ProviderOpenAI, Model: "test-model"}}}
+	return &FunctionCallingService{parse: parse, modes: routeOutputModes(parse)}
+}
+
+// toolCallResponse 以 tool_calls 返回 parse_product_query 调用
+func toolCallResponse(w http.ResponseWriter, arguments string) {
+	json.NewEncoder(w).Encode(models.OpenAIResponse{
+		Choices: []models.OpenAIChoice{{
+			Message: models.OpenAIMessage{
+				Role: "assistant",
+				ToolCalls: []models.OpenAIToolCall{{
+					ID:       "call_1",
+					Type:     "function",
+					Function: models.OpenAIFunctionCall{Name: "parse_product_query", Arguments: arguments},
+				}},
+			},
+			FinishReason: "tool_calls",
+		}},
+	})
+}
+
+func TestParseQueryToolCallWithFilters(t *testing.T) {
+	service := setupFunctionCalling(t, func(w http.ResponseWriter, r *http.Request) {
+		var request models.OpenAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		if len(request.Tools) != 1 {
+			t.Errorf("expected one tool, got %d", len(request.Tools))
+		}
+		toolCallResponse(w, `{"product_type":"登山鞋","brand":"Salomon","filters":{"waterproof":true,"weight_g":{"lte":500},"tags":["户外","徒步"]}}`)
+	})
+
+	parsed, err := service.ParseQuery(context.Background(), "500克以内的防水 Salomon 登山鞋")
+	if err != nil {
+		t.Fatalf("ParseQuery: %v", err)
+	}
+	if parsed.ProductType != "登山鞋" || parsed.Brand != "Salomon" {
+		t.Fatalf("unexpected parsed query: %+v", parsed)
+	}
+	if len(parsed.Filters) != 3 {
+		t.Fatalf("expected 3 filters, got %v", parsed.Filters)
+	}
+
+	conditions := make(map[string]models.Condition)
+	for _, cond := range parsed.ToFilter().Must {
+		conditions[cond.Key] = cond
+	}
+	if cond, ok := conditions["attributes.waterproof"]; !ok || cond.Match == nil || cond.Match.Value != true {
+		t.Errorf("waterproof condition = %+v", cond)
+	}
+	if cond, ok := conditions["attributes.weight_g"]; !ok || cond.Range == nil || cond.Range.Lte == nil || *cond.Range.Lte != 500 {
+		t.Errorf("weight_g condition = %+v", cond)
+	}
+	if cond, ok := conditions["tags"]; !ok || cond.Match == nil || len(cond.Match.Any) != 2 {
+		t.Errorf("tags condition = %+v", cond)
+	}
+}
+
+func TestParseQueryRejectsMalformedFilters(t *testing.T) {
+	service := setupFunctionCalling(t, func(w http.ResponseWriter, r *http.Request) {
+		toolCallResponse(w, `{"product_type":"登山鞋","filters":{"weight_g":{"between":[100,500]}}}`)
+	})
+
+	_, err := service.ParseQuery(context.Background(), "登山鞋")
+	if !errors.Is(err, errInvalidArguments) && !errors.Is(err, errNoStructuredOutput) {
+		t.Fatalf("expected schema validation failure, got %v", err)
+	}
+}
+
+func TestParseQueryDemotesOnlyUnsupportedModes(t *testing.T) {
+	var rejectTools atomic.Bool
+	var toolRequests atomic.Int32
+	service := setupFunctionCalling(t, func(w http.ResponseWriter, r *http.Request) {
+		var request models.OpenAIRequest
+		json.NewDecoder(r.Body).Decode(&request)
+
+		if len(request.Tools) > 0 {
+			toolRequests.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+			if rejectTools.Load() {
+				w.Write([]byte(`{"error":{"message":"Unrecognized request argument supplied: tools"}}`))
+			} else {
+				w.Write([]byte(`{"error":{"message":"This model's maximum context length is 8192 tokens"}}`))
+			}
+			return
+		}
+		json.NewEncoder(w).Encode(models.OpenAIResponse{
+			Choices: []models.OpenAIChoice{{Message: models.OpenAIMessage{Role: "assistant", Content: `{"product_type":"手机"}`}}},
+		})
+	})
+
+	// 与方式无关的 400 不影响之后的请求
+	for i := 0; i < 2; i++ {
+		if _, err := service.ParseQuery(context.Background(), "手机"); err != nil {
+			t.Fatalf("ParseQuery: %v", err)
+		}
+	}
+	state := service.modes[config.ProviderOpenAI]
+	if toolRequests.Load() != 2 || state.start.Load() != 0 {
+		t.Fatalf("generic 400 demoted tools: requests=%d start=%d", toolRequests.Load(), state.start.Load())
+	}
+
+	// 网关明确不支持 tools 时跳过该方式
+	rejectTools.Store(true)
+	for i := 0; i < 2; i++ {
+		if _, err := service.ParseQuery(context.Background(), "手机"); err != nil {
+			t.Fatalf("ParseQuery: %v", err)
+		}
+	}
+	if toolRequests.Load() != 3 || state.start.Load() != 1 {
+		t.Fatalf("unsupported tools not demoted: requests=%d start=%d", toolRequests.Load(), state.start.Load())
+	}
+
+	// 跳过过期后重新尝试首选方式
+	state.demotedAt.Store(time.Now().Add(-modeDemotionTTL - time.Minute).UnixNano())
+	if _, err := service.ParseQuery(context.Background(), "手机"); err != nil {
+		t.Fatalf("ParseQuery: %v", err)
+	}
+	if toolRequests.Load() != 4 {
+		t.Fatalf("expired demotion did not retry tools: requests=%d", toolRequests.Load())
+	}
+}
+
+func TestParseQueryUsesModesOfTargetProvider(t *testing.T) {
+	service := setupFunctionCalling(t, func(w http.ResponseWriter, r *http.Request) {
+		var request models.OpenAIRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		if request.ResponseFormat == nil || len(request.Tools) > 0 || len(request.Functions) > 0 {
+			t.Errorf("openai request should use only json_schema: %+v", request)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	var anthropicRequests atomic.Int32
+	anthropic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		anthropicRequests.Add(1)
+		w.Write([]byte(`{"id":"msg_1","model":"claude-test","stop_reason":"tool_use",
+			"content":[{"type":"tool_use","id":"toolu_1","name":"parse_product_query","input":{"product_type":"手机"}}]}`))
+	}))
+	t.Cleanup(anthropic.Close)
+
+	config.AppConfig.OpenAI.Providers = map[string]config.ProviderConfig{
+		config.ProviderOpenAI: {StructuredOutput: []string{"json_schema"}},
+	}
+	client := llm.New(llm.Options{Provider: config.ProviderAnthropic, BaseURL: anthropic.URL, APIKey: "test-key", MaxRetries: -1})
+	service.parse.Targets = append(service.parse.Targets, llm.Target{Client: client, Provider: config.ProviderAnthropic, Model: "claude-test"})
+	service.modes = routeOutputModes(service.parse)
+
+	if got := service.modes[config.ProviderAnthropic].modes; len(got) != 2 || got[0] != StructuredOutputTools || got[1] != StructuredOutputJSONSchema {
+		t.Errorf("anthropic modes = %v, want tools and json_schema", got)
+	}
+
+	parsed, err := service.ParseQuery(context.Background(), "手机")
+	if err != nil {
+		t.Fatalf("ParseQuery: %v", err)
+	}
+	if parsed.ProductType != "手机" || anthropicRequests.Load() != 1 {
+		t.Fatalf("parsed = %+v, anthropic requests = %d", parsed, anthropicRequests.Load())
+	}
+}
@@ -0,0 +1,582 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"search-ec2/internal/config"
+	"search-ec2/internal/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// 批量导入任务
+// 每个任务在任务目录下保存两个文件：
+//   - <id>.items.jsonl  入队时写入的商品数据，每行一个 ImportItem（商品 ID 在入队时分配）
+//   - <id>.json         任务状态，包含进度、错误以及已处理条目的位图
+// 服务重启后未结束的任务会自动继续，跳过位图中已处理的条目。
+// 位图定期落盘，重启时最多重复处理少量条目；点 ID 由商品 ID 确定性派生，重复处理只是覆盖写入。
+
+var (
+	// ErrImportJobNotFound 导入任务不存在
+	ErrImportJobNotFound = errors.New("import job not found")
+	// ErrImportJobState 任务当前状态不允许该操作
+	ErrImportJobState = errors.New("invalid import job state")
+	// ErrEmptyImport 导入数据中没有任何商品
+	ErrEmptyImport = errors.New("no products to import")
+)
+
+const (
+	defaultImportJobDir       = "data/import_jobs"
+	defaultImportWorkers      = 4
+	defaultImportVariantCount = 3 // 批量导入时减少变体数量
+
+	importPersistInterval = 20               // 每处理多少个条目落盘一次
+	importMaxLineSize     = 10 * 1024 * 1024 // 单个商品数据行的上限
+)
+
+// importJobRecord 持久化的任务状态
+type importJobRecord struct {
+	models.ImportJob
+	Done []byte `json:"done"` // 已处理条目位图
+}
+
+// importJobState 内存中的任务状态
+type importJobState struct {
+	record  importJobRecord
+	cancel  bool // 已请求取消
+	unsaved int  // 上次落盘后处理的条目数
+}
+
+// importWork 待处理的条目
+type importWork struct {
+	index int
+	item  models.ImportItem
+}
+
+// ImportJobManager 导入任务管理器
+// 任务按提交顺序逐个执行，单个任务内的条目由固定数量的 worker 并发处理
+type ImportJobManager struct {
+	dir          string
+	workers      int
+	variantCount int
+	indexer      func(ctx context.Context, product *models.Product, variantCount int) (*models.ProductUpsertResult, error)
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	jobs    map[string]*importJobState
+	pending []string
+	closed  bool
+}
+
+// NewImportJobManager 创建导入任务管理器，加载任务目录中的任务并继续未完成的任务
+func NewImportJobManager(indexer func(ctx context.Context, product *models.Product, variantCount int) (*models.ProductUpsertResult, error)) (*ImportJobManager, error) {
+	cfg := config.AppConfig.Import
+	m := &ImportJobManager{
+		dir:          cfg.JobDir,
+		workers:      cfg.Workers,
+		variantCount: cfg.VariantCount,
+		indexer:      indexer,
+		jobs:         make(map[string]*importJobState),
+	}
+	if m.dir == "" {
+		m.dir = defaultImportJobDir
+	}
+	if m.workers <= 0 {
+		m.workers = defaultImportWorkers
+	}
+	if m.variantCount <= 0 {
+		m.variantCount = defaultImportVariantCount
+	}
+	m.cond = sync.NewCond(&m.mu)
+
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create import job dir: %w", err)
+	}
+	if err := m.loadJobs(); err != nil {
+		return nil, err
+	}
+
+	go m.dispatch()
+	return m, nil
+}
+
+// Submit 提交导入任务，立即返回任务快照
+func (m *ImportJobManager) Submit(products []models.ProductCreateRequest) (*models.ImportJob, error) {
+	return m.SubmitSource(&sliceProductSource{products: products})
+}
+
+// SubmitSource 从商品数据源提交导入任务
+// 数据源被逐条读取并写入任务的条目文件，不会整体加载到内存；解析失败的行作为失败条目记录
+func (m *ImportJobManager) SubmitSource(source ProductSource) (*models.ImportJob, error) {
+	jobID := uuid.New().String()
+
+	// 写入条目文件
+	itemsFile, err := os.Create(m.itemsPath(jobID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create import items file: %w", err)
+	}
+	writer := bufio.NewWriter(itemsFile)
+	encoder := json.NewEncoder(writer)
+
+	total := 0
+	for {
+		item, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			itemsFile.Close()
+			os.Remove(m.itemsPath(jobID))
+			return nil, err
+		}
+
+		// 带外部 ID 的商品按 upsert 处理，其余商品在入队时分配 ID，重试时保持不变
+		item.ProductID = item.Product.ID
+		if item.ProductID == "" {
+			item.ProductID = uuid.New().String()
+		}
+		if err := encoder.Encode(item); err != nil {
+			itemsFile.Close()
+			os.Remove(m.itemsPath(jobID))
+			return nil, fmt.Errorf("failed to write import item: %w", err)
+		}
+		total++
+	}
+
+	if err := writer.Flush(); err != nil {
+		itemsFile.Close()
+		return nil, fmt.Errorf("failed to write import items: %w", err)
+	}
+	if err := itemsFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write import items: %w", err)
+	}
+
+	if total == 0 {
+		os.Remove(m.itemsPath(jobID))
+		return nil, ErrEmptyImport
+	}
+
+	return m.register(jobID, total)
+}
+
+// register 注册已写好条目文件的任务并入队
+func (m *ImportJobManager) register(jobID string, total int) (*models.ImportJob, error) {
+	now := time.Now()
+	state := &importJobState{
+		record: importJobRecord{
+			ImportJob: models.ImportJob{
+				ID:        jobID,
+				Status:    models.ImportJobQueued,
+				Total:     total,
+				Errors:    []models.BatchImportError{},
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+			Done: make([]byte, (total+7)/8),
+		},
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.save(state); err != nil {
+		return nil, err
+	}
+	m.jobs[jobID] = state
+	m.enqueueLocked(jobID)
+
+	logrus.Infof("Import job %s queued with %d products", jobID, total)
+	return m.snapshot(state, true), nil
+}
+
+// Get 获取任务快照
+func (m *ImportJobManager) Get(jobID string) (*models.ImportJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.jobs[jobID]
+	if !ok {
+		return nil, ErrImportJobNotFound
+	}
+	return m.snapshot(state, true), nil
+}
+
+// List 列出全部任务（按创建时间倒序，不含错误明细）
+func (m *ImportJobManager) List() []*models.ImportJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs := make([]*models.ImportJob, 0, len(m.jobs))
+	for _, state := range m.jobs {
+		jobs = append(jobs, m.snapshot(state, false))
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// Cancel 取消任务：排队中的任务立即取消，执行中的任务在当前条目处理完后停止
+func (m *ImportJobManager) Cancel(jobID string) (*models.ImportJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.jobs[jobID]
+	if !ok {
+		return nil, ErrImportJobNotFound
+	}
+
+	switch state.record.Status {
+	case models.ImportJobQueued:
+		m.removePendingLocked(jobID)
+		m.finishLocked(state, models.ImportJobCancelled)
+		if err := m.save(state); err != nil {
+			return nil, err
+		}
+	case models.ImportJobRunning:
+		state.cancel = true
+	default:
+		return nil, fmt.Errorf("%w: job is %s", ErrImportJobState, state.record.Status)
+	}
+
+	logrus.Infof("Import job %s cancellation requested", jobID)
+	return m.snapshot(state, true), nil
+}
+
+// Resume 继续已取消或失败的任务，只处理尚未处理的条目
+func (m *ImportJobManager) Resume(jobID string) (*models.ImportJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.jobs[jobID]
+	if !ok {
+		return nil, ErrImportJobNotFound
+	}
+	if state.record.Status != models.ImportJobCancelled && state.record.Status != models.ImportJobFailed {
+		return nil, fmt.Errorf("%w: job is %s", ErrImportJobState, state.record.Status)
+	}
+
+	state.cancel = false
+	state.record.Status = models.ImportJobQueued
+	state.record.Message = ""
+	state.record.FinishedAt = nil
+	state.record.UpdatedAt = time.Now()
+	if err := m.save(state); err != nil {
+		return nil, err
+	}
+	m.enqueueLocked(jobID)
+
+	logrus.Infof("Import job %s resumed", jobID)
+	return m.snapshot(state, true), nil
+}
+
+// Close 停止调度；执行中的任务在当前条目处理完后停止，保持 running 状态以便重启后继续
+func (m *ImportJobManager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+	m.cond.Broadcast()
+}
+
+// dispatch 按顺序执行排队中的任务
+func (m *ImportJobManager) dispatch() {
+	for {
+		m.mu.Lock()
+		for len(m.pending) == 0 && !m.closed {
+			m.cond.Wait()
+		}
+		if m.closed {
+			m.mu.Unlock()
+			return
+		}
+		jobID := m.pending[0]
+		m.pending = m.pending[1:]
+		m.mu.Unlock()
+
+		m.run(jobID)
+	}
+}
+
+// run 执行单个任务
+func (m *ImportJobManager) run(jobID string) {
+	m.mu.Lock()
+	state, ok := m.jobs[jobID]
+	if !ok || state.record.Status != models.ImportJobQueued {
+		m.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	state.record.Status = models.ImportJobRunning
+	state.record.StartedAt = &now
+	state.record.UpdatedAt = now
+	if err := m.save(state); err != nil {
+		logrus.Errorf("Failed to persist import job %s: %v", jobID, err)
+	}
+	m.mu.Unlock()
+
+	logrus.Infof("Import job %s started", jobID)
+
+	// worker 池
+	work := make(chan importWork)
+	var wg sync.WaitGroup
+	for i := 0; i < m.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for w := range work {
+				result, err := m.processItem(w.item)
+				m.recordResult(state, w.index, w.item, result, err)
+			}
+		}()
+	}
+
+	readErr := m.feed(state, work)
+	close(work)
+	wg.Wait()
+
+	// 汇总任务状态
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case readErr != nil:
+		state.record.Message = readErr.Error()
+		m.finishLocked(state, models.ImportJobFailed)
+	case state.cancel:
+		state.cancel = false
+		m.finishLocked(state, models.ImportJobCancelled)
+	case m.closed && state.record.Processed < state.record.Total:
+		// 服务关闭，保持 running 状态，重启后继续
+		state.record.UpdatedAt = time.Now()
+	default:
+		m.finishLocked(state, models.ImportJobCompleted)
+	}
+	if err := m.save(state); err != nil {
+		logrus.Errorf("Failed to persist import job %s: %v", jobID, err)
+	}
+
+	logrus.Infof("Import job %s %s: %d/%d processed, %d success, %d failed", jobID, state.record.Status,
+		state.record.Processed, state.record.Total, state.record.Success, state.record.Failed)
+}
+
+// feed 读取条目文件，把未处理的条目分发给 worker
+func (m *ImportJobManager) feed(state *importJobState, work chan<- importWork) error {
+	file, err := os.Open(m.itemsPath(state.record.ID))
+	if err != nil {
+		return fmt.Errorf("failed to open import items: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), importMaxLineSize)
+
+	for index := 0; scanner.Scan(); index++ {
+		if m.shouldStop(state) {
+			return nil
+		}
+		if m.isDone(state, index) {
+			continue
+		}
+
+		var item models.ImportItem
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			m.recordResult(state, index, models.ImportItem{}, nil, fmt.Errorf("invalid import item: %w", err))
+			continue
+		}
+		work <- importWork{index: index, item: item}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read import items: %w", err)
+	}
+	return nil
+}
+
+// processItem 处理单个商品：校验属性、生成变体并写入
+func (m *ImportJobManager) processItem(item models.ImportItem) (*models.ProductUpsertResult, error) {
+	// 数据源解析失败的行
+	if item.Error != "" {
+		return nil, errors.New(item.Error)
+	}
+
+	if err := item.Product.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.AttributeRegistry().ValidateValues(item.Product.Attributes); err != nil {
+		return nil, fmt.Errorf("invalid attributes: %w", err)
+	}
+
+	product := item.Product.ToProduct()
+	product.ID = item.ProductID
+
+	// 导入任务在后台执行，不随创建任务的请求取消
+	return m.indexer(context.Background(), product, m.variantCount)
+}
+
+// recordResult 记录条目处理结果，定期落盘
+func (m *ImportJobManager) recordResult(state *importJobState, index int, item models.ImportItem, result *models.ProductUpsertResult, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record := &state.record
+	record.Done[index/8] |= 1 << (index % 8)
+	record.Processed++
+	record.UpdatedAt = time.Now()
+
+	if err != nil {
+		logrus.Errorf("Import job %s item %d failed: %v", record.ID, index, err)
+		record.Failed++
+		record.Errors = append(record.Errors, models.BatchImportError{
+			Index:   index,
+			Line:    item.Line,
+			Product: item.Product.Name,
+			Error:   err.Error(),
+		})
+	} else {
+		record.Success++
+		if result != nil && result.Unchanged {
+			record.Unchanged++
+		}
+	}
+
+	state.unsaved++
+	if state.unsaved >= importPersistInterval {
+		if err := m.save(state); err != nil {
+			logrus.Errorf("Failed to persist import job %s: %v", record.ID, err)
+		}
+	}
+}
+
+// shouldStop 判断任务是否需要停止（取消或服务关闭）
+func (m *ImportJobManager) shouldStop(state *importJobState) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return state.cancel || m.closed
+}
+
+// isDone 判断条目是否已处理
+func (m *ImportJobManager) isDone(state *importJobState, index int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return index/8 < len(state.record.Done) && state.record.Done[index/8]&(1<<(index%8)) != 0
+}
+
+// finishLocked 结束任务，调用方需持有锁
+func (m *ImportJobManager) finishLocked(state *importJobState, status string) {
+	now := time.Now()
+	state.record.Status = status
+	state.record.FinishedAt = &now
+	state.record.UpdatedAt = now
+}
+
+// enqueueLocked 任务入队，调用方需持有锁
+func (m *ImportJobManager) enqueueLocked(jobID string) {
+	m.pending = append(m.pending, jobID)
+	m.cond.Signal()
+}
+
+// removePendingLocked 从队列中移除任务，调用方需持有锁
+func (m *ImportJobManager) removePendingLocked(jobID string) {
+	for i, id := range m.pending {
+		if id == jobID {
+			m.pending = append(m.pending[:i], m.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// snapshot 复制任务状态，调用方需持有锁
+func (m *ImportJobManager) snapshot(state *importJobState, withErrors bool) *models.ImportJob {
+	job := state.record.ImportJob
+	if withErrors {
+		job.Errors = append([]models.BatchImportError{}, state.record.Errors...)
+	} else {
+		job.Errors = nil
+	}
+	return &job
+}
+
+// save 写入任务状态文件（先写临时文件再重命名），调用方需持有锁
+func (m *ImportJobManager) save(state *importJobState) error {
+	data, err := json.Marshal(state.record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal import job: %w", err)
+	}
+
+	path := m.jobPath(state.record.ID)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write import job: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to write import job: %w", err)
+	}
+
+	state.unsaved = 0
+	return nil
+}
+
+// loadJobs 加载任务目录中的任务，未结束的任务重新入队
+func (m *ImportJobManager) loadJobs() error {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read import job dir: %w", err)
+	}
+
+	resumed := make([]*importJobState, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(m.dir, name))
+		if err != nil {
+			logrus.Warnf("Failed to read import job %s: %v", name, err)
+			continue
+		}
+		state := &importJobState{}
+		if err := json.Unmarshal(data, &state.record); err != nil {
+			logrus.Warnf("Failed to parse import job %s: %v", name, err)
+			continue
+		}
+
+		m.jobs[state.record.ID] = state
+		if !state.record.IsFinished() {
+			state.record.Status = models.ImportJobQueued
+			resumed = append(resumed, state)
+		}
+	}
+
+	// 按创建时间顺序继续未完成的任务
+	sort.Slice(resumed, func(i, j int) bool {
+		return resumed[i].record.CreatedAt.Before(resumed[j].record.CreatedAt)
+	})
+	for _, state := range resumed {
+		logrus.Infof("Resuming import job %s (%d/%d processed)", state.record.ID, state.record.Processed, state.record.Total)
+		m.pending = append(m.pending, state.record.ID)
+	}
+
+	return nil
+}
+
+// jobPath 任务状态文件路径
+func (m *ImportJobManager) jobPath(jobID string) string {
+	return filepath.Join(m.dir, jobID+".json")
+}
+
+// itemsPath 任务条目文件路径
+func (m *ImportJobManager) itemsPath(jobID string) string {
+	return filepath.Join(m.dir, jobID+".items.jsonl")
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"search-ec2/internal/config"
+	"search-ec2/internal/models"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidImportSource 上传的数据无法解析（表头无法识别、映射错误、单行过长等）
+var ErrInvalidImportSource = errors.New("invalid import source")
+
+// ProductSource 导入任务的商品数据源
+// Next 逐条返回商品，数据读完时返回 io.EOF；单行解析失败时返回带 Error 的条目而不是错误，
+// 只有无法继续读取（如连接中断）时才返回错误
+type ProductSource interface {
+	Next() (models.ImportItem, error)
+}
+
+// sliceProductSource 内存中的商品列表
+type sliceProductSource struct {
+	products []models.ProductCreateRequest
+	index    int
+}
+
+// Next 返回下一个商品
+func (s *sliceProductSource) Next() (models.ImportItem, error) {
+	if s.index >= len(s.products) {
+		return models.ImportItem{}, io.EOF
+	}
+	item := models.ImportItem{Product: s.products[s.index]}
+	s.index++
+	return item, nil
+}
+
+// JSONLProductSource 换行分隔的 JSON 数据源，每行一个 ProductCreateRequest，空行会被跳过
+type JSONLProductSource struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewJSONLProductSource 创建 JSONL 数据源
+func NewJSONLProductSource(r io.Reader) *JSONLProductSource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), importMaxLineSize)
+	return &JSONLProductSource{scanner: scanner}
+}
+
+// Next 解析下一行
+func (s *JSONLProductSource) Next() (models.ImportItem, error) {
+	for s.scanner.Scan() {
+		s.line++
+		data := strings.TrimSpace(s.scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		item := models.ImportItem{Line: s.line}
+		if err := json.Unmarshal([]byte(data), &item.Product); err != nil {
+			item.Error = fmt.Sprintf("line %d: invalid JSON: %v", s.line, err)
+			return item, nil
+		}
+		if err := item.Product.Validate(); err != nil {
+			item.Error = fmt.Sprintf("line %d: %v", s.line, err)
+		}
+		return item, nil
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return models.ImportItem{}, fmt.Errorf("%w: line %d exceeds %d bytes", ErrInvalidImportSource, s.line+1, importMaxLineSize)
+		}
+		return models.ImportItem{}, fmt.Errorf("failed to read JSONL at line %d: %w", s.line+1, err)
+	}
+	return models.ImportItem{}, io.EOF
+}
+
+// CSV 导入
+// 第一行为表头，表头通过映射关系对应到商品字段：外部商品 ID（id）、基础字段（name、price、tags 等）以及 attr.<属性名>。
+// 带 id 的行与 JSONL 导入一致按 upsert 处理。
+// 未配置映射的表头如果本身就是字段名则直接使用，其余列被忽略。
+// tags、image_urls 列使用 | 分隔多个值；attr.* 列按属性注册表中的类型转换，未登记的属性保存为字符串。
+
+// csvListSeparator 列表字段的分隔符
+const csvListSeparator = "|"
+
+// csvAttributePrefix 自定义属性列的字段前缀
+const csvAttributePrefix = "attr."
+
+// csvStringFields 字符串类型的基础字段
+var csvStringFields = map[string]func(req *models.ProductCreateRequest, value string){
+	"name":        func(req *models.ProductCreateRequest, v string) { req.Name = v },
+	"category":    func(req *models.ProductCreateRequest, v string) { req.Category = v },
+	"description": func(req *models.ProductCreateRequest, v string) { req.Description = v },
+	"currency":    func(req *models.ProductCreateRequest, v string) { req.Currency = v },
+	"brand":       func(req *models.ProductCreateRequest, v string) { req.Brand = v },
+	"color":       func(req *models.ProductCreateRequest, v string) { req.Color = v },
+	"size":        func(req *models.ProductCreateRequest, v string) { req.Size = v },
+	"material":    func(req *models.ProductCreateRequest, v string) { req.Material = v },
+	"style":       func(req *models.ProductCreateRequest, v string) { req.Style = v },
+	"gender":      func(req *models.ProductCreateRequest, v string) { req.Gender = v },
+	"occasion":    func(req *models.ProductCreateRequest, v string) { req.Occasion = v },
+}
+
+// isCSVField 判断是否为合法的目标字段
+func isCSVField(field string) bool {
+	if _, ok := csvStringFields[field]; ok {
+		return true
+	}
+	switch field {
+	case "id", "price", "tags", "image_urls":
+		return true
+	}
+	return strings.HasPrefix(field, csvAttributePrefix) && len(field) > len(csvAttributePrefix)
+}
+
+// CSVProductSource CSV 数据源
+type CSVProductSource struct {
+	reader  *csv.Reader
+	mapping map[string]string // 表头（小写）-> 字段
+	fields  []string          // 每列对应的字段，空字符串表示忽略
+}
+
+// NewCSVProductSource 创建 CSV 数据源，mapping 为表头到字段的映射（表头不区分大小写），
+// 为空时使用配置中的 import.csv_mapping
+func NewCSVProductSource(r io.Reader, mapping map[string]string) (*CSVProductSource, error) {
+	if len(mapping) == 0 {
+		mapping = config.AppConfig.Import.CSVMapping
+	}
+
+	normalized := make(map[string]string, len(mapping))
+	for header, field := range mapping {
+		if !isCSVField(field) {
+			return nil, fmt.Errorf("%w: invalid CSV mapping %q -> %q", ErrInvalidImportSource, header, field)
+		}
+		normalized[strings.ToLower(strings.TrimSpace(header))] = field
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // 列数不一致作为行级错误处理
+	reader.LazyQuotes = true
+
+	return &CSVProductSource{reader: reader, mapping: normalized}, nil
+}
+
+// readHeader 读取表头并确定每列对应的字段
+func (s *CSVProductSource) readHeader() error {
+	header, err := s.reader.Read()
+	if err == io.EOF {
+		return io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("%w: malformed CSV header: %v", ErrInvalidImportSource, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	s.fields = make([]string, len(header))
+	mapped := 0
+	for i, column := range header {
+		if i == 0 {
+			column = strings.TrimPrefix(column, "\ufeff") // Excel 导出的 UTF-8 BOM
+		}
+		key := strings.ToLower(strings.TrimSpace(column))
+		if field, ok := s.mapping[key]; ok {
+			s.fields[i] = field
+		} else if isCSVField(key) {
+			s.fields[i] = key
+		}
+		if s.fields[i] != "" {
+			mapped++
+		}
+	}
+
+	if mapped == 0 {
+		return fmt.Errorf("%w: CSV header has no recognized columns", ErrInvalidImportSource)
+	}
+	return nil
+}
+
+// Next 解析下一行
+func (s *CSVProductSource) Next() (models.ImportItem, error) {
+	if s.fields == nil {
+		if err := s.readHeader(); err != nil {
+			return models.ImportItem{}, err
+		}
+	}
+
+	for {
+		record, err := s.reader.Read()
+		if err == io.EOF {
+			return models.ImportItem{}, io.EOF
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return models.ImportItem{
+				Line:  parseErr.StartLine,
+				Error: fmt.Sprintf("line %d: %v", parseErr.StartLine, parseErr.Err),
+			}, nil
+		}
+		if err != nil {
+			return models.ImportItem{}, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		line, _ := s.reader.FieldPos(0)
+		if isBlankRecord(record) {
+			continue
+		}
+
+		item := models.ImportItem{Line: line}
+		if err := s.parseRecord(record, &item.Product); err != nil {
+			item.Error = fmt.Sprintf("line %d: %v", line, err)
+		} else if err := item.Product.Validate(); err != nil {
+			item.Error = fmt.Sprintf("line %d: %v", line, err)
+		}
+		return item, nil
+	}
+}
+
+// parseRecord 将一行数据填充到商品创建请求
+func (s *CSVProductSource) parseRecord(record []string, req *models.ProductCreateRequest) error {
+	if len(record) > len(s.fields) {
+		return fmt.Errorf("expected at most %d columns, got %d", len(s.fields), len(record))
+	}
+
+	for i, raw := range record {
+		field := s.fields[i]
+		value := strings.TrimSpace(raw)
+		if field == "" || value == "" {
+			continue
+		}
+
+		if setter, ok := csvStringFields[field]; ok {
+			setter(req, value)
+			continue
+		}
+
+		switch field {
+		case "id":
+			if !models.IsValidProductID(value) {
+				return fmt.Errorf("invalid id %q", value)
+			}
+			req.ID = value
+		case "price":
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid price %q", value)
+			}
+			req.Price = price
+		case "tags":
+			req.Tags = splitCSVList(value)
+		case "image_urls":
+			req.ImageURLs = splitCSVList(value)
+		default:
+			name := strings.TrimPrefix(field, csvAttributePrefix)
+			attrValue, err := parseCSVAttribute(name, value)
+			if err != nil {
+				return err
+			}
+			if req.Attributes == nil {
+				req.Attributes = make(map[string]interface{})
+			}
+			req.Attributes[name] = attrValue
+		}
+	}
+	return nil
+}
+
+// parseCSVAttribute 按属性注册表中的类型转换属性值
+func parseCSVAttribute(name, value string) (interface{}, error) {
+	attr, ok := config.AttributeRegistry().Lookup(name)
+	if !ok {
+		return value, nil
+	}
+
+	switch attr.Type {
+	case config.AttributeTypeInteger:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: invalid integer %q", name, value)
+		}
+		return n, nil
+	case config.AttributeTypeFloat:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: invalid number %q", name, value)
+		}
+		return f, nil
+	case config.AttributeTypeBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: invalid bool %q", name, value)
+		}
+		return b, nil
+	}
+	return value, nil
+}
+
+// splitCSVList 拆分 | 分隔的列表
+func splitCSVList(value string) []string {
+	parts := strings.Split(value, csvListSeparator)
+	result := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// isBlankRecord 判断是否为空行
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
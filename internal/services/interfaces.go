@@ -1,11 +1,14 @@
 package services
 
-import "search-ec2/internal/models"
+import (
+	"context"
+	"search-ec2/internal/models"
+)
 
 // EmbeddingServiceInterface 向量化服务接口
 type EmbeddingServiceInterface interface {
-	GetEmbedding(text string) ([]float32, error)
-	GetEmbeddings(texts []string) ([][]float32, error)
-	GetProductVariantEmbeddings(variants []string) ([]models.ProductVariant, error)
+	GetEmbedding(ctx context.Context, text string) ([]float32, error)
+	GetEmbeddings(ctx context.Context, texts []string) ([][]float32, error)
+	GetProductVariantEmbeddings(ctx context.Context, variants []string) ([]models.ProductVariant, error)
 	HealthCheck() error
 }
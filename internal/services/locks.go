@@ -0,0 +1,41 @@
+package services
+
+import "sync"
+
+// keyedMutex 按键加锁：同一个键的持有者互斥，不同键互不阻塞；没有持有者的键会被回收
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock 单个键的锁及等待者计数
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// Lock 获取键的锁，返回释放函数
+func (k *keyedMutex) Lock(key string) (unlock func()) {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		k.locks[key] = lock
+	}
+	lock.refs++
+	k.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		k.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
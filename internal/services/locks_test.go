@@ -0,0 +1,58 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutexSerializesSameKey(t *testing.T) {
+	var locks keyedMutex
+	var active, maxActive atomic.Int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locks.Lock("p1")
+			defer unlock()
+
+			n := active.Add(1)
+			for {
+				m := maxActive.Load()
+				if n <= m || maxActive.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			active.Add(-1)
+		}()
+	}
+	wg.Wait()
+
+	if maxActive.Load() != 1 {
+		t.Fatalf("%d holders of the same key at once", maxActive.Load())
+	}
+	if len(locks.locks) != 0 {
+		t.Fatalf("released keys were not reclaimed: %v", locks.locks)
+	}
+}
+
+func TestKeyedMutexDifferentKeys(t *testing.T) {
+	var locks keyedMutex
+	unlock := locks.Lock("p1")
+	defer unlock()
+
+	done := make(chan struct{})
+	go func() {
+		locks.Lock("p2")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lock on another key was blocked")
+	}
+}
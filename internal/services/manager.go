@@ -1,9 +1,13 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"search-ec2/internal/config"
+	"search-ec2/internal/models"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
@@ -13,6 +17,9 @@ type ServiceManager struct {
 	Embedding         *CachedEmbeddingService
 	FunctionCalling   *FunctionCallingService
 	VariantGeneration *VariantGenerationService
+	Imports           *ImportJobManager
+	Reindex           *ReindexManager
+	productLocks      keyedMutex // 同一商品的读取-写入按商品 ID 串行执行，见 LockProduct
 }
 
 // NewServiceManager 创建服务管理器
@@ -30,6 +37,11 @@ func NewServiceManager() (*ServiceManager, error) {
 	embeddingService := NewCachedEmbeddingService()
 	logrus.Info("Embedding service initialized")
 
+	// 校验向量维度：embedding 模型、配置与已有集合必须一致
+	if err := verifyVectorDimension(qdrantService, embeddingService); err != nil {
+		return nil, err
+	}
+
 	// 初始化 Function Calling 服务
 	functionCallingService := NewFunctionCallingService()
 	logrus.Info("Function calling service initialized")
@@ -45,10 +57,178 @@ func NewServiceManager() (*ServiceManager, error) {
 		VariantGeneration: variantGenerationService,
 	}
 
+	// 初始化导入任务管理器（会继续上次未完成的任务）
+	importManager, err := NewImportJobManager(manager.UpsertProduct)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize import job manager: %w", err)
+	}
+	manager.Imports = importManager
+	logrus.Info("Import job manager initialized")
+
+	// 初始化重建索引任务管理器
+	reindexManager, err := NewReindexManager(qdrantService, embeddingService, variantGenerationService)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize reindex manager: %w", err)
+	}
+	manager.Reindex = reindexManager
+	logrus.Info("Reindex manager initialized")
+
 	logrus.Info("All services initialized successfully")
 	return manager, nil
 }
 
+// verifyVectorDimension 启动时校验向量维度
+// 维度不一致是配置错误，拒绝启动；embedding 服务或 Qdrant 暂时不可用时只告警，由懒加载在首次使用时重试
+func verifyVectorDimension(qdrantService *QdrantService, embeddingService *CachedEmbeddingService) error {
+	expected := qdrantService.VectorSize()
+
+	if config.AppConfig.OpenAI.EmbeddingConfigured() {
+		probe, err := embeddingService.EmbeddingService.GetEmbedding(context.Background(), "dimension probe")
+		if err != nil {
+			logrus.Warnf("Failed to probe embedding dimension, skipping check: %v", err)
+		} else if len(probe) != expected {
+			return fmt.Errorf("embedding model %s returns %d-dimensional vectors but qdrant.vector_size is %d",
+				config.AppConfig.OpenAI.EmbeddingModel, len(probe), expected)
+		} else {
+			logrus.Infof("Embedding model %s returns %d-dimensional vectors", config.AppConfig.OpenAI.EmbeddingModel, len(probe))
+		}
+	}
+
+	if err := qdrantService.Init(); err != nil {
+		if errors.Is(err, ErrVectorParamsMismatch) {
+			return err
+		}
+		logrus.Warnf("Qdrant not ready at startup, collection check deferred: %v", err)
+	}
+
+	return nil
+}
+
+// IndexProduct 生成商品变体及向量并写入 Qdrant，返回变体数量
+// 生成变体文本和向量化时不持有 servingMu，只在写入时持有读锁；向量化期间模型被切换时重新向量化（见 WithServing）
+func (sm *ServiceManager) IndexProduct(ctx context.Context, product *models.Product, variantCount int) (int, error) {
+	texts, err := sm.VariantGeneration.GenerateVariants(ctx, product, variantCount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate variants: %w", err)
+	}
+	if len(texts) == 0 {
+		return 0, fmt.Errorf("failed to generate variants: no valid variants generated")
+	}
+
+	var variants []models.ProductVariant
+	err = WithServing(func() error {
+		var err error
+		variants, err = sm.Embedding.GetProductVariantEmbeddings(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("failed to get variant embeddings: %w", err)
+		}
+		return nil
+	}, func() error {
+		for i := range variants {
+			variants[i].ProductID = product.ID
+		}
+		if err := sm.Qdrant.InsertProduct(product, variants); err != nil {
+			return fmt.Errorf("failed to save product: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(variants), nil
+}
+
+// LockProduct 获取商品的写锁，返回释放函数
+// 读取已存储的商品再写入新一代变体的操作（upsert、更新、重新生成变体）必须持有该锁，
+// 否则并发写入同一商品时会基于同一代数各自写入下一代，旧代清理时留下多余的变体
+func (sm *ServiceManager) LockProduct(productID string) (unlock func()) {
+	return sm.productLocks.Lock(productID)
+}
+
+// UpsertProduct 按商品 ID 创建或更新商品
+// ID 为空时生成新 ID；商品已存在时保留创建时间和上下架状态，内容摘要未变化时直接返回，
+// 变体指纹未变化时只更新商品字段（见 SaveProduct）。已软删除的商品重新创建时恢复为上架状态。
+func (sm *ServiceManager) UpsertProduct(ctx context.Context, product *models.Product, variantCount int) (*models.ProductUpsertResult, error) {
+	result := &models.ProductUpsertResult{Name: product.Name, Created: true}
+
+	var existing *models.Product
+	if product.ID == "" {
+		product.ID = uuid.New().String()
+	} else {
+		unlock := sm.LockProduct(product.ID)
+		defer unlock()
+
+		var err error
+		existing, err = sm.Qdrant.GetProduct(product.ID)
+		if err != nil && !errors.Is(err, ErrProductNotFound) {
+			return nil, fmt.Errorf("failed to load existing product: %w", err)
+		}
+		if existing != nil {
+			result.Created = false
+			product.CreatedAt = existing.CreatedAt
+			if existing.Status == models.ProductStatusDeleted {
+				product.Status = models.ProductStatusActive
+				result.Restored = true
+			} else {
+				product.Status = existing.Status
+			}
+
+			if existing.ContentHash != "" && existing.ContentHash == product.ComputeContentHash() {
+				if result.Restored {
+					if err := sm.Qdrant.SetProductStatus(product.ID, product.Status); err != nil {
+						return nil, fmt.Errorf("failed to restore product: %w", err)
+					}
+					existing.UpdatedAt = product.UpdatedAt
+				} else {
+					result.Unchanged = true
+				}
+				result.ProductID = existing.ID
+				result.VariantsCount = len(existing.Variants)
+				result.CreatedAt = existing.CreatedAt
+				result.UpdatedAt = existing.UpdatedAt
+				return result, nil
+			}
+		}
+	}
+
+	variantsCount, regenerated, err := sm.SaveProduct(ctx, product, existing, variantCount)
+	if err != nil {
+		return nil, err
+	}
+
+	result.ProductID = product.ID
+	result.Regenerated = regenerated
+	result.VariantsCount = variantsCount
+	result.CreatedAt = product.CreatedAt
+	result.UpdatedAt = product.UpdatedAt
+	return result, nil
+}
+
+// SaveProduct 写入新建或更新后的商品，返回变体数量以及是否重新生成了变体
+// existing 为更新前已存储的商品（含变体），其变体指纹与更新后一致时只更新 payload，
+// 否则（新商品、生成变体的字段有变化、旧数据没有指纹）生成新一代变体，写入成功后替换旧的变体
+func (sm *ServiceManager) SaveProduct(ctx context.Context, product, existing *models.Product, variantCount int) (int, bool, error) {
+	if existing != nil {
+		product.Generation = existing.Generation
+	}
+
+	if existing != nil && len(existing.Variants) > 0 &&
+		existing.VariantHash != "" && existing.VariantHash == VariantHash(product) {
+		product.Variants = existing.Variants
+		if err := sm.Qdrant.UpdateProductPayload(product); err != nil {
+			return 0, false, fmt.Errorf("failed to update product: %w", err)
+		}
+		return len(product.Variants), false, nil
+	}
+
+	variantsCount, err := sm.IndexProduct(ctx, product, variantCount)
+	if err != nil {
+		return 0, false, err
+	}
+	return variantsCount, true, nil
+}
+
 // HealthCheck 检查所有服务健康状态
 func (sm *ServiceManager) HealthCheck() map[string]string {
 	status := make(map[string]string)
@@ -60,14 +240,20 @@ func (sm *ServiceManager) HealthCheck() map[string]string {
 		status["qdrant"] = "ok"
 	}
 
-	// 检查向量化服务（如果配置了 OpenAI API Key）
-	if config.AppConfig.OpenAI.APIKey != "" {
+	// 检查向量化服务（配置了 API Key 或使用本地向量化服务时）
+	if config.AppConfig.OpenAI.EmbeddingConfigured() {
 		if err := sm.Embedding.HealthCheck(); err != nil {
 			status["embedding"] = fmt.Sprintf("error: %v", err)
 		} else {
 			status["embedding"] = "ok"
 		}
+	} else {
+		status["embedding"] = "not_configured"
+	}
 
+	// 检查对话模型服务（如果配置了 API Key）
+	openai := config.AppConfig.OpenAI
+	if openai.Provider(openai.ChatProvider).APIKey != "" {
 		// 检查 Function Calling 服务
 		if err := sm.FunctionCalling.HealthCheck(); err != nil {
 			status["function_calling"] = fmt.Sprintf("error: %v", err)
@@ -82,7 +268,6 @@ func (sm *ServiceManager) HealthCheck() map[string]string {
 			status["variant_generation"] = "ok"
 		}
 	} else {
-		status["embedding"] = "not_configured"
 		status["function_calling"] = "not_configured"
 		status["variant_generation"] = "not_configured"
 	}
@@ -108,16 +293,29 @@ func (sm *ServiceManager) GetStats() (map[string]interface{}, error) {
 		"size": sm.Embedding.cache.Size(),
 	}
 
-	// 配置信息
+	// 配置信息（向量维度和 embedding 模型在重建索引切换时会被修改）
+	release := AcquireServing()
+	vectorSize, embeddingModel := config.AppConfig.Qdrant.VectorSize, config.AppConfig.OpenAI.EmbeddingModel
+	release()
 	stats["config"] = map[string]interface{}{
-		"vector_size":          config.AppConfig.Qdrant.VectorSize,
+		"vector_size":          vectorSize,
+		"distance":             config.AppConfig.Qdrant.Distance,
 		"collection_name":      config.AppConfig.Qdrant.CollectionName,
-		"embedding_model":      config.AppConfig.OpenAI.EmbeddingModel,
+		"embedding_model":      embeddingModel,
 		"chat_model":          config.AppConfig.OpenAI.ChatModel,
 		"max_results":         config.AppConfig.Search.MaxResults,
 		"similarity_threshold": config.AppConfig.Search.SimilarityThreshold,
 	}
 
+	// 各任务的模型链（协议/模型，主模型在前）
+	taskModels := make(map[string][]string)
+	for _, task := range []string{config.TaskParse, config.TaskVariants, config.TaskSuggestions, config.TaskRerank, config.TaskEmbedding} {
+		for _, model := range config.AppConfig.ModelRoute(task) {
+			taskModels[task] = append(taskModels[task], model.Provider+"/"+model.Model)
+		}
+	}
+	stats["models"] = taskModels
+
 	// 功能开关状态
 	stats["features"] = map[string]interface{}{
 		"batch_import":       config.AppConfig.Features.EnableBatchImport,
@@ -132,6 +330,9 @@ func (sm *ServiceManager) GetStats() (map[string]interface{}, error) {
 // Close 关闭所有服务连接
 func (sm *ServiceManager) Close() error {
 	logrus.Info("Closing services...")
+
+	// 停止导入任务调度，执行中的任务重启后继续
+	sm.Imports.Close()
 	
 	// 清理缓存
 	sm.Embedding.cache.Clear()
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/qdrant/go-client/qdrant"
+	"github.com/sirupsen/logrus"
+)
+
+// PointIDMigrationResult 点 ID 迁移结果
+type PointIDMigrationResult struct {
+	Scanned  int `json:"scanned"`
+	Migrated int `json:"migrated"`
+	Skipped  int `json:"skipped"` // 已经是确定性 ID 的点
+	Invalid  int `json:"invalid"` // 缺少 product_id 的点
+}
+
+// MigratePointIDs 将集合中的点重写为确定性 ID 方案
+// 旧数据使用按序号分配的数字 ID，这里按 payload 中的 product_id 重新推导变体 ID 和点 ID，
+// 写入新点后删除旧点。重复执行是安全的：已迁移的点会被跳过，中断后重跑得到相同的变体 ID。
+func (s *QdrantService) MigratePointIDs(batchSize uint32, dryRun bool) (*PointIDMigrationResult, error) {
+	if err := s.ensureInitialized(); err != nil {
+		return nil, err
+	}
+
+	if batchSize == 0 {
+		batchSize = 256
+	}
+
+	ctx := context.Background()
+	result := &PointIDMigrationResult{}
+	ordinals := make(map[string]map[string]int) // 每个商品的旧点 → 变体序号
+	var offset *qdrant.PointId
+
+	for {
+		points, nextOffset, err := s.client.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+			CollectionName: s.collectionName,
+			Limit:          qdrant.PtrOf(batchSize),
+			Offset:         offset,
+			WithPayload:    qdrant.NewWithPayload(true),
+			WithVectors:    qdrant.NewWithVectors(true),
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to scroll points: %w", err)
+		}
+
+		newPoints := make([]*qdrant.PointStruct, 0, len(points))
+		oldIDs := make([]*qdrant.PointId, 0, len(points))
+
+		for _, point := range points {
+			result.Scanned++
+
+			productID := s.extractStringFromValue(point.Payload["product_id"])
+			if productID == "" {
+				result.Invalid++
+				continue
+			}
+
+			// 已迁移的点带有 variant_index，且 ID 与推导结果一致
+			variantID := s.extractStringFromValue(point.Payload["variant_id"])
+			generation := s.extractIntFromValue(point.Payload["generation"])
+			if _, ok := point.Payload["variant_index"]; ok &&
+				point.Id.GetUuid() == PointIDForVariant(productID, variantID, generation) {
+				result.Skipped++
+				continue
+			}
+
+			// 变体序号由旧点在商品内的位置决定，中断后重跑会得到相同的变体 ID，覆盖而不是重复写入
+			productOrdinals, ok := ordinals[productID]
+			if !ok {
+				productOrdinals, err = s.legacyOrdinals(ctx, productID)
+				if err != nil {
+					return result, err
+				}
+				ordinals[productID] = productOrdinals
+			}
+
+			newPoints = append(newPoints, migratedPoint(productID, point, productOrdinals[legacyPointKey(point.Id)]))
+			oldIDs = append(oldIDs, point.Id)
+		}
+
+		if len(newPoints) > 0 && !dryRun {
+			if _, err := s.client.Upsert(ctx, &qdrant.UpsertPoints{
+				CollectionName: s.collectionName,
+				Wait:           qdrant.PtrOf(true),
+				Points:         newPoints,
+			}); err != nil {
+				return result, fmt.Errorf("failed to upsert migrated points: %w", err)
+			}
+
+			if _, err := s.client.Delete(ctx, &qdrant.DeletePoints{
+				CollectionName: s.collectionName,
+				Wait:           qdrant.PtrOf(true),
+				Points:         qdrant.NewPointsSelectorIDs(oldIDs),
+			}); err != nil {
+				return result, fmt.Errorf("failed to delete legacy points: %w", err)
+			}
+		}
+		result.Migrated += len(newPoints)
+
+		logrus.Infof("Point ID migration progress: scanned=%d migrated=%d skipped=%d",
+			result.Scanned, result.Migrated, result.Skipped)
+
+		if nextOffset == nil {
+			break
+		}
+		offset = nextOffset
+	}
+
+	return result, nil
+}
+
+// legacyOrdinals 读取商品的全部点，计算每个旧点的变体序号（见 variantOrdinals）
+func (s *QdrantService) legacyOrdinals(ctx context.Context, productID string) (map[string]int, error) {
+	var all []*qdrant.RetrievedPoint
+	var offset *qdrant.PointId
+	for {
+		points, nextOffset, err := s.client.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+			CollectionName: s.collectionName,
+			Filter: &qdrant.Filter{
+				Must: []*qdrant.Condition{qdrant.NewMatch("product_id", productID)},
+			},
+			Limit:       qdrant.PtrOf(uint32(256)),
+			Offset:      offset,
+			WithPayload: qdrant.NewWithPayloadInclude("variant_index", legacyIDField),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scroll points of product %s: %w", productID, err)
+		}
+		all = append(all, points...)
+
+		if nextOffset == nil {
+			return variantOrdinals(all), nil
+		}
+		offset = nextOffset
+	}
+}
+
+// legacyIDField 迁移后的点记录原点 ID 的字段，重跑时据此还原旧点的完整集合
+const legacyIDField = "legacy_id"
+
+// variantOrdinals 按旧点 ID 排序为商品的每个旧点分配变体序号
+// 旧点集合包括尚未迁移的点和已迁移点记录的原 ID，因此无论上次中断在写入前、写入后还是删除后，
+// 同一个旧点总是得到相同的序号。不是迁移产生的点（带 variant_index 但没有原 ID）占用的序号会被跳过。
+func variantOrdinals(points []*qdrant.RetrievedPoint) map[string]int {
+	var keys []string
+	base := 0
+	for _, point := range points {
+		index, migrated := point.Payload["variant_index"]
+		if legacyID := point.Payload[legacyIDField].GetStringValue(); legacyID != "" {
+			keys = append(keys, legacyID)
+		} else if migrated {
+			base = max(base, int(index.GetIntegerValue())+1)
+		} else {
+			keys = append(keys, legacyPointKey(point.Id))
+		}
+	}
+
+	sort.Strings(keys)
+	ordinals := make(map[string]int, len(keys))
+	for _, key := range keys {
+		if _, ok := ordinals[key]; !ok {
+			ordinals[key] = base + len(ordinals)
+		}
+	}
+	return ordinals
+}
+
+// legacyPointKey 旧点 ID 的可排序表示：数字 ID 补零到定长，按数值顺序排序
+func legacyPointKey(id *qdrant.PointId) string {
+	if uuid := id.GetUuid(); uuid != "" {
+		return uuid
+	}
+	return fmt.Sprintf("%020d", id.GetNum())
+}
+
+// migratedPoint 构建旧点迁移后的新点：按序号推导变体 ID 和点 ID，并记录原点 ID
+func migratedPoint(productID string, point *qdrant.RetrievedPoint, index int) *qdrant.PointStruct {
+	payload := make(map[string]*qdrant.Value, len(point.Payload)+3)
+	for key, value := range point.Payload {
+		payload[key] = value
+	}
+	variantID := fmt.Sprintf("variant_%d", index)
+	payload["variant_id"] = qdrant.NewValueString(variantID)
+	payload["variant_index"] = qdrant.NewValueInt(int64(index))
+	payload[legacyIDField] = qdrant.NewValueString(legacyPointKey(point.Id))
+
+	return &qdrant.PointStruct{
+		Id:      qdrant.NewIDUUID(PointIDForVariant(productID, variantID, 0)),
+		Vectors: vectorsFromOutput(point.Vectors),
+		Payload: payload,
+	}
+}
+
+// vectorsFromOutput 将查询返回的向量转换为可写入的向量结构
+func vectorsFromOutput(output *qdrant.VectorsOutput) *qdrant.Vectors {
+	if output == nil {
+		return nil
+	}
+
+	if vector := output.GetVector(); vector != nil {
+		return qdrant.NewVectorsDense(denseFromOutput(vector))
+	}
+
+	named := output.GetVectors().GetVectors()
+	if len(named) == 0 {
+		return nil
+	}
+
+	vectors := make(map[string]*qdrant.Vector, len(named))
+	for name, vector := range named {
+		if sparse := vector.GetSparse(); sparse != nil {
+			vectors[name] = qdrant.NewVectorSparse(sparse.GetIndices(), sparse.GetValues())
+			continue
+		}
+		vectors[name] = qdrant.NewVectorDense(denseFromOutput(vector))
+	}
+	return qdrant.NewVectorsMap(vectors)
+}
+
+// denseVectorFromOutput 提取点的默认（未命名）稠密向量，未读取向量时返回 nil
+func denseVectorFromOutput(output *qdrant.VectorsOutput) []float32 {
+	if output == nil {
+		return nil
+	}
+	if vector := output.GetVector(); vector != nil {
+		return denseFromOutput(vector)
+	}
+	if vector, ok := output.GetVectors().GetVectors()[""]; ok {
+		return denseFromOutput(vector)
+	}
+	return nil
+}
+
+// denseFromOutput 提取稠密向量数据，兼容旧版本服务端返回的 data 字段
+func denseFromOutput(vector *qdrant.VectorOutput) []float32 {
+	if dense := vector.GetDense(); dense != nil {
+		return dense.GetData()
+	}
+	return vector.GetData()
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// memoryCollection 以点 ID 为键的内存集合，模拟迁移读写的点
+type memoryCollection map[string]*qdrant.RetrievedPoint
+
+// legacyPoint 构造旧方案的数字 ID 点，向量第一维记录旧 ID 以便追踪
+func legacyPoint(num uint64, productID string) *qdrant.RetrievedPoint {
+	return &qdrant.RetrievedPoint{
+		Id:      qdrant.NewIDNum(num),
+		Payload: map[string]*qdrant.Value{"product_id": qdrant.NewValueString(productID)},
+		Vectors: &qdrant.VectorsOutput{VectorsOptions: &qdrant.VectorsOutput_Vector{
+			Vector: &qdrant.VectorOutput{Data: []float32{float32(num)}},
+		}},
+	}
+}
+
+// productPoints 商品的全部点
+func (c memoryCollection) productPoints(productID string) []*qdrant.RetrievedPoint {
+	var points []*qdrant.RetrievedPoint
+	for _, point := range c {
+		if point.Payload["product_id"].GetStringValue() == productID {
+			points = append(points, point)
+		}
+	}
+	return points
+}
+
+// migrate 按 MigratePointIDs 的流程迁移 batch 中的点；crash 为 true 时写入新点后、删除旧点前中断
+func (c memoryCollection) migrate(batch []*qdrant.RetrievedPoint, crash bool) {
+	ordinals := make(map[string]map[string]int)
+	var oldKeys []string
+	for _, point := range batch {
+		if _, migrated := point.Payload["variant_index"]; migrated {
+			continue
+		}
+		productID := point.Payload["product_id"].GetStringValue()
+		if _, ok := ordinals[productID]; !ok {
+			ordinals[productID] = variantOrdinals(c.productPoints(productID))
+		}
+
+		next := migratedPoint(productID, point, ordinals[productID][legacyPointKey(point.Id)])
+		c[next.Id.GetUuid()] = &qdrant.RetrievedPoint{
+			Id:      next.Id,
+			Payload: next.Payload,
+			Vectors: &qdrant.VectorsOutput{VectorsOptions: &qdrant.VectorsOutput_Vector{
+				Vector: &qdrant.VectorOutput{Data: next.Vectors.GetVector().GetData()},
+			}},
+		}
+		oldKeys = append(oldKeys, legacyPointKey(point.Id))
+	}
+	if crash {
+		return
+	}
+	for _, key := range oldKeys {
+		delete(c, key)
+	}
+}
+
+// sortedPoints 按旧 ID 排序的集合快照，模拟按批次滚动读取
+func (c memoryCollection) sortedPoints() []*qdrant.RetrievedPoint {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	points := make([]*qdrant.RetrievedPoint, 0, len(keys))
+	for _, key := range keys {
+		points = append(points, c[key])
+	}
+	return points
+}
+
+// variantsByLegacyID 迁移结果：旧 ID → 变体 ID
+func (c memoryCollection) variantsByLegacyID(t *testing.T) map[uint64]string {
+	t.Helper()
+	result := make(map[uint64]string)
+	for _, point := range c {
+		variantID := point.Payload["variant_id"].GetStringValue()
+		if variantID == "" {
+			t.Fatalf("legacy point %v was not migrated", point.Id)
+		}
+		legacyID := uint64(point.Vectors.GetVector().GetData()[0])
+		if previous, ok := result[legacyID]; ok {
+			t.Fatalf("legacy point %d migrated twice: %s and %s", legacyID, previous, variantID)
+		}
+		result[legacyID] = variantID
+	}
+	return result
+}
+
+func TestMigrationRerunAfterInterruption(t *testing.T) {
+	newCollection := func() memoryCollection {
+		c := memoryCollection{}
+		for num, productID := range map[uint64]string{3: "p1", 12: "p1", 5: "p1", 7: "p1", 4: "p2", 9: "p2"} {
+			point := legacyPoint(num, productID)
+			c[legacyPointKey(point.Id)] = point
+		}
+		return c
+	}
+
+	// 一次完整迁移的结果
+	clean := newCollection()
+	clean.migrate(clean.sortedPoints(), false)
+	want := clean.variantsByLegacyID(t)
+	if len(want) != 6 || want[3] != "variant_0" || want[12] != "variant_3" || want[9] != "variant_1" {
+		t.Fatalf("clean migration = %v", want)
+	}
+
+	for _, crashAfter := range []int{1, 2, 3, 5} {
+		t.Run(fmt.Sprintf("crash after %d", crashAfter), func(t *testing.T) {
+			c := newCollection()
+			points := c.sortedPoints()
+			// 前面的批次完整完成，下一批写入新点后中断
+			c.migrate(points[:crashAfter-1], false)
+			c.migrate(points[crashAfter-1:crashAfter+1], true)
+
+			// 重跑：跳过已迁移的点，重新迁移剩余旧点
+			c.migrate(c.sortedPoints(), false)
+
+			if got := c.variantsByLegacyID(t); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("rerun = %v, want %v", got, want)
+			}
+			if len(c) != 6 {
+				t.Fatalf("collection has %d points, want 6", len(c))
+			}
+		})
+	}
+}
+
+func TestVariantOrdinalsSkipsNonMigratedVariants(t *testing.T) {
+	current := &qdrant.RetrievedPoint{
+		Id:      qdrant.NewIDUUID(PointIDForVariant("p1", "variant_0", 0)),
+		Payload: map[string]*qdrant.Value{"variant_index": qdrant.NewValueInt(1)},
+	}
+	ordinals := variantOrdinals([]*qdrant.RetrievedPoint{legacyPoint(20, "p1"), current, legacyPoint(8, "p1")})
+	if ordinals[legacyPointKey(qdrant.NewIDNum(8))] != 2 || ordinals[legacyPointKey(qdrant.NewIDNum(20))] != 3 {
+		t.Fatalf("ordinals = %v", ordinals)
+	}
+}
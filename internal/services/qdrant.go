@@ -2,26 +2,64 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"search-ec2/internal/config"
 	"search-ec2/internal/models"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/qdrant/go-client/qdrant"
 	"github.com/sirupsen/logrus"
 )
 
+// pointIDNamespace 商品变体点 ID 的 UUIDv5 命名空间
+var pointIDNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("search-ec2/product-variant"))
+
+// PointIDForVariant 根据商品 ID、变体 ID 和变体代数生成确定性的点 ID（UUIDv5）
+// 每次重新生成变体都写入新的一代，新旧两代的点 ID 不同，新一代写入成功后才删除旧的点，
+// 商品在更新过程中始终可被检索。第 0 代（引入代数之前的数据）沿用原有的推导方式
+func PointIDForVariant(productID, variantID string, generation int64) string {
+	name := productID + "/" + variantID
+	if generation > 0 {
+		name += "@" + strconv.FormatInt(generation, 10)
+	}
+	return uuid.NewSHA1(pointIDNamespace, []byte(name)).String()
+}
+
+// ErrVectorParamsMismatch 集合的向量参数与配置不一致，需要重建集合后才能继续使用
+var ErrVectorParamsMismatch = errors.New("vector params mismatch")
+
 // QdrantService Qdrant 服务 - 懒加载版本
 type QdrantService struct {
 	client         *qdrant.Client
 	collectionName string
 	config         *qdrant.Config
+	vectorSize     uint64          // 配置的向量维度
+	vectorDistance qdrant.Distance // 配置的距离度量，仅用于创建集合
+	distance       qdrant.Distance // 集合实际使用的距离度量
+	hybridReady    bool            // 集合带有关键词稀疏向量，可以进行混合检索
+	sparseEncoder  *SparseEncoder
+	initMu         sync.Mutex // 保护懒加载初始化，导入任务会并发调用
 	initialized    bool
 }
 
 // NewQdrantService 创建 Qdrant 服务 - 懒加载模式
 func NewQdrantService() (*QdrantService, error) {
+	if config.AppConfig.Qdrant.VectorSize <= 0 {
+		return nil, fmt.Errorf("qdrant.vector_size must be positive, got %d", config.AppConfig.Qdrant.VectorSize)
+	}
+
+	distance, err := parseDistance(config.AppConfig.Qdrant.Distance)
+	if err != nil {
+		return nil, err
+	}
+
 	service := &QdrantService{
 		collectionName: config.AppConfig.Qdrant.CollectionName,
 		config: &qdrant.Config{
@@ -30,76 +68,218 @@ func NewQdrantService() (*QdrantService, error) {
 			APIKey: config.AppConfig.Qdrant.APIKey,
 			UseTLS: false,
 		},
-		initialized: false,
+		vectorSize:     uint64(config.AppConfig.Qdrant.VectorSize),
+		vectorDistance: distance,
+		sparseEncoder:  NewSparseEncoder(),
+		initialized:   false,
 	}
 
 	return service, nil
 }
 
+// parseDistance 解析配置中的距离度量名称（不区分大小写），为空时使用 Cosine
+func parseDistance(name string) (qdrant.Distance, error) {
+	if name == "" {
+		return qdrant.Distance_Cosine, nil
+	}
+	for _, distance := range []qdrant.Distance{
+		qdrant.Distance_Cosine, qdrant.Distance_Dot, qdrant.Distance_Euclid, qdrant.Distance_Manhattan,
+	} {
+		if strings.EqualFold(name, distance.String()) {
+			return distance, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported qdrant.distance %q (expected Cosine, Dot, Euclid or Manhattan)", name)
+}
+
+// Init 立即初始化连接并校验集合，用于启动时检查（正常调用路径仍是懒加载）
+func (s *QdrantService) Init() error {
+	return s.ensureInitialized()
+}
+
+// VectorSize 返回配置的向量维度
+func (s *QdrantService) VectorSize() int {
+	return int(s.vectorSize)
+}
+
 // ensureInitialized 确保客户端已初始化
 func (s *QdrantService) ensureInitialized() error {
+	s.initMu.Lock()
+	defer s.initMu.Unlock()
+
 	if s.initialized {
 		return nil
 	}
 
-	// 创建 Qdrant 客户端
-	client, err := qdrant.NewClient(s.config)
-	if err != nil {
-		return fmt.Errorf("failed to create Qdrant client: %w", err)
+	// 创建 Qdrant 客户端（切换别名或恢复快照后重新初始化时沿用已有连接）
+	if s.client == nil {
+		client, err := qdrant.NewClient(s.config)
+		if err != nil {
+			return fmt.Errorf("failed to create Qdrant client: %w", err)
+		}
+		s.client = client
 	}
 
-	s.client = client
-
 	// 确保集合存在
 	if err := s.ensureCollection(); err != nil {
 		return fmt.Errorf("failed to ensure collection: %w", err)
 	}
 
+	// 读取集合的向量参数
+	if err := s.loadVectorParams(); err != nil {
+		return fmt.Errorf("failed to load vector params: %w", err)
+	}
+
+	// 创建系统字段和注册属性的 payload 索引（分组、排序、过滤所需）
+	s.ensureSystemIndexes()
+	s.ensureAttributeIndexes()
+
 	s.initialized = true
 	logrus.Infof("Qdrant service initialized successfully")
 	return nil
 }
 
+// systemIndexes 系统字段的 payload 索引：商品分组、首变体和当前一代过滤以及列表排序都依赖这些字段
+var systemIndexes = map[string]qdrant.FieldType{
+	"product_id":    qdrant.FieldType_FieldTypeKeyword,
+	"variant_index": qdrant.FieldType_FieldTypeInteger,
+	"generation":    qdrant.FieldType_FieldTypeInteger,
+	"current":       qdrant.FieldType_FieldTypeBool,
+	"updated_at":    qdrant.FieldType_FieldTypeInteger,
+	"price":         qdrant.FieldType_FieldTypeFloat,
+	"status":        qdrant.FieldType_FieldTypeKeyword,
+}
+
+// ensureSystemIndexes 确保系统字段索引存在（重复创建是幂等的）
+func (s *QdrantService) ensureSystemIndexes() {
+	ctx := context.Background()
+	for field, fieldType := range systemIndexes {
+		_, err := s.client.CreateFieldIndex(ctx, &qdrant.CreateFieldIndexCollection{
+			CollectionName: s.collectionName,
+			Wait:           qdrant.PtrOf(true),
+			FieldName:      field,
+			FieldType:      qdrant.PtrOf(fieldType),
+		})
+		if err != nil {
+			logrus.Warnf("Failed to create payload index on %s: %v", field, err)
+		}
+	}
+}
+
+// loadVectorParams 读取集合的向量参数（距离度量）
+func (s *QdrantService) loadVectorParams() error {
+	info, err := s.client.GetCollectionInfo(context.Background(), s.collectionName)
+	if err != nil {
+		return fmt.Errorf("failed to get collection info: %w", err)
+	}
+
+	params := info.GetConfig().GetParams().GetVectorsConfig().GetParams()
+	if params == nil {
+		return fmt.Errorf("collection %s has no default dense vector", s.collectionName)
+	}
+
+	// 维度不一致时写入或查询都会失败，拒绝继续使用该集合
+	if params.GetSize() != s.vectorSize {
+		return fmt.Errorf("%w: collection %s has %d-dimensional vectors but qdrant.vector_size is %d; "+
+			"rebuild the collection or fix the config", ErrVectorParamsMismatch, s.collectionName, params.GetSize(), s.vectorSize)
+	}
+
+	// 距离度量不一致不影响正确性（得分会按实际度量归一化），只提示
+	s.distance = params.GetDistance()
+	if s.distance != s.vectorDistance {
+		logrus.Warnf("Collection %s uses %s distance but qdrant.distance is %s; the existing collection wins",
+			s.collectionName, s.distance, s.vectorDistance)
+	}
+	logrus.Infof("Collection %s uses %d-dimensional vectors with %s distance", s.collectionName, params.GetSize(), s.distance)
+
+	// 检查关键词稀疏向量（混合检索）
+	_, hasSparse := info.GetConfig().GetParams().GetSparseVectorsConfig().GetMap()[sparseVectorName]
+	s.hybridReady = config.AppConfig.Search.Hybrid.Enabled && hasSparse
+	if config.AppConfig.Search.Hybrid.Enabled && !hasSparse {
+		logrus.Warnf("Collection %s has no %q sparse vector, hybrid search disabled until the collection is rebuilt",
+			s.collectionName, sparseVectorName)
+	}
+	return nil
+}
+
 // ensureCollection 确保集合存在
+// collection_name 是别名时直接使用；是旧版本创建的物理集合时继续直接读写；
+// 都不存在时创建第一个版本化集合并把别名指向它（见 collection.go）
 func (s *QdrantService) ensureCollection() error {
 	ctx := context.Background()
 
+	target, isAlias, err := s.resolveAlias(ctx)
+	if err != nil {
+		return err
+	}
+	if isAlias {
+		logrus.Infof("Collection alias %s points to %s", s.collectionName, target)
+		return nil
+	}
+
 	// 检查集合是否存在
-	collections, err := s.client.ListCollections(ctx)
+	exists, err := s.client.CollectionExists(ctx, s.collectionName)
 	if err != nil {
-		return fmt.Errorf("failed to list collections: %w", err)
+		return fmt.Errorf("failed to check collection: %w", err)
+	}
+	if exists {
+		logrus.Infof("Collection %s already exists (physical collection, not an alias)", s.collectionName)
+		return nil
 	}
 
-	// 检查集合是否已存在
-	for _, collectionName := range collections {
-		if collectionName == s.collectionName {
-			logrus.Infof("Collection %s already exists", s.collectionName)
-			return nil
-		}
+	// 创建第一个版本并建立别名
+	name := versionedCollectionName(s.collectionName, time.Now())
+	if err := s.createCollection(ctx, name, s.vectorSize); err != nil {
+		return err
+	}
+	if err := s.client.CreateAlias(ctx, s.collectionName, name); err != nil {
+		return fmt.Errorf("failed to create alias %s: %w", s.collectionName, err)
 	}
 
-	// 创建集合
-	err = s.client.CreateCollection(ctx, &qdrant.CreateCollection{
-		CollectionName: s.collectionName,
+	logrus.Infof("Collection %s created with alias %s", name, s.collectionName)
+	return nil
+}
+
+// createCollection 创建集合
+func (s *QdrantService) createCollection(ctx context.Context, name string, vectorSize uint64) error {
+	createRequest := &qdrant.CreateCollection{
+		CollectionName: name,
 		VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
-			Size:     1536, // OpenAI embedding 维度
-			Distance: qdrant.Distance_Cosine,
+			Size:     vectorSize,
+			Distance: s.vectorDistance,
 		}),
-	})
+	}
 
-	if err != nil {
-		return fmt.Errorf("failed to create collection: %w", err)
+	// 混合检索需要关键词稀疏向量，IDF 由 Qdrant 在服务端计算
+	if config.AppConfig.Search.Hybrid.Enabled {
+		createRequest.SparseVectorsConfig = qdrant.NewSparseVectorsConfig(map[string]*qdrant.SparseVectorParams{
+			sparseVectorName: {Modifier: qdrant.Modifier_Idf.Enum()},
+		})
+	}
+
+	if err := s.client.CreateCollection(ctx, createRequest); err != nil {
+		return fmt.Errorf("failed to create collection %s: %w", name, err)
 	}
 
-	logrus.Infof("Collection %s created successfully", s.collectionName)
+	logrus.Infof("Collection %s created successfully", name)
 	return nil
 }
 
 // InsertProduct 插入商品及其变体 - 完整实现
+// 变体写入为商品的新一代（代数为 product.Generation 加一，调用方的 product 不会被修改）。
+// 新一代的点写入时标记为非当前（current = false），删除更早的各代后再标记为当前，
+// 因此只统计首变体的列表、计数和分面不会重复计入同一商品。写入失败时旧的变体保持不变；
+// 新一代写入成功后清理失败只记录日志并在后台重试，清理完成前列表中仍显示旧一代
 func (s *QdrantService) InsertProduct(product *models.Product, variants []models.ProductVariant) error {
 	if err := s.ensureInitialized(); err != nil {
 		return err
 	}
+	if len(variants) == 0 {
+		return fmt.Errorf("no variants to insert for product %s", product.ID)
+	}
+
+	next := *product
+	next.Generation++
 
 	ctx := context.Background()
 	points := make([]*qdrant.PointStruct, 0, len(variants))
@@ -107,64 +287,27 @@ func (s *QdrantService) InsertProduct(product *models.Product, variants []models
 	// 为每个变体创建一个点
 	for i, variant := range variants {
 		// 构建 payload - 包含商品的所有信息
-		payload := map[string]any{
-			"product_id":    product.ID,
-			"variant_id":    variant.ID,
-			"variant_text":  variant.Text,
-			"product_name":  product.Name,
-			"category":      product.Category,
-			"description":   product.Description,
-			"price":         product.Price,
-			"currency":      product.Currency,
-			"brand":         product.Brand,
-			"color":         product.Color,
-			"size":          product.Size,
-			"material":      product.Material,
-			"style":         product.Style,
-			"gender":        product.Gender,
-			"occasion":      product.Occasion,
-			"created_at":    product.CreatedAt.Unix(),
-			"updated_at":    product.UpdatedAt.Unix(),
-		}
-
-		// 添加标签 - 转换为 []interface{}
-		if len(product.Tags) > 0 {
-			tags := make([]interface{}, len(product.Tags))
-			for i, tag := range product.Tags {
-				tags[i] = tag
-			}
-			payload["tags"] = tags
-		}
-
-		// 添加图片URL - 转换为 []interface{}
-		if len(product.ImageURLs) > 0 {
-			urls := make([]interface{}, len(product.ImageURLs))
-			for i, url := range product.ImageURLs {
-				urls[i] = url
-			}
-			payload["image_urls"] = urls
-		}
-
-		// 添加自定义属性
-		if len(product.Attributes) > 0 {
-			for key, value := range product.Attributes {
-				payload["attr_"+key] = fmt.Sprintf("%v", value)
-			}
-		}
-
-		// 创建点结构 - 使用数字ID
+		payload := s.productPayload(&next)
+		payload["variant_id"] = variant.ID
+		payload["variant_index"] = i
+		payload["variant_text"] = variant.Text
+		payload["generated_at"] = variant.GeneratedAt.Unix()
+		payload[currentGenerationField] = false
+
+		// 创建点结构 - 使用由商品 ID、变体 ID 和代数派生的确定性 ID
 		point := &qdrant.PointStruct{
-			Id:      qdrant.NewIDNum(uint64(i + 1)), // 使用数字ID，后续可以改进ID生成策略
-			Vectors: qdrant.NewVectors(variant.Vector...),
+			Id:      qdrant.NewIDUUID(PointIDForVariant(next.ID, variant.ID, next.Generation)),
+			Vectors: s.pointVectors(&next, variant),
 			Payload: qdrant.NewValueMap(payload),
 		}
 
 		points = append(points, point)
 	}
 
-	// 批量插入点到 Qdrant
+	// 批量插入点到 Qdrant，等待写入完成后再清理旧的点
 	operationInfo, err := s.client.Upsert(ctx, &qdrant.UpsertPoints{
 		CollectionName: s.collectionName,
+		Wait:           qdrant.PtrOf(true),
 		Points:         points,
 	})
 
@@ -172,157 +315,775 @@ func (s *QdrantService) InsertProduct(product *models.Product, variants []models
 		return fmt.Errorf("failed to upsert points to Qdrant: %w", err)
 	}
 
+	// 新一代已经写入，读取单个商品时只使用最新一代；清理失败不影响本次写入的结果
+	if err := s.retireGenerations(ctx, next.ID, next.Generation); err != nil {
+		logrus.Warnf("Failed to retire previous variant generations of product %s, retrying in background: %v", next.ID, err)
+		s.scheduleGenerationCleanup(next.ID, next.Generation)
+	}
+
 	logrus.Infof("Successfully inserted product %s with %d variants to Qdrant. Operation ID: %d", 
 		product.ID, len(variants), operationInfo.OperationId)
 	return nil
 }
 
-// SearchProducts 搜索商品 - 完整实现
-func (s *QdrantService) SearchProducts(queryVector []float32, filter map[string]interface{}, limit int) ([]models.SearchResult, error) {
+// currentGenerationField 标记变体点是否属于商品的当前一代，只有值为 false 的点被排除（旧数据没有该字段，视为当前）
+const currentGenerationField = "current"
+
+// 后台清理旧一代变体的重试次数和首次重试间隔（之后每次加倍）
+const (
+	generationCleanupAttempts = 5
+	generationCleanupDelay    = 5 * time.Second
+)
+
+// retireGenerations 删除商品中代数小于 generation 的变体点，再将 generation 这一代标记为当前
+// 按代数而不是点 ID 删除，延迟执行的清理不会误删之后写入的更新一代
+func (s *QdrantService) retireGenerations(ctx context.Context, productID string, generation int64) error {
+	_, err := s.client.Delete(ctx, &qdrant.DeletePoints{
+		CollectionName: s.collectionName,
+		Wait:           qdrant.PtrOf(true),
+		Points: qdrant.NewPointsSelectorFilter(&qdrant.Filter{
+			Must: []*qdrant.Condition{
+				qdrant.NewMatch("product_id", productID),
+			},
+			MustNot: []*qdrant.Condition{
+				qdrant.NewRange("generation", &qdrant.Range{Gte: qdrant.PtrOf(float64(generation))}),
+			},
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete previous variant generations: %w", err)
+	}
+
+	_, err = s.client.SetPayload(ctx, &qdrant.SetPayloadPoints{
+		CollectionName: s.collectionName,
+		Wait:           qdrant.PtrOf(true),
+		Payload:        qdrant.NewValueMap(map[string]any{currentGenerationField: true}),
+		PointsSelector: qdrant.NewPointsSelectorFilter(&qdrant.Filter{
+			Must: []*qdrant.Condition{
+				qdrant.NewMatch("product_id", productID),
+				qdrant.NewMatchInt("generation", generation),
+			},
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark variant generation %d as current: %w", generation, err)
+	}
+	return nil
+}
+
+// scheduleGenerationCleanup 在后台重试 retireGenerations；全部失败时旧一代会在商品下次重新生成变体时被删除
+func (s *QdrantService) scheduleGenerationCleanup(productID string, generation int64) {
+	go func() {
+		delay := generationCleanupDelay
+		for attempt := 1; attempt <= generationCleanupAttempts; attempt++ {
+			time.Sleep(delay)
+			err := s.retireGenerations(context.Background(), productID, generation)
+			if err == nil {
+				logrus.Infof("Retired previous variant generations of product %s", productID)
+				return
+			}
+			logrus.Warnf("Cleanup attempt %d/%d for product %s failed: %v", attempt, generationCleanupAttempts, productID, err)
+			delay *= 2
+		}
+		logrus.Errorf("Giving up cleanup of previous variant generations of product %s", productID)
+	}()
+}
+
+// productPayloadOptionalKeys 为空时不写入 payload 的商品字段
+var productPayloadOptionalKeys = []string{"tags", "image_urls", models.AttributesField}
+
+// productPayload 构建商品级别的 payload（同一商品的所有变体点相同），同时更新商品的内容摘要和变体指纹
+func (s *QdrantService) productPayload(product *models.Product) map[string]any {
+	status := product.Status
+	if status == "" {
+		status = models.ProductStatusActive
+	}
+	product.ContentHash = product.ComputeContentHash()
+	product.VariantHash = VariantHash(product)
+
+	payload := map[string]any{
+		"product_id":   product.ID,
+		"product_name": product.Name,
+		"category":     product.Category,
+		"description":  product.Description,
+		"price":        product.Price,
+		"currency":     product.Currency,
+		"brand":        product.Brand,
+		"color":        product.Color,
+		"size":         product.Size,
+		"material":     product.Material,
+		"style":        product.Style,
+		"gender":       product.Gender,
+		"occasion":     product.Occasion,
+		"status":       status,
+		"content_hash": product.ContentHash,
+		"variant_hash": product.VariantHash,
+		"generation":   product.Generation,
+		"created_at":   product.CreatedAt.Unix(),
+		"updated_at":   product.UpdatedAt.Unix(),
+	}
+
+	// 添加标签 - 转换为 []interface{}
+	if len(product.Tags) > 0 {
+		tags := make([]interface{}, len(product.Tags))
+		for i, tag := range product.Tags {
+			tags[i] = tag
+		}
+		payload["tags"] = tags
+	}
+
+	// 添加图片URL - 转换为 []interface{}
+	if len(product.ImageURLs) > 0 {
+		urls := make([]interface{}, len(product.ImageURLs))
+		for i, url := range product.ImageURLs {
+			urls[i] = url
+		}
+		payload["image_urls"] = urls
+	}
+
+	// 添加自定义属性（保留原始类型，支持范围过滤）
+	if len(product.Attributes) > 0 {
+		payload[models.AttributesField] = normalizeAttributes(product.Attributes)
+	}
+
+	return payload
+}
+
+// UpdateProductPayload 只更新商品字段，保留已有的变体文本和稠密向量
+// 用于变体指纹未变化的更新：所有变体点的商品 payload 被替换，变为空的可选字段被删除；
+// 混合检索时关键词稀疏向量会用已存储的变体文本重新计算（不涉及 LLM 和 embedding 调用）。
+// product.Variants 必须是商品当前已存储的变体
+func (s *QdrantService) UpdateProductPayload(product *models.Product) error {
 	if err := s.ensureInitialized(); err != nil {
-		return nil, err
+		return err
+	}
+	if len(product.Variants) == 0 {
+		return fmt.Errorf("%w: %s", ErrProductNotFound, product.ID)
 	}
 
+	// 只更新当前一代的点，未清理干净的旧一代保持原样
 	ctx := context.Background()
+	pointIDs := make([]*qdrant.PointId, 0, len(product.Variants))
+	for _, variant := range product.Variants {
+		pointIDs = append(pointIDs, qdrant.NewIDUUID(PointIDForVariant(product.ID, variant.ID, product.Generation)))
+	}
+	selector := qdrant.NewPointsSelectorIDs(pointIDs)
 
-	// 构建查询请求
-	queryRequest := &qdrant.QueryPoints{
+	payload := s.productPayload(product)
+	_, err := s.client.SetPayload(ctx, &qdrant.SetPayloadPoints{
 		CollectionName: s.collectionName,
-		Query:          qdrant.NewQuery(queryVector...),
-		Limit:          qdrant.PtrOf(uint64(limit)),
-		WithPayload:    qdrant.NewWithPayload(true),
+		Wait:           qdrant.PtrOf(true),
+		Payload:        qdrant.NewValueMap(payload),
+		PointsSelector: selector,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set product payload: %w", err)
 	}
 
-	// 构建过滤条件 - 增强版本
-	if len(filter) > 0 {
-		mustConditions := make([]*qdrant.Condition, 0)
-		shouldConditions := make([]*qdrant.Condition, 0)
-		mustNotConditions := make([]*qdrant.Condition, 0)
-		
-		// 处理各种过滤条件
-		for key, value := range filter {
-			switch key {
-			case "price_min":
-				if minPrice, ok := value.(float64); ok {
-					mustConditions = append(mustConditions, qdrant.NewRange("price", &qdrant.Range{
-						Gte: &minPrice,
-					}))
-				}
-			case "price_max":
-				if maxPrice, ok := value.(float64); ok {
-					mustConditions = append(mustConditions, qdrant.NewRange("price", &qdrant.Range{
-						Lte: &maxPrice,
-					}))
-				}
-			case "brand", "color", "size", "material", "style", "gender", "occasion", "category":
-				if strValue, ok := value.(string); ok && strValue != "" {
-					mustConditions = append(mustConditions, qdrant.NewMatch(key, strValue))
-				}
-			case "exclude_brand", "exclude_color": // 排除条件
-				if strValue, ok := value.(string); ok && strValue != "" {
-					actualKey := strings.TrimPrefix(key, "exclude_")
-					mustNotConditions = append(mustNotConditions, qdrant.NewMatch(actualKey, strValue))
-				}
-			case "any_tags": // 任意标签匹配 (OR 逻辑)
-				if tags, ok := value.([]interface{}); ok {
-					for _, tag := range tags {
-						if tagStr, ok := tag.(string); ok && tagStr != "" {
-							shouldConditions = append(shouldConditions, qdrant.NewMatch("tags", tagStr))
-						}
-					}
-				}
+	removed := make([]string, 0, len(productPayloadOptionalKeys))
+	for _, key := range productPayloadOptionalKeys {
+		if _, ok := payload[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	if len(removed) > 0 {
+		_, err = s.client.DeletePayload(ctx, &qdrant.DeletePayloadPoints{
+			CollectionName: s.collectionName,
+			Wait:           qdrant.PtrOf(true),
+			Keys:           removed,
+			PointsSelector: selector,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete product payload keys: %w", err)
+		}
+	}
+
+	// 关键词稀疏向量包含商品名称、品牌和可检索属性，需要随商品字段更新
+	if s.hybridReady {
+		points := make([]*qdrant.PointVectors, 0, len(product.Variants))
+		for i, variant := range product.Variants {
+			sparse := s.sparseEncoder.EncodeDocument(sparseDocumentText(product, variant))
+			if sparse.IsEmpty() {
+				continue
 			}
+			points = append(points, &qdrant.PointVectors{
+				Id: pointIDs[i],
+				Vectors: qdrant.NewVectorsMap(map[string]*qdrant.Vector{
+					sparseVectorName: qdrant.NewVectorSparse(sparse.Indices, sparse.Values),
+				}),
+			})
 		}
-		
-		// 构建过滤器
-		if len(mustConditions) > 0 || len(shouldConditions) > 0 || len(mustNotConditions) > 0 {
-			filterObj := &qdrant.Filter{}
-			
-			if len(mustConditions) > 0 {
-				filterObj.Must = mustConditions
+		if len(points) > 0 {
+			_, err = s.client.UpdateVectors(ctx, &qdrant.UpdatePointVectors{
+				CollectionName: s.collectionName,
+				Wait:           qdrant.PtrOf(true),
+				Points:         points,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to update sparse vectors: %w", err)
 			}
-			if len(shouldConditions) > 0 {
-				filterObj.Should = shouldConditions
+		}
+	}
+
+	logrus.Infof("Updated payload of product %s on %d variant points", product.ID, len(product.Variants))
+	return nil
+}
+
+// pointVectors 构建变体点的向量：稠密向量，以及混合检索时的关键词稀疏向量
+func (s *QdrantService) pointVectors(product *models.Product, variant models.ProductVariant) *qdrant.Vectors {
+	if !s.hybridReady {
+		return qdrant.NewVectors(variant.Vector...)
+	}
+
+	vectors := map[string]*qdrant.Vector{
+		"": qdrant.NewVectorDense(variant.Vector), // 默认（未命名）稠密向量
+	}
+	sparse := s.sparseEncoder.EncodeDocument(sparseDocumentText(product, variant))
+	if !sparse.IsEmpty() {
+		vectors[sparseVectorName] = qdrant.NewVectorSparse(sparse.Indices, sparse.Values)
+	}
+	return qdrant.NewVectorsMap(vectors)
+}
+
+// SearchParams 商品搜索参数
+type SearchParams struct {
+	Vector []float32
+	Filter *models.Filter
+	Limit  int // 每页商品数量
+	Offset int // 跳过的商品数量
+
+	// 相似度阈值，nil 表示不限制；开启归一化时按余弦尺度解释（只作用于稠密检索）
+	ScoreThreshold *float64
+
+	// 混合检索：QueryText 用于关键词（稀疏向量）检索，两路结果按权重做 RRF 融合
+	QueryText    string
+	DenseWeight  float64
+	SparseWeight float64
+}
+
+// SearchProducts 搜索商品 - 按商品聚合变体命中
+// 每个商品只出现一次，附带得分最高的若干变体；分页以商品为单位。
+// Qdrant 的分组查询不支持 offset，这里取回 offset+limit+1 个分组后在本地切片，
+// 并按 (得分降序, product_id 升序) 排序，保证同一查询在各页之间顺序稳定。
+// 集合带有关键词稀疏向量且 SparseWeight > 0 时，稠密与稀疏两路分别检索后做加权 RRF 融合，
+// 此时返回的得分为融合得分；相似度阈值同样作用于只被关键词命中的商品（按其稠密相似度判断）。
+// 返回当前页结果以及是否还有下一页。
+func (s *QdrantService) SearchProducts(params SearchParams) ([]models.SearchResult, bool, error) {
+	if err := s.ensureInitialized(); err != nil {
+		return nil, false, err
+	}
+
+	ctx := context.Background()
+	filter := params.Filter
+	window := params.Offset + params.Limit + 1
+
+	// 构建过滤条件
+	qdrantFilter, err := buildQdrantFilter(filter)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 相似度阈值交给 Qdrant 过滤，避免把不相关的商品拉回本地
+	normalize := config.AppConfig.Search.NormalizeScores
+	threshold := s.scoreThreshold(params.ScoreThreshold)
+
+	// 稠密向量检索
+	dense, err := s.queryGroups(ctx, &qdrant.QueryPointGroups{
+		Query:          qdrant.NewQuery(params.Vector...),
+		Filter:         qdrantFilter,
+		Limit:          qdrant.PtrOf(uint64(window)),
+		ScoreThreshold: threshold,
+	}, func(score float32) float64 {
+		return s.resultScore(score, normalize)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	for i := range dense {
+		dense[i].MatchReason = s.generateMatchReason(float32(normalizeScore(dense[i].rawScore, s.distance)), filter)
+	}
+
+	results := make([]models.SearchResult, 0, len(dense))
+	descending := normalize || higherIsBetter(s.distance)
+
+	// 关键词稀疏向量检索 + 融合
+	sparseQuery := s.sparseEncoder.EncodeQuery(params.QueryText)
+	if s.hybridReady && params.SparseWeight > 0 && !sparseQuery.IsEmpty() {
+		sparse, err := s.queryGroups(ctx, &qdrant.QueryPointGroups{
+			Query:  qdrant.NewQuerySparse(sparseQuery.Indices, sparseQuery.Values),
+			Using:  qdrant.PtrOf(sparseVectorName),
+			Filter: qdrantFilter,
+			Limit:  qdrant.PtrOf(uint64(window)),
+		}, func(score float32) float64 {
+			return float64(score)
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		if threshold != nil {
+			passing, err := s.productsAboveThreshold(ctx, params.Vector, qdrantFilter, threshold, sparseOnlyIDs(dense, sparse))
+			if err != nil {
+				return nil, false, err
 			}
-			if len(mustNotConditions) > 0 {
-				filterObj.MustNot = mustNotConditions
+			sparse = sparseCandidates(dense, sparse, passing)
+		}
+
+		results = fuseRRF(dense, sparse, params.DenseWeight, params.SparseWeight)
+		descending = true
+	} else {
+		for _, hit := range dense {
+			results = append(results, hit.SearchResult)
+		}
+	}
+
+	// 稳定排序后按 offset 切片；未归一化的距离类得分越小越好
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return (results[i].Score > results[j].Score) == descending
+		}
+		return resultProductID(results[i]) < resultProductID(results[j])
+	})
+
+	hasMore := len(results) > params.Offset+params.Limit
+	if params.Offset >= len(results) {
+		results = results[:0]
+	} else {
+		end := params.Offset + params.Limit
+		if end > len(results) {
+			end = len(results)
+		}
+		results = results[params.Offset:end]
+	}
+
+	logrus.Infof("Search completed: found %d products from Qdrant (offset=%d, has_more=%v)",
+		len(results), params.Offset, hasMore)
+	return results, hasMore, nil
+}
+
+// scoreThreshold 将相似度阈值换算为 Qdrant 的原始得分阈值，nil 表示不限制
+func (s *QdrantService) scoreThreshold(threshold *float64) *float32 {
+	if threshold == nil {
+		return nil
+	}
+	raw := float32(*threshold)
+	if config.AppConfig.Search.NormalizeScores {
+		raw = rawThreshold(*threshold, s.distance)
+	}
+	return &raw
+}
+
+// SearchMatchIDs 返回与 SearchProducts 口径一致的命中商品 ID（相似度阈值、关键词检索都生效，
+// 只被关键词命中的商品同样要达到相似度阈值），用于统计总数和限定分面范围
+// 分组查询无法计数，这里最多取回 window 个商品，即可以翻页到的商品
+func (s *QdrantService) SearchMatchIDs(params SearchParams, window int) ([]string, error) {
+	if err := s.ensureInitialized(); err != nil {
+		return nil, err
+	}
+	if window <= 0 {
+		window = 1000
+	}
+
+	ctx := context.Background()
+	qdrantFilter, err := buildQdrantFilter(params.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	threshold := s.scoreThreshold(params.ScoreThreshold)
+	matched, err := s.matchedProducts(ctx, &qdrant.QueryPointGroups{
+		Query:          qdrant.NewQuery(params.Vector...),
+		Filter:         qdrantFilter,
+		ScoreThreshold: threshold,
+	}, window)
+	if err != nil {
+		return nil, err
+	}
+
+	sparseQuery := s.sparseEncoder.EncodeQuery(params.QueryText)
+	if s.hybridReady && params.SparseWeight > 0 && !sparseQuery.IsEmpty() {
+		sparse, err := s.matchedProducts(ctx, &qdrant.QueryPointGroups{
+			Query:  qdrant.NewQuerySparse(sparseQuery.Indices, sparseQuery.Values),
+			Using:  qdrant.PtrOf(sparseVectorName),
+			Filter: qdrantFilter,
+		}, window)
+		if err != nil {
+			return nil, err
+		}
+
+		// 只被关键词命中的商品同样要满足相似度阈值
+		dense := make(map[string]bool, len(matched))
+		for _, id := range matched {
+			dense[id] = true
+		}
+		var sparseOnly []string
+		for _, id := range sparse {
+			if !dense[id] {
+				sparseOnly = append(sparseOnly, id)
 			}
-			
-			queryRequest.Filter = filterObj
+		}
+		if threshold != nil {
+			passing, err := s.productsAboveThreshold(ctx, params.Vector, qdrantFilter, threshold, sparseOnly)
+			if err != nil {
+				return nil, err
+			}
+			sparseOnly = slices.DeleteFunc(sparseOnly, func(id string) bool { return !passing[id] })
+		}
+		matched = append(matched, sparseOnly...)
+	}
+
+	if len(matched) > window {
+		matched = matched[:window]
+	}
+	return matched, nil
+}
+
+// matchedProducts 执行分组查询，只返回命中的商品 ID
+func (s *QdrantService) matchedProducts(ctx context.Context, request *qdrant.QueryPointGroups, limit int) ([]string, error) {
+	request.CollectionName = s.collectionName
+	request.GroupBy = "product_id"
+	request.GroupSize = qdrant.PtrOf(uint64(1))
+	request.Limit = qdrant.PtrOf(uint64(limit))
+	request.WithPayload = qdrant.NewWithPayload(false)
+
+	groups, err := s.client.QueryGroups(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Qdrant: %w", err)
+	}
+	ids := make([]string, 0, len(groups))
+	for _, group := range groups {
+		ids = append(ids, group.GetId().GetStringValue())
+	}
+	return ids, nil
+}
+
+// productsAboveThreshold 返回 productIDs 中稠密相似度达到阈值的商品
+// 关键词命中的商品可能因为稠密检索的窗口有限而没有出现在稠密结果中，这里限定商品 ID 后单独确认
+func (s *QdrantService) productsAboveThreshold(ctx context.Context, vector []float32, filter *qdrant.Filter, threshold *float32, productIDs []string) (map[string]bool, error) {
+	passing := make(map[string]bool, len(productIDs))
+	if len(productIDs) == 0 {
+		return passing, nil
+	}
+
+	restricted := &qdrant.Filter{Must: []*qdrant.Condition{qdrant.NewMatchKeywords("product_id", productIDs...)}}
+	if filter != nil {
+		restricted.Must = append(restricted.Must, qdrant.NewFilterAsCondition(filter))
+	}
+	ids, err := s.matchedProducts(ctx, &qdrant.QueryPointGroups{
+		Query:          qdrant.NewQuery(vector...),
+		Filter:         restricted,
+		ScoreThreshold: threshold,
+	}, len(productIDs))
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		passing[id] = true
+	}
+	return passing, nil
+}
+
+// sparseOnlyIDs 只被关键词检索命中、没有出现在稠密结果中的商品 ID
+func sparseOnlyIDs(dense, sparse []groupHit) []string {
+	inDense := make(map[string]bool, len(dense))
+	for _, hit := range dense {
+		inDense[resultProductID(hit.SearchResult)] = true
+	}
+	var ids []string
+	for _, hit := range sparse {
+		if id := resultProductID(hit.SearchResult); !inDense[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// sparseCandidates 保留稠密结果中也出现的关键词命中，以及 passing 中达到相似度阈值的关键词命中，顺序不变
+func sparseCandidates(dense, sparse []groupHit, passing map[string]bool) []groupHit {
+	inDense := make(map[string]bool, len(dense))
+	for _, hit := range dense {
+		inDense[resultProductID(hit.SearchResult)] = true
+	}
+	kept := make([]groupHit, 0, len(sparse))
+	for _, hit := range sparse {
+		if id := resultProductID(hit.SearchResult); inDense[id] || passing[id] {
+			kept = append(kept, hit)
 		}
 	}
+	return kept
+}
+
+// groupHit 单路检索中的一个商品命中
+type groupHit struct {
+	models.SearchResult
+	rawScore float32 // 最佳变体的原始得分
+}
 
-	// 执行查询
-	searchResult, err := s.client.Query(ctx, queryRequest)
+// queryGroups 执行按 product_id 分组的查询，结果保持 Qdrant 返回的排名顺序
+func (s *QdrantService) queryGroups(ctx context.Context, request *qdrant.QueryPointGroups, scoreFn func(float32) float64) ([]groupHit, error) {
+	// 每个商品返回的变体数量
+	groupSize := config.AppConfig.Search.VariantsPerProduct
+	if groupSize <= 0 {
+		groupSize = 3
+	}
+
+	request.CollectionName = s.collectionName
+	request.GroupBy = "product_id"
+	request.GroupSize = qdrant.PtrOf(uint64(groupSize))
+	request.WithPayload = qdrant.NewWithPayload(true)
+
+	groups, err := s.client.QueryGroups(ctx, request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query Qdrant: %w", err)
 	}
 
-	// 转换结果
-	results := make([]models.SearchResult, 0, len(searchResult))
-	for _, point := range searchResult {
-		result := models.SearchResult{
-			Score: float64(point.Score),
+	hits := make([]groupHit, 0, len(groups))
+	for _, group := range groups {
+		if len(group.Hits) == 0 {
+			continue
+		}
+
+		// 组内命中按得分排序，第一个即最佳变体
+		best := group.Hits[0]
+		hit := groupHit{
+			SearchResult: models.SearchResult{
+				Score:           scoreFn(best.Score),
+				MatchedVariants: make([]models.MatchedVariant, 0, len(group.Hits)),
+			},
+			rawScore: best.Score,
 		}
 
 		// 解析 payload 构建商品信息
-		if point.Payload != nil {
-			product := s.parseProductFromPayload(point.Payload)
-			result.Product = product
-			
-			// 获取匹配的变体文本
-			if variantText, exists := point.Payload["variant_text"]; exists {
-				result.Variant = s.extractStringFromValue(variantText)
+		if best.Payload != nil {
+			hit.Product = s.parseProductFromPayload(best.Payload)
+			hit.Variant = s.extractStringFromValue(best.Payload["variant_text"])
+		}
+
+		for _, point := range group.Hits {
+			hit.MatchedVariants = append(hit.MatchedVariants, models.MatchedVariant{
+				VariantID: s.extractStringFromValue(point.Payload["variant_id"]),
+				Text:      s.extractStringFromValue(point.Payload["variant_text"]),
+				Score:     scoreFn(point.Score),
+			})
+		}
+
+		hits = append(hits, hit)
+	}
+
+	return hits, nil
+}
+
+// fuseRRF 加权倒数排名融合：score = Σ weight / (k + rank)
+// 两路都命中的商品以稠密结果为基础，合并关键词命中的变体
+func fuseRRF(dense, sparse []groupHit, denseWeight, sparseWeight float64) []models.SearchResult {
+	k := float64(config.AppConfig.Search.Hybrid.RRFK)
+	if k <= 0 {
+		k = 60
+	}
+
+	fused := make(map[string]*models.SearchResult)
+	order := make([]string, 0, len(dense)+len(sparse))
+
+	for rank, hit := range dense {
+		result := hit.SearchResult
+		result.Score = denseWeight / (k + float64(rank+1))
+		id := resultProductID(result)
+		fused[id] = &result
+		order = append(order, id)
+	}
+
+	for rank, hit := range sparse {
+		id := resultProductID(hit.SearchResult)
+		contribution := sparseWeight / (k + float64(rank+1))
+
+		existing, ok := fused[id]
+		if !ok {
+			result := hit.SearchResult
+			result.Score = contribution
+			result.MatchReason = "关键词匹配"
+			fused[id] = &result
+			order = append(order, id)
+			continue
+		}
+
+		existing.Score += contribution
+		existing.MatchReason += " + 关键词匹配"
+		seen := make(map[string]bool, len(existing.MatchedVariants))
+		for _, variant := range existing.MatchedVariants {
+			seen[variant.VariantID] = true
+		}
+		for _, variant := range hit.MatchedVariants {
+			if !seen[variant.VariantID] {
+				existing.MatchedVariants = append(existing.MatchedVariants, variant)
 			}
-			
-			// 生成匹配原因
-			result.MatchReason = s.generateMatchReason(point.Score, filter)
 		}
+	}
 
-		results = append(results, result)
+	results := make([]models.SearchResult, 0, len(order))
+	for _, id := range order {
+		results = append(results, *fused[id])
 	}
+	return results
+}
 
-	logrus.Infof("Search completed: found %d results from Qdrant", len(results))
-	return results, nil
+// resultScore 计算返回给调用方的得分
+func (s *QdrantService) resultScore(raw float32, normalize bool) float64 {
+	if normalize {
+		return normalizeScore(raw, s.distance)
+	}
+	return float64(raw)
 }
 
-// GetProduct 获取商品信息 - 完整实现
-func (s *QdrantService) GetProduct(productID string) (*models.Product, error) {
+// resultProductID 获取搜索结果的商品 ID
+func resultProductID(result models.SearchResult) string {
+	if result.Product == nil {
+		return ""
+	}
+	return result.Product.ID
+}
+
+// CountProducts 统计满足过滤条件的商品数量
+// 每个商品当前一代的首个变体（见 productFilter）代表该商品，只统计这些点即可避免按变体和代数重复计数
+func (s *QdrantService) CountProducts(filter *models.Filter) (int, error) {
 	if err := s.ensureInitialized(); err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	ctx := context.Background()
+	qdrantFilter, err := productFilter(filter)
+	if err != nil {
+		return 0, err
+	}
 
-	// 使用 Query 方法查找指定商品ID的点，使用零向量进行查询
-	zeroVector := make([]float32, 1536) // 使用零向量，因为我们主要依赖过滤条件
-	
-	searchResult, err := s.client.Query(ctx, &qdrant.QueryPoints{
+	count, err := s.client.Count(context.Background(), &qdrant.CountPoints{
 		CollectionName: s.collectionName,
-		Query:          qdrant.NewQuery(zeroVector...),
-		Filter: &qdrant.Filter{
-			Must: []*qdrant.Condition{
-				qdrant.NewMatch("product_id", productID),
-			},
-		},
-		Limit:       qdrant.PtrOf(uint64(1)), // 只需要一个结果
-		WithPayload: qdrant.NewWithPayload(true),
+		Filter:         qdrantFilter,
+		Exact:          qdrant.PtrOf(true),
 	})
-
 	if err != nil {
-		return nil, fmt.Errorf("failed to query product from Qdrant: %w", err)
+		return 0, fmt.Errorf("failed to count products: %w", err)
 	}
 
-	if len(searchResult) == 0 {
-		return nil, fmt.Errorf("product not found in Qdrant")
+	return int(count), nil
+}
+
+// ErrProductNotFound 商品不存在
+var ErrProductNotFound = errors.New("product not found")
+
+// GetProduct 获取商品信息及其全部变体
+func (s *QdrantService) GetProduct(productID string) (*models.Product, error) {
+	products, err := s.GetProducts([]string{productID})
+	if err != nil {
+		return nil, err
 	}
 
-	// 解析第一个结果
-	point := searchResult[0]
-	product := s.parseProductFromPayload(point.Payload)
+	if len(products) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrProductNotFound, productID)
+	}
 
 	logrus.Infof("Successfully retrieved product %s from Qdrant", productID)
-	return product, nil
+	return products[0], nil
+}
+
+// GetProducts 批量获取商品及其变体
+// 通过 product_id 过滤直接滚动读取点，不做向量检索；按传入顺序返回，不存在的 ID 会被跳过
+func (s *QdrantService) GetProducts(productIDs []string) ([]*models.Product, error) {
+	return s.getProducts(productIDs, false)
+}
+
+// getProducts 批量获取商品及其变体，withVectors 为 true 时同时读取变体的稠密向量
+func (s *QdrantService) getProducts(productIDs []string, withVectors bool) ([]*models.Product, error) {
+	if err := s.ensureInitialized(); err != nil {
+		return nil, err
+	}
+
+	if len(productIDs) == 0 {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	filter := &qdrant.Filter{
+		Must: []*qdrant.Condition{
+			qdrant.NewMatchKeywords("product_id", productIDs...),
+		},
+	}
+
+	// 按商品收集变体点
+	pointsByProduct := make(map[string][]*qdrant.RetrievedPoint, len(productIDs))
+	var offset *qdrant.PointId
+	for {
+		points, nextOffset, err := s.client.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+			CollectionName: s.collectionName,
+			Filter:         filter,
+			Limit:          qdrant.PtrOf(uint32(256)),
+			Offset:         offset,
+			WithPayload:    qdrant.NewWithPayload(true),
+			WithVectors:    qdrant.NewWithVectors(withVectors),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scroll products from Qdrant: %w", err)
+		}
+
+		for _, point := range points {
+			productID := s.extractStringFromValue(point.Payload["product_id"])
+			pointsByProduct[productID] = append(pointsByProduct[productID], point)
+		}
+
+		if nextOffset == nil {
+			break
+		}
+		offset = nextOffset
+	}
+
+	products := make([]*models.Product, 0, len(productIDs))
+	for _, productID := range productIDs {
+		points, ok := pointsByProduct[productID]
+		if !ok {
+			continue
+		}
+		delete(pointsByProduct, productID) // 重复的 ID 只返回一次
+		products = append(products, s.productFromVariantPoints(points))
+	}
+
+	return products, nil
+}
+
+// productFromVariantPoints 由同一商品的全部变体点组装商品，商品字段取自首个变体
+// 重新生成变体的过程中（或旧一代清理失败时）可能同时存在多代变体，只使用最新一代
+func (s *QdrantService) productFromVariantPoints(points []*qdrant.RetrievedPoint) *models.Product {
+	latest := int64(0)
+	for _, point := range points {
+		if generation := s.extractIntFromValue(point.Payload["generation"]); generation > latest {
+			latest = generation
+		}
+	}
+	current := points[:0:0]
+	for _, point := range points {
+		if s.extractIntFromValue(point.Payload["generation"]) == latest {
+			current = append(current, point)
+		}
+	}
+	points = current
+
+	sort.Slice(points, func(i, j int) bool {
+		return s.extractIntFromValue(points[i].Payload["variant_index"]) <
+			s.extractIntFromValue(points[j].Payload["variant_index"])
+	})
+
+	product := s.parseProductFromPayload(points[0].Payload)
+	product.Variants = make([]models.ProductVariant, 0, len(points))
+	for _, point := range points {
+		variant := models.ProductVariant{
+			ID:        s.extractStringFromValue(point.Payload["variant_id"]),
+			ProductID: product.ID,
+			Text:      s.extractStringFromValue(point.Payload["variant_text"]),
+		}
+		if generatedAt := s.extractIntFromValue(point.Payload["generated_at"]); generatedAt > 0 {
+			variant.GeneratedAt = time.Unix(generatedAt, 0)
+		}
+		variant.Vector = denseVectorFromOutput(point.GetVectors())
+		product.Variants = append(product.Variants, variant)
+	}
+
+	return product
 }
 
 // DeleteProduct 删除商品及其所有变体 - 优化版本
@@ -354,6 +1115,49 @@ func (s *QdrantService) DeleteProduct(productID string) error {
 	return nil
 }
 
+// SetProductStatus 修改商品状态（软删除 / 下架 / 恢复），不重新生成变体
+func (s *QdrantService) SetProductStatus(productID, status string) error {
+	if err := s.ensureInitialized(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	filter := &qdrant.Filter{
+		Must: []*qdrant.Condition{
+			qdrant.NewMatch("product_id", productID),
+		},
+	}
+
+	// SetPayload 对不存在的商品不会报错，先确认商品存在
+	count, err := s.client.Count(ctx, &qdrant.CountPoints{
+		CollectionName: s.collectionName,
+		Filter:         filter,
+		Exact:          qdrant.PtrOf(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to count product points: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: %s", ErrProductNotFound, productID)
+	}
+
+	_, err = s.client.SetPayload(ctx, &qdrant.SetPayloadPoints{
+		CollectionName: s.collectionName,
+		Wait:           qdrant.PtrOf(true),
+		Payload: qdrant.NewValueMap(map[string]any{
+			"status":     status,
+			"updated_at": time.Now().Unix(),
+		}),
+		PointsSelector: qdrant.NewPointsSelectorFilter(filter),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set product status: %w", err)
+	}
+
+	logrus.Infof("Product %s status set to %s", productID, status)
+	return nil
+}
+
 // extractStringFromValue 从 qdrant.Value 中提取字符串
 func (s *QdrantService) extractStringFromValue(value *qdrant.Value) string {
 	if value == nil {
@@ -399,9 +1203,7 @@ func (s *QdrantService) extractArrayFromValue(value *qdrant.Value) []string {
 }
 // parseProductFromPayload 从 Qdrant payload 解析商品信息
 func (s *QdrantService) parseProductFromPayload(payload map[string]*qdrant.Value) *models.Product {
-	product := &models.Product{
-		Attributes: make(map[string]interface{}),
-	}
+	product := &models.Product{}
 
 	// 解析基础字段
 	if val, ok := payload["product_id"]; ok {
@@ -444,6 +1246,22 @@ func (s *QdrantService) parseProductFromPayload(payload map[string]*qdrant.Value
 		product.Occasion = s.extractStringFromValue(val)
 	}
 
+	// 旧数据没有写入状态，视为上架
+	product.Status = models.ProductStatusActive
+	if val, ok := payload["status"]; ok && s.extractStringFromValue(val) != "" {
+		product.Status = s.extractStringFromValue(val)
+	}
+
+	if val, ok := payload["content_hash"]; ok {
+		product.ContentHash = s.extractStringFromValue(val)
+	}
+	if val, ok := payload["variant_hash"]; ok {
+		product.VariantHash = s.extractStringFromValue(val)
+	}
+	if val, ok := payload["generation"]; ok {
+		product.Generation = s.extractIntFromValue(val)
+	}
+
 	// 解析时间戳
 	if val, ok := payload["created_at"]; ok {
 		product.CreatedAt = time.Unix(s.extractIntFromValue(val), 0)
@@ -463,18 +1281,13 @@ func (s *QdrantService) parseProductFromPayload(payload map[string]*qdrant.Value
 	}
 
 	// 解析自定义属性
-	for key, val := range payload {
-		if strings.HasPrefix(key, "attr_") {
-			attrKey := strings.TrimPrefix(key, "attr_")
-			product.Attributes[attrKey] = s.extractStringFromValue(val)
-		}
-	}
+	product.Attributes = attributesFromPayload(payload)
 
 	return product
 }
 
 // generateMatchReason 生成匹配原因说明
-func (s *QdrantService) generateMatchReason(score float32, filter map[string]interface{}) string {
+func (s *QdrantService) generateMatchReason(score float32, filter *models.Filter) string {
 	reasons := make([]string, 0)
 	
 	// 基于相似度评分
@@ -487,16 +1300,20 @@ func (s *QdrantService) generateMatchReason(score float32, filter map[string]int
 	}
 	
 	// 基于过滤条件
-	if len(filter) > 0 {
+	if !filter.IsEmpty() {
 		filterReasons := make([]string, 0)
-		for key := range filter {
+		priceMatched := false
+		for _, key := range filter.Keys() {
 			switch key {
 			case "brand":
 				filterReasons = append(filterReasons, "品牌匹配")
 			case "color":
 				filterReasons = append(filterReasons, "颜色匹配")
-			case "price_min", "price_max":
-				filterReasons = append(filterReasons, "价格范围匹配")
+			case "price":
+				if !priceMatched {
+					priceMatched = true
+					filterReasons = append(filterReasons, "价格范围匹配")
+				}
 			case "size":
 				filterReasons = append(filterReasons, "尺寸匹配")
 			}
@@ -508,85 +1325,196 @@ func (s *QdrantService) generateMatchReason(score float32, filter map[string]int
 	
 	return strings.Join(reasons, " + ")
 }
-// ScrollProducts 分页获取商品 - 修复版本
-func (s *QdrantService) ScrollProducts(filter map[string]interface{}, limit uint32, offset *qdrant.PointId) ([]models.Product, *qdrant.PointId, error) {
+// ProductListParams 商品列表参数
+type ProductListParams struct {
+	Filter *models.Filter
+	SortBy string // 为空时按点 ID 顺序；支持 updated_at、price
+	Desc   bool
+	Limit  uint32
+	Cursor string // 上一页返回的 next_cursor
+}
+
+// ErrInvalidListRequest 商品列表参数或游标不合法
+var ErrInvalidListRequest = errors.New("invalid list request")
+
+// listCursor 商品列表游标状态
+type listCursor struct {
+	Sort   string   `json:"k"`           // 排序方式，用于校验游标
+	Offset string   `json:"o,omitempty"` // 按 ID 顺序时的下一个点 ID
+	Value  *float64 `json:"v,omitempty"` // 按字段排序时上一页最后的排序值
+	Skip   []string `json:"s,omitempty"` // 排序值等于 Value 且已返回过的点
+}
+
+// listSortFields 支持排序的字段
+var listSortFields = map[string]bool{
+	"updated_at": true,
+	"price":      true,
+}
+
+// ScrollProducts 分页获取商品
+// 只遍历每个商品当前一代的首个变体点（见 productFilter），因此每个商品恰好出现一次。
+// 按 ID 顺序时使用 Qdrant 的 next_page_offset；按字段排序时 Qdrant 只支持 start_from，
+// 游标记录上一页最后的排序值以及该值上已返回的点，下一页从该值开始并排除这些点。
+func (s *QdrantService) ScrollProducts(params ProductListParams) ([]models.Product, string, error) {
 	if err := s.ensureInitialized(); err != nil {
-		return nil, nil, err
+		return nil, "", err
+	}
+
+	if params.SortBy != "" && !listSortFields[params.SortBy] {
+		return nil, "", fmt.Errorf("%w: unsupported sort field %q", ErrInvalidListRequest, params.SortBy)
+	}
+
+	sortKey := params.SortBy
+	if sortKey != "" && params.Desc {
+		sortKey += ":desc"
+	}
+
+	var cursor listCursor
+	if params.Cursor != "" {
+		if err := models.DecodeCursor(params.Cursor, &cursor); err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrInvalidListRequest, err)
+		}
+		if cursor.Sort != sortKey {
+			return nil, "", fmt.Errorf("%w: cursor does not match sort order", ErrInvalidListRequest)
+		}
 	}
 
 	ctx := context.Background()
 
+	// 构建过滤条件（与搜索共用同一转换）
+	qdrantFilter, err := productFilter(params.Filter)
+	if err != nil {
+		return nil, "", err
+	}
+
 	// 构建 Scroll 请求
 	scrollRequest := &qdrant.ScrollPoints{
 		CollectionName: s.collectionName,
-		Limit:          qdrant.PtrOf(limit),
+		Filter:         qdrantFilter,
+		Limit:          qdrant.PtrOf(params.Limit),
 		WithPayload:    qdrant.NewWithPayload(true),
 	}
 
-	// 添加偏移量（用于分页）
-	if offset != nil {
-		scrollRequest.Offset = offset
-	}
+	if params.SortBy == "" {
+		if cursor.Offset != "" {
+			scrollRequest.Offset = pointIDFromString(cursor.Offset)
+		}
 
-	// 构建过滤条件
-	if len(filter) > 0 {
-		mustConditions := make([]*qdrant.Condition, 0)
-		
-		for key, value := range filter {
-			switch key {
-			case "category", "brand", "color", "size":
-				if strValue, ok := value.(string); ok && strValue != "" {
-					mustConditions = append(mustConditions, qdrant.NewMatch(key, strValue))
-				}
-			case "price_min":
-				if minPrice, ok := value.(float64); ok {
-					mustConditions = append(mustConditions, qdrant.NewRange("price", &qdrant.Range{
-						Gte: &minPrice,
-					}))
-				}
-			case "price_max":
-				if maxPrice, ok := value.(float64); ok {
-					mustConditions = append(mustConditions, qdrant.NewRange("price", &qdrant.Range{
-						Lte: &maxPrice,
-					}))
-				}
-			}
+		points, nextOffset, err := s.client.ScrollAndOffset(ctx, scrollRequest)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to scroll products from Qdrant: %w", err)
 		}
-		
-		if len(mustConditions) > 0 {
-			scrollRequest.Filter = &qdrant.Filter{
-				Must: mustConditions,
+
+		nextCursor := ""
+		if nextOffset != nil {
+			nextCursor, err = models.EncodeCursor(listCursor{Sort: sortKey, Offset: pointIDToString(nextOffset)})
+			if err != nil {
+				return nil, "", err
 			}
 		}
+		return s.productsFromPoints(points), nextCursor, nil
 	}
 
-	// 执行 Scroll
-	response, err := s.client.Scroll(ctx, scrollRequest)
+	// 按字段排序：多取一条用于判断是否还有下一页
+	direction := qdrant.Direction_Asc
+	if params.Desc {
+		direction = qdrant.Direction_Desc
+	}
+	orderBy := &qdrant.OrderBy{Key: params.SortBy, Direction: &direction}
+	if cursor.Value != nil {
+		orderBy.StartFrom = startFromValue(params.SortBy, *cursor.Value)
+		skipIDs := make([]*qdrant.PointId, 0, len(cursor.Skip))
+		for _, id := range cursor.Skip {
+			skipIDs = append(skipIDs, pointIDFromString(id))
+		}
+		if len(skipIDs) > 0 {
+			qdrantFilter.MustNot = append(qdrantFilter.MustNot, qdrant.NewHasID(skipIDs...))
+		}
+	}
+	scrollRequest.OrderBy = orderBy
+	scrollRequest.Limit = qdrant.PtrOf(params.Limit + 1)
+
+	points, err := s.client.Scroll(ctx, scrollRequest)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to scroll products from Qdrant: %w", err)
+		return nil, "", fmt.Errorf("failed to scroll products from Qdrant: %w", err)
 	}
 
-	// 转换结果并去重（因为一个商品可能有多个变体）
-	productMap := make(map[string]*models.Product)
-	for _, point := range response {
-		if point.Payload != nil {
-			product := s.parseProductFromPayload(point.Payload)
-			if product.ID != "" {
-				productMap[product.ID] = product
-			}
+	if len(points) <= int(params.Limit) {
+		return s.productsFromPoints(points), "", nil
+	}
+	points = points[:params.Limit]
+
+	// 记录最后一个排序值上已返回的点
+	last := orderValueOf(points[len(points)-1])
+	next := listCursor{Sort: sortKey, Value: &last}
+	if cursor.Value != nil && *cursor.Value == last {
+		next.Skip = append(next.Skip, cursor.Skip...)
+	}
+	for _, point := range points {
+		if orderValueOf(point) == last {
+			next.Skip = append(next.Skip, pointIDToString(point.Id))
 		}
 	}
 
-	// 转换为数组
-	products := make([]models.Product, 0, len(productMap))
-	for _, product := range productMap {
-		products = append(products, *product)
+	nextCursor, err := models.EncodeCursor(next)
+	if err != nil {
+		return nil, "", err
 	}
+	return s.productsFromPoints(points), nextCursor, nil
+}
 
-	logrus.Infof("Scrolled %d unique products from Qdrant", len(products))
-	// 简化返回，暂时不处理 NextPageOffset
-	return products, nil, nil
+// productsFromPoints 将点转换为商品列表
+func (s *QdrantService) productsFromPoints(points []*qdrant.RetrievedPoint) []models.Product {
+	products := make([]models.Product, 0, len(points))
+	for _, point := range points {
+		if point.Payload == nil {
+			continue
+		}
+		product := s.parseProductFromPayload(point.Payload)
+		if product.ID != "" {
+			products = append(products, *product)
+		}
+	}
+	return products
 }
+
+// orderValueOf 获取点的排序值
+func orderValueOf(point *qdrant.RetrievedPoint) float64 {
+	value := point.GetOrderValue()
+	if _, ok := value.GetVariant().(*qdrant.OrderValue_Int); ok {
+		return float64(value.GetInt())
+	}
+	return value.GetFloat()
+}
+
+// startFromValue 构建排序起点，整数字段使用整数起点
+func startFromValue(key string, value float64) *qdrant.StartFrom {
+	if key == "updated_at" {
+		return qdrant.NewStartFromInt(int64(value))
+	}
+	return qdrant.NewStartFromFloat(value)
+}
+
+// pointIDToString 将点 ID 编码为字符串（数字 ID 加 "n:" 前缀）
+func pointIDToString(id *qdrant.PointId) string {
+	if uuidStr := id.GetUuid(); uuidStr != "" {
+		return uuidStr
+	}
+	return fmt.Sprintf("n:%d", id.GetNum())
+}
+
+// pointIDFromString 解析 pointIDToString 编码的点 ID
+func pointIDFromString(value string) *qdrant.PointId {
+	if strings.HasPrefix(value, "n:") {
+		num, err := strconv.ParseUint(strings.TrimPrefix(value, "n:"), 10, 64)
+		if err == nil {
+			return qdrant.NewIDNum(num)
+		}
+	}
+	return qdrant.NewIDUUID(value)
+}
+
+// GetStats 获取 Qdrant 统计信息
 func (s *QdrantService) GetStats() (map[string]interface{}, error) {
 	stats := map[string]interface{}{
 		"collection_name": s.collectionName,
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"math"
+	"search-ec2/internal/config"
+	"search-ec2/internal/models"
+	"testing"
+)
+
+// hit 构造一个召回结果
+func hit(productID string, variants ...string) groupHit {
+	result := models.SearchResult{Product: &models.Product{ID: productID}, MatchReason: "语义匹配"}
+	for _, id := range variants {
+		result.MatchedVariants = append(result.MatchedVariants, models.MatchedVariant{VariantID: id})
+	}
+	return groupHit{SearchResult: result}
+}
+
+func TestFuseRRF(t *testing.T) {
+	previous := config.AppConfig
+	config.AppConfig = &config.Config{Search: config.SearchConfig{Hybrid: config.HybridSearchConfig{RRFK: 10}}}
+	t.Cleanup(func() { config.AppConfig = previous })
+
+	dense := []groupHit{hit("a", "a-1"), hit("b", "b-1")}
+	sparse := []groupHit{hit("c", "c-1"), hit("b", "b-1", "b-2")}
+
+	results := fuseRRF(dense, sparse, 1, 0.5)
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+
+	scores := make(map[string]models.SearchResult)
+	for _, result := range results {
+		scores[result.Product.ID] = result
+	}
+	want := map[string]float64{
+		"a": 1.0 / 11,
+		"b": 1.0/12 + 0.5/12,
+		"c": 0.5 / 11,
+	}
+	for id, score := range want {
+		if got := scores[id].Score; math.Abs(got-score) > 1e-12 {
+			t.Errorf("%s score = %v, want %v", id, got, score)
+		}
+	}
+
+	// 两路都命中的商品合并变体且不重复
+	b := scores["b"]
+	if b.MatchReason != "语义匹配 + 关键词匹配" || len(b.MatchedVariants) != 2 {
+		t.Errorf("b = %+v", b)
+	}
+	if c := scores["c"]; c.MatchReason != "关键词匹配" {
+		t.Errorf("c reason = %q", c.MatchReason)
+	}
+	// 融合不修改输入
+	if len(dense[1].MatchedVariants) != 1 {
+		t.Errorf("dense hit was modified: %+v", dense[1])
+	}
+}
+
+func TestFuseRRFDefaultK(t *testing.T) {
+	previous := config.AppConfig
+	config.AppConfig = &config.Config{}
+	t.Cleanup(func() { config.AppConfig = previous })
+
+	results := fuseRRF([]groupHit{hit("a")}, nil, 1, 1)
+	if len(results) != 1 || math.Abs(results[0].Score-1.0/61) > 1e-12 {
+		t.Fatalf("results = %+v, want score 1/61", results)
+	}
+}
+
+func TestSparseCandidatesApplyThreshold(t *testing.T) {
+	previous := config.AppConfig
+	config.AppConfig = &config.Config{Search: config.SearchConfig{Hybrid: config.HybridSearchConfig{RRFK: 10}}}
+	t.Cleanup(func() { config.AppConfig = previous })
+
+	dense := []groupHit{hit("a"), hit("b")}
+	sparse := []groupHit{hit("c"), hit("b"), hit("d")}
+
+	if got := sparseOnlyIDs(dense, sparse); len(got) != 2 || got[0] != "c" || got[1] != "d" {
+		t.Fatalf("sparseOnlyIDs = %v, want [c d]", got)
+	}
+
+	// c 的稠密相似度低于阈值，d 达到阈值但不在稠密检索的窗口内
+	kept := sparseCandidates(dense, sparse, map[string]bool{"d": true})
+	results := fuseRRF(dense, kept, 1, 1)
+
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.Product.ID)
+	}
+	if len(ids) != 3 || ids[0] != "a" || ids[1] != "b" || ids[2] != "d" {
+		t.Fatalf("fused products = %v, want [a b d]", ids)
+	}
+	// 过滤后按剩余的关键词命中重新排名：b 为第 1 名，d 为第 2 名
+	if b := results[1].Score; math.Abs(b-(1.0/12+1.0/11)) > 1e-12 {
+		t.Errorf("b score = %v", b)
+	}
+	if d := results[2].Score; math.Abs(d-1.0/12) > 1e-12 {
+		t.Errorf("d score = %v", d)
+	}
+}
@@ -0,0 +1,942 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"search-ec2/internal/config"
+	"search-ec2/internal/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/qdrant/go-client/qdrant"
+	"github.com/sirupsen/logrus"
+)
+
+// 重建索引（蓝绿切换）
+// 更换 embedding 模型或变体提示词后需要重新向量化整个商品目录。重建在新的版本化集合中进行，
+// 期间线上读写继续经过别名使用原集合：
+//   1. 构建：逐个读取原集合中的商品，用目标模型重新向量化已存储的变体文本（或调用 LLM 重新生成变体），写入新集合
+//   2. 追平：再同步一次构建期间更新或删除的商品，然后校验两个集合的商品数量
+//   3. 切换：再追平一次后原子地把别名指向新集合，并把切换窗口内写入原集合的更新补到新集合
+// 原集合保留，回滚时把切换后写入新集合的更新同步回去（复用变体文本，用原模型重新向量化）再切回别名。
+// 任务状态保存在任务目录中；服务重启时构建中的任务标记为失败，新集合可以通过 API 删除。
+
+var (
+	// ErrReindexJobNotFound 重建任务不存在
+	ErrReindexJobNotFound = errors.New("reindex job not found")
+	// ErrReindexJobState 任务当前状态不允许该操作
+	ErrReindexJobState = errors.New("invalid reindex job state")
+	// ErrReindexValidation 新集合未通过校验
+	ErrReindexValidation = errors.New("reindex validation failed")
+)
+
+const (
+	defaultReindexJobDir  = "data/reindex_jobs"
+	defaultReindexWorkers = 4
+
+	reindexBatchSize       = 100 // 每批读取的商品数
+	reindexPersistInterval = 50  // 每处理多少个商品落盘一次
+	maxReindexErrorReport  = 100 // 任务中最多保留的错误条数
+)
+
+// servingMu 线上使用的 embedding 模型（以及配置中的模型和向量维度）必须与别名指向的集合一致：
+// 读写 Qdrant 时持有读锁，切换别名和模型时持有写锁。向量化不持有锁（见 WithServing），
+// 否则 embedding 服务的重试和限流等待会让切换一直等下去
+var servingMu sync.RWMutex
+
+// servingGeneration 线上模型和集合的版本号，每次切换加一，受 servingMu 保护
+var servingGeneration uint64
+
+// maxServingAttempts 向量化期间模型被切换时最多重新向量化的次数
+const maxServingAttempts = 3
+
+// ErrServingChanged 多次重试期间线上的 embedding 模型一直在切换
+var ErrServingChanged = errors.New("embedding model changed during request")
+
+// AcquireServing 获取读锁，调用返回的函数释放；期间线上的 embedding 模型和集合不会被切换
+func AcquireServing() (release func()) {
+	servingMu.RLock()
+	return servingMu.RUnlock
+}
+
+// WithServing 不持锁执行 prepare（向量化），再持读锁确认期间线上的模型和集合没有被切换后执行 apply（读写 Qdrant）；
+// 发生了切换时 prepare 得到的向量属于旧模型，重新执行 prepare
+func WithServing(prepare, apply func() error) error {
+	for attempt := 1; ; attempt++ {
+		servingMu.RLock()
+		generation := servingGeneration
+		servingMu.RUnlock()
+
+		if err := prepare(); err != nil {
+			return err
+		}
+
+		servingMu.RLock()
+		if servingGeneration == generation {
+			defer servingMu.RUnlock()
+			return apply()
+		}
+		servingMu.RUnlock()
+
+		if attempt >= maxServingAttempts {
+			return ErrServingChanged
+		}
+		logrus.Infof("Embedding model switched while embedding, retrying with the new model")
+	}
+}
+
+// EmbeddingModelSwitcher 线上使用的 embedding 服务，切换集合时同步切换模型
+type EmbeddingModelSwitcher interface {
+	Model() string
+	SetModel(model string)
+}
+
+// reindexJobState 内存中的任务状态
+type reindexJobState struct {
+	job     models.ReindexJob
+	cancel  bool // 已请求取消
+	unsaved int  // 上次落盘后处理的商品数
+}
+
+// ReindexManager 重建索引任务管理器，同一时间只执行一个任务（构建、切换或回滚）
+type ReindexManager struct {
+	qdrant    *QdrantService
+	embedding EmbeddingModelSwitcher // 可以为 nil（命令行工具），此时只切换别名
+	variants  *VariantGenerationService
+	dir       string
+	workers   int
+
+	mu     sync.Mutex
+	jobs   map[string]*reindexJobState
+	active string // 正在构建、切换或回滚的任务
+}
+
+// NewReindexManager 创建重建索引任务管理器并加载任务目录中的任务
+func NewReindexManager(qdrantService *QdrantService, embedding EmbeddingModelSwitcher, variants *VariantGenerationService) (*ReindexManager, error) {
+	cfg := config.AppConfig.Reindex
+	m := &ReindexManager{
+		qdrant:    qdrantService,
+		embedding: embedding,
+		variants:  variants,
+		dir:       cfg.JobDir,
+		workers:   cfg.Workers,
+		jobs:      make(map[string]*reindexJobState),
+	}
+	if m.dir == "" {
+		m.dir = defaultReindexJobDir
+	}
+	if m.workers <= 0 {
+		m.workers = defaultReindexWorkers
+	}
+
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create reindex job dir: %w", err)
+	}
+	if err := m.loadJobs(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Start 创建新的版本化集合并在后台构建，立即返回任务快照
+// 未指定模型时使用当前模型；指定了新模型时先探测其向量维度，与 vector_size 不一致则拒绝
+func (m *ReindexManager) Start(opts models.ReindexOptions) (*models.ReindexJob, error) {
+	if opts.VectorSize < 0 {
+		return nil, fmt.Errorf("vector_size cannot be negative")
+	}
+	if opts.RegenerateVariants && m.variants == nil {
+		return nil, fmt.Errorf("variant generation is not available")
+	}
+
+	previousModel := m.currentModel()
+	previousSize := m.qdrant.VectorSize()
+	if opts.EmbeddingModel == "" {
+		opts.EmbeddingModel = previousModel
+	}
+
+	embedder := newReindexEmbedder(opts.EmbeddingModel)
+	probe, err := embedder.GetEmbedding(context.Background(), "dimension probe")
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe embedding model %s: %w", opts.EmbeddingModel, err)
+	}
+	if opts.VectorSize == 0 {
+		opts.VectorSize = len(probe)
+	}
+	if len(probe) != opts.VectorSize {
+		return nil, fmt.Errorf("%w: embedding model %s returns %d-dimensional vectors, vector_size is %d",
+			ErrVectorParamsMismatch, opts.EmbeddingModel, len(probe), opts.VectorSize)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.active != "" {
+		return nil, fmt.Errorf("%w: reindex job %s is in progress", ErrReindexJobState, m.active)
+	}
+
+	source, err := m.qdrant.LiveCollection()
+	if err != nil {
+		return nil, err
+	}
+	target, err := m.qdrant.CreateCollectionVersion(opts.VectorSize)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	state := &reindexJobState{job: models.ReindexJob{
+		ID:                     uuid.New().String(),
+		Status:                 models.ReindexRunning,
+		Options:                opts,
+		SourceCollection:       source,
+		TargetCollection:       target,
+		PreviousEmbeddingModel: previousModel,
+		PreviousVectorSize:     previousSize,
+		SyncedAt:               now,
+		CreatedAt:              now,
+		UpdatedAt:              now,
+	}}
+	m.jobs[state.job.ID] = state
+	m.active = state.job.ID
+	if err := m.save(state); err != nil {
+		logrus.Errorf("Failed to persist reindex job %s: %v", state.job.ID, err)
+	}
+
+	logrus.Infof("Reindex job %s started: %s -> %s (model %s, %d dimensions)",
+		state.job.ID, source, target, opts.EmbeddingModel, opts.VectorSize)
+	go m.run(state, embedder)
+
+	return m.snapshot(state, true), nil
+}
+
+// Get 获取任务快照
+func (m *ReindexManager) Get(jobID string) (*models.ReindexJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.jobs[jobID]
+	if !ok {
+		return nil, ErrReindexJobNotFound
+	}
+	return m.snapshot(state, true), nil
+}
+
+// List 列出全部任务（按创建时间倒序，不含错误明细）
+func (m *ReindexManager) List() []*models.ReindexJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs := make([]*models.ReindexJob, 0, len(m.jobs))
+	for _, state := range m.jobs {
+		jobs = append(jobs, m.snapshot(state, false))
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// Cancel 取消任务：构建中的任务在当前批次处理完后停止；已构建未切换的任务直接放弃。新集合会被删除
+func (m *ReindexManager) Cancel(jobID string) (*models.ReindexJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.jobs[jobID]
+	if !ok {
+		return nil, ErrReindexJobNotFound
+	}
+
+	switch state.job.Status {
+	case models.ReindexRunning:
+		state.cancel = true
+	case models.ReindexReady, models.ReindexValidationFailed:
+		if m.active == jobID {
+			return nil, fmt.Errorf("%w: job is switching", ErrReindexJobState)
+		}
+		m.dropTarget(state)
+		m.finishLocked(state, models.ReindexCancelled)
+		if err := m.save(state); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: job is %s", ErrReindexJobState, state.job.Status)
+	}
+
+	logrus.Infof("Reindex job %s cancellation requested", jobID)
+	return m.snapshot(state, true), nil
+}
+
+// Switch 把别名切换到任务构建的新集合
+// 切换前再同步一次源集合上的更新并重新校验，force 为 true 时校验不通过也切换
+func (m *ReindexManager) Switch(jobID string, force bool) (*models.ReindexJob, error) {
+	state, err := m.acquire(jobID, func(job *models.ReindexJob) bool {
+		return job.Status == models.ReindexReady || job.Status == models.ReindexValidationFailed
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer m.release()
+
+	opts := state.job.Options
+	source, err := m.qdrant.forCollection(state.job.SourceCollection, state.job.PreviousVectorSize)
+	if err != nil {
+		return nil, err
+	}
+	target, err := m.qdrant.forCollection(state.job.TargetCollection, opts.VectorSize)
+	if err != nil {
+		return nil, err
+	}
+
+	cutover := &reindexCutover{
+		from:       source,
+		to:         target,
+		embedder:   newReindexEmbedder(opts.EmbeddingModel),
+		regenerate: opts.RegenerateVariants,
+		since:      state.job.SyncedAt,
+		dropLegacy: opts.DropLegacy,
+		force:      force,
+	}
+	switchedAt, err := m.cutover(state, cutover)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		if errors.Is(err, ErrReindexValidation) {
+			state.job.Status = models.ReindexValidationFailed
+		}
+		state.job.Message = err.Error()
+		state.job.UpdatedAt = time.Now()
+		m.saveLogged(state)
+		return nil, err
+	}
+
+	state.job.Status = models.ReindexSwitched
+	state.job.SwitchedAt = &switchedAt
+	state.job.SyncedAt = switchedAt
+	state.job.Message = ""
+	state.job.UpdatedAt = time.Now()
+	m.saveLogged(state)
+
+	logrus.Infof("Reindex job %s switched alias to %s", jobID, state.job.TargetCollection)
+	return m.snapshot(state, true), nil
+}
+
+// Rollback 把别名切回最近一次切换前的集合
+// 切换后写入新集合的更新会先同步回原集合（复用变体文本，用原模型重新向量化）
+func (m *ReindexManager) Rollback() (*models.ReindexJob, error) {
+	m.mu.Lock()
+	var latest *reindexJobState
+	for _, state := range m.jobs {
+		if state.job.Status != models.ReindexSwitched {
+			continue
+		}
+		if latest == nil || state.job.SwitchedAt.After(*latest.job.SwitchedAt) {
+			latest = state
+		}
+	}
+	m.mu.Unlock()
+	if latest == nil {
+		return nil, fmt.Errorf("%w: no switched reindex job to roll back", ErrReindexJobState)
+	}
+
+	state, err := m.acquire(latest.job.ID, func(job *models.ReindexJob) bool {
+		return job.Status == models.ReindexSwitched
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer m.release()
+
+	job := state.job
+	live, err := m.qdrant.LiveCollection()
+	if err != nil {
+		return nil, err
+	}
+	if live != job.TargetCollection {
+		return nil, fmt.Errorf("%w: alias points to %s, not %s", ErrReindexJobState, live, job.TargetCollection)
+	}
+	if job.SourceCollection == m.qdrant.collectionName {
+		return nil, fmt.Errorf("%w: legacy collection %s was dropped when switching", ErrReindexJobState, job.SourceCollection)
+	}
+
+	target, err := m.qdrant.forCollection(job.TargetCollection, job.Options.VectorSize)
+	if err != nil {
+		return nil, err
+	}
+	source, err := m.qdrant.forCollection(job.SourceCollection, job.PreviousVectorSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// 回滚不重新生成变体，校验不通过也切回
+	cutover := &reindexCutover{
+		from:       target,
+		to:         source,
+		embedder:   newReindexEmbedder(job.PreviousEmbeddingModel),
+		regenerate: false,
+		since:      *job.SwitchedAt,
+		force:      true,
+	}
+	if _, err := m.cutover(state, cutover); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.finishLocked(state, models.ReindexRolledBack)
+	m.saveLogged(state)
+
+	logrus.Infof("Reindex job %s rolled back, alias points to %s again", job.ID, job.SourceCollection)
+	return m.snapshot(state, true), nil
+}
+
+// acquire 占用任务管理器执行切换或回滚
+func (m *ReindexManager) acquire(jobID string, allowed func(job *models.ReindexJob) bool) (*reindexJobState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.jobs[jobID]
+	if !ok {
+		return nil, ErrReindexJobNotFound
+	}
+	if m.active != "" {
+		return nil, fmt.Errorf("%w: reindex job %s is in progress", ErrReindexJobState, m.active)
+	}
+	if !allowed(&state.job) {
+		return nil, fmt.Errorf("%w: job is %s", ErrReindexJobState, state.job.Status)
+	}
+	m.active = jobID
+	return state, nil
+}
+
+// release 释放任务管理器
+func (m *ReindexManager) release() {
+	m.mu.Lock()
+	m.active = ""
+	m.mu.Unlock()
+}
+
+// run 构建新集合：复制全部商品、追平并校验
+func (m *ReindexManager) run(state *reindexJobState, embedder *EmbeddingService) {
+	err := m.build(state, embedder)
+
+	m.mu.Lock()
+	m.active = ""
+	switch {
+	case err != nil:
+		state.job.Message = err.Error()
+		m.dropTarget(state)
+		m.finishLocked(state, models.ReindexFailed)
+	case state.cancel:
+		state.cancel = false
+		m.dropTarget(state)
+		m.finishLocked(state, models.ReindexCancelled)
+	case state.job.Validation.Passed:
+		state.job.Status = models.ReindexReady
+	default:
+		state.job.Status = models.ReindexValidationFailed
+		state.job.Message = fmt.Sprintf("source has %d products, target has %d",
+			state.job.Validation.SourceCount, state.job.Validation.TargetCount)
+	}
+	state.job.UpdatedAt = time.Now()
+	m.saveLogged(state)
+	job := state.job
+	m.mu.Unlock()
+
+	logrus.Infof("Reindex job %s %s: %d/%d processed, %d failed, %d caught up", job.ID, job.Status,
+		job.Processed, job.Total, job.Failed, job.CaughtUp)
+
+	if job.Status == models.ReindexReady && job.Options.AutoSwitch {
+		if _, err := m.Switch(job.ID, false); err != nil {
+			logrus.Errorf("Reindex job %s auto switch failed: %v", job.ID, err)
+		}
+	}
+}
+
+// build 复制全部商品到新集合，再追平构建期间的更新并校验数量
+func (m *ReindexManager) build(state *reindexJobState, embedder *EmbeddingService) error {
+	m.mu.Lock()
+	job := state.job
+	m.mu.Unlock()
+
+	source, err := m.qdrant.forCollection(job.SourceCollection, job.PreviousVectorSize)
+	if err != nil {
+		return err
+	}
+	target, err := m.qdrant.forCollection(job.TargetCollection, job.Options.VectorSize)
+	if err != nil {
+		return err
+	}
+
+	productIDs, err := source.scrollProductIDs(nil)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	state.job.Total = len(productIDs)
+	m.mu.Unlock()
+
+	if err := m.copyProducts(state, source, target, embedder, job.Options.RegenerateVariants, productIDs, true); err != nil {
+		return err
+	}
+	if m.isCancelled(state) {
+		return nil
+	}
+
+	// 追平构建期间的更新和删除
+	since := time.Now()
+	caughtUp, err := m.syncProducts(state, source, target, embedder, job.Options.RegenerateVariants, job.SyncedAt, true)
+	if err != nil {
+		return err
+	}
+
+	validation, err := validateReindex(source, target)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	state.job.CaughtUp += caughtUp
+	state.job.SyncedAt = since
+	state.job.Validation = validation
+	m.mu.Unlock()
+	return nil
+}
+
+// reindexCutover 一次别名切换：先把 from 上 since 之后的更新同步到 to，校验后把别名指向 to，
+// 再同步切换窗口内写入 from 的更新
+type reindexCutover struct {
+	from       *QdrantService
+	to         *QdrantService
+	embedder   *EmbeddingService // to 使用的 embedding 模型
+	regenerate bool
+	since      time.Time
+	dropLegacy bool
+	force      bool // 校验不通过也切换
+}
+
+// cutover 执行切换，返回切换时间
+func (m *ReindexManager) cutover(state *reindexJobState, c *reindexCutover) (time.Time, error) {
+	caughtUp, err := m.syncProducts(state, c.from, c.to, c.embedder, c.regenerate, c.since, true)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	validation, err := validateReindex(c.from, c.to)
+	if err != nil {
+		return time.Time{}, err
+	}
+	m.mu.Lock()
+	state.job.CaughtUp += caughtUp
+	state.job.Validation = validation
+	m.mu.Unlock()
+
+	if !validation.Passed && !c.force {
+		return time.Time{}, fmt.Errorf("%w: source has %d products, target has %d",
+			ErrReindexValidation, validation.SourceCount, validation.TargetCount)
+	}
+
+	switchedAt := time.Now()
+	previous, err := m.switchServing(c)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// 切换窗口内写入原集合的更新；这里不同步删除，新集合中切换后新建的商品在原集合中本来就不存在
+	if previous != "" {
+		caughtUp, err := m.syncProducts(state, c.from, c.to, c.embedder, c.regenerate, switchedAt, false)
+		if err != nil {
+			logrus.Warnf("Failed to sync updates written during the switch: %v", err)
+		}
+		m.mu.Lock()
+		state.job.CaughtUp += caughtUp
+		m.mu.Unlock()
+	}
+
+	return switchedAt, nil
+}
+
+// switchServing 在 servingMu 写锁内切换别名以及线上的 embedding 模型，返回别名原来指向的集合
+// 进行中的查询和写入完成后才切换，之后的请求都使用新模型和新集合
+func (m *ReindexManager) switchServing(c *reindexCutover) (string, error) {
+	servingMu.Lock()
+	defer servingMu.Unlock()
+
+	previous, err := m.qdrant.SwitchCollection(c.to.collectionName, c.to.VectorSize(), c.dropLegacy)
+	if err != nil {
+		return "", err
+	}
+	m.applyModel(c.embedder.Model(), c.to.VectorSize())
+	servingGeneration++
+	return previous, nil
+}
+
+// applyModel 切换后同步线上服务的 embedding 模型和配置中的向量维度，调用方持有 servingMu 写锁
+// 只修改内存中的配置，重启前需要同步修改配置文件，否则启动时的维度校验会失败
+func (m *ReindexManager) applyModel(model string, vectorSize int) {
+	if m.embedding != nil && m.embedding.Model() != model {
+		m.embedding.SetModel(model)
+	}
+	if config.AppConfig.OpenAI.EmbeddingModel != model || config.AppConfig.Qdrant.VectorSize != vectorSize {
+		logrus.Warnf("Embedding model is now %s with %d dimensions; update openai.embedding_model and qdrant.vector_size in the config file before restarting",
+			model, vectorSize)
+	}
+	config.AppConfig.OpenAI.EmbeddingModel = model
+	config.AppConfig.Qdrant.VectorSize = vectorSize
+}
+
+// syncProducts 把 from 上 since 之后更新过的商品同步到 to，返回同步的商品数
+// withDeletes 为 true 时同时删除 to 中有而 from 中没有的商品
+func (m *ReindexManager) syncProducts(state *reindexJobState, from, to *QdrantService, embedder *EmbeddingService,
+	regenerate bool, since time.Time, withDeletes bool) (int, error) {
+	since = since.Add(-time.Second) // updated_at 精度为秒
+	updated, err := from.scrollProductIDs(&since)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.copyProducts(state, from, to, embedder, regenerate, updated, false); err != nil {
+		return 0, err
+	}
+	synced := len(updated)
+
+	if withDeletes {
+		sourceIDs, err := from.scrollProductIDs(nil)
+		if err != nil {
+			return synced, err
+		}
+		targetIDs, err := to.scrollProductIDs(nil)
+		if err != nil {
+			return synced, err
+		}
+
+		existing := make(map[string]bool, len(sourceIDs))
+		for _, productID := range sourceIDs {
+			existing[productID] = true
+		}
+		for _, productID := range targetIDs {
+			if existing[productID] {
+				continue
+			}
+			if err := to.DeleteProduct(productID); err != nil {
+				return synced, err
+			}
+			synced++
+		}
+	}
+
+	return synced, nil
+}
+
+// copyProducts 按批读取商品并由 worker 并发写入目标集合
+// mainPass 为 true 时计入构建进度；追平阶段（false）会跳过目标集合中更新的商品
+func (m *ReindexManager) copyProducts(state *reindexJobState, from, to *QdrantService, embedder *EmbeddingService,
+	regenerate bool, productIDs []string, mainPass bool) error {
+	work := make(chan *models.Product)
+	var wg sync.WaitGroup
+	for i := 0; i < m.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for product := range work {
+				err := m.copyProduct(product, to, embedder, regenerate, !mainPass)
+				m.recordResult(state, product, err, mainPass)
+			}
+		}()
+	}
+
+	var readErr error
+	for start := 0; start < len(productIDs) && !m.isCancelled(state); start += reindexBatchSize {
+		batch := productIDs[start:min(start+reindexBatchSize, len(productIDs))]
+		products, err := from.getProducts(batch, false)
+		if err != nil {
+			readErr = err
+			break
+		}
+		if mainPass {
+			m.addProcessed(state, len(batch)-len(products)) // 构建期间被删除的商品
+		}
+		for _, product := range products {
+			work <- product
+		}
+	}
+
+	close(work)
+	wg.Wait()
+	return readErr
+}
+
+// copyProduct 用目标模型重新向量化商品的变体（或重新生成变体）并写入 to
+// incremental 为 true 时，to 中更新时间更晚的商品保持不变，变体指纹相同的商品只更新 payload
+func (m *ReindexManager) copyProduct(product *models.Product, to *QdrantService, embedder *EmbeddingService,
+	regenerate, incremental bool) error {
+	if incremental {
+		existing, err := to.GetProduct(product.ID)
+		if err != nil && !errors.Is(err, ErrProductNotFound) {
+			return err
+		}
+		if existing != nil {
+			if existing.UpdatedAt.After(product.UpdatedAt) {
+				return nil
+			}
+			if existing.VariantHash != "" && existing.VariantHash == VariantHash(product) && len(existing.Variants) > 0 {
+				product.Variants = existing.Variants
+				product.Generation = existing.Generation
+				return to.UpdateProductPayload(product)
+			}
+		}
+	}
+
+	var variants []models.ProductVariant
+	var err error
+	if regenerate || len(product.Variants) == 0 {
+		if m.variants == nil {
+			return fmt.Errorf("product %s has no variants to re-embed", product.ID)
+		}
+		variantCount := len(product.Variants)
+		if variantCount == 0 {
+			variantCount = defaultImportVariantCount
+		}
+		variants, err = m.variants.GenerateVariantsWithEmbeddings(context.Background(), product, variantCount, embedder)
+	} else {
+		texts := make([]string, len(product.Variants))
+		for i, variant := range product.Variants {
+			texts[i] = variant.Text
+		}
+		variants, err = embedder.GetProductVariantEmbeddings(context.Background(), texts)
+		for i := range variants {
+			variants[i].ProductID = product.ID
+			variants[i].GeneratedAt = product.Variants[i].GeneratedAt
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to embed variants: %w", err)
+	}
+
+	return to.InsertProduct(product, variants)
+}
+
+// validateReindex 比较两个集合的商品数量
+func validateReindex(source, target *QdrantService) (*models.ReindexValidation, error) {
+	sourceCount, err := source.CountProducts(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count source products: %w", err)
+	}
+	targetCount, err := target.CountProducts(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count target products: %w", err)
+	}
+	return &models.ReindexValidation{
+		SourceCount: sourceCount,
+		TargetCount: targetCount,
+		Passed:      sourceCount == targetCount,
+	}, nil
+}
+
+// newReindexEmbedder 创建使用指定模型的 embedding 服务（不带缓存，缓存的向量属于当前模型）
+func newReindexEmbedder(model string) *EmbeddingService {
+	embedder := NewEmbeddingService()
+	embedder.SetModel(model)
+	return embedder
+}
+
+// currentModel 当前线上使用的 embedding 模型
+func (m *ReindexManager) currentModel() string {
+	if m.embedding != nil {
+		return m.embedding.Model()
+	}
+	defer AcquireServing()()
+	return config.AppConfig.OpenAI.EmbeddingModel
+}
+
+// recordResult 记录单个商品的处理结果，定期落盘
+func (m *ReindexManager) recordResult(state *reindexJobState, product *models.Product, err error, mainPass bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job := &state.job
+	if mainPass {
+		job.Processed++
+	}
+	job.UpdatedAt = time.Now()
+
+	if err != nil {
+		logrus.Errorf("Reindex job %s product %s failed: %v", job.ID, product.ID, err)
+		job.Failed++
+		if len(job.Errors) < maxReindexErrorReport {
+			job.Errors = append(job.Errors, models.BatchImportError{
+				Index:   job.Failed - 1,
+				Product: product.ID,
+				Error:   err.Error(),
+			})
+		}
+	}
+
+	state.unsaved++
+	if state.unsaved >= reindexPersistInterval {
+		m.saveLogged(state)
+	}
+}
+
+// addProcessed 计入已处理但无需写入的商品
+func (m *ReindexManager) addProcessed(state *reindexJobState, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state.job.Processed += n
+}
+
+// isCancelled 判断任务是否已请求取消
+func (m *ReindexManager) isCancelled(state *reindexJobState) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return state.cancel
+}
+
+// dropTarget 删除未切换的新集合，调用方需持有锁
+func (m *ReindexManager) dropTarget(state *reindexJobState) {
+	if err := m.qdrant.DeleteCollectionVersion(state.job.TargetCollection); err != nil {
+		logrus.Warnf("Failed to delete collection %s of reindex job %s: %v",
+			state.job.TargetCollection, state.job.ID, err)
+	}
+}
+
+// finishLocked 结束任务，调用方需持有锁
+func (m *ReindexManager) finishLocked(state *reindexJobState, status string) {
+	now := time.Now()
+	state.job.Status = status
+	state.job.FinishedAt = &now
+	state.job.UpdatedAt = now
+}
+
+// snapshot 复制任务状态，调用方需持有锁
+func (m *ReindexManager) snapshot(state *reindexJobState, withErrors bool) *models.ReindexJob {
+	job := state.job
+	if withErrors {
+		job.Errors = append([]models.BatchImportError{}, state.job.Errors...)
+	} else {
+		job.Errors = nil
+	}
+	if job.Validation != nil {
+		validation := *job.Validation
+		job.Validation = &validation
+	}
+	return &job
+}
+
+// saveLogged 写入任务状态文件，失败时只记录日志，调用方需持有锁
+func (m *ReindexManager) saveLogged(state *reindexJobState) {
+	if err := m.save(state); err != nil {
+		logrus.Errorf("Failed to persist reindex job %s: %v", state.job.ID, err)
+	}
+}
+
+// save 写入任务状态文件（先写临时文件再重命名），调用方需持有锁
+func (m *ReindexManager) save(state *reindexJobState) error {
+	data, err := json.Marshal(state.job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reindex job: %w", err)
+	}
+
+	path := filepath.Join(m.dir, state.job.ID+".json")
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write reindex job: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to write reindex job: %w", err)
+	}
+
+	state.unsaved = 0
+	return nil
+}
+
+// loadJobs 加载任务目录中的任务，重启前仍在构建的任务标记为失败
+func (m *ReindexManager) loadJobs() error {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read reindex job dir: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(m.dir, name))
+		if err != nil {
+			logrus.Warnf("Failed to read reindex job %s: %v", name, err)
+			continue
+		}
+		state := &reindexJobState{}
+		if err := json.Unmarshal(data, &state.job); err != nil {
+			logrus.Warnf("Failed to parse reindex job %s: %v", name, err)
+			continue
+		}
+
+		m.jobs[state.job.ID] = state
+		if state.job.Status == models.ReindexRunning {
+			state.job.Message = fmt.Sprintf("interrupted by restart, collection %s can be deleted", state.job.TargetCollection)
+			m.finishLocked(state, models.ReindexFailed)
+			m.saveLogged(state)
+			logrus.Warnf("Reindex job %s was interrupted by restart", state.job.ID)
+		}
+	}
+
+	return nil
+}
+
+// scrollProductIDs 列出集合中的商品 ID，since 不为 nil 时只返回该时间之后更新过的商品
+func (s *QdrantService) scrollProductIDs(since *time.Time) ([]string, error) {
+	if err := s.ensureInitialized(); err != nil {
+		return nil, err
+	}
+
+	filter := &qdrant.Filter{
+		Must: []*qdrant.Condition{qdrant.NewMatchInt("variant_index", 0)},
+	}
+	if since != nil {
+		filter.Must = append(filter.Must, qdrant.NewRange("updated_at", &qdrant.Range{
+			Gte: qdrant.PtrOf(float64(since.Unix())),
+		}))
+	}
+
+	ctx := context.Background()
+	seen := make(map[string]bool) // 重新生成变体的过程中同一商品可能有两个首变体
+	productIDs := make([]string, 0)
+
+	var offset *qdrant.PointId
+	for {
+		points, nextOffset, err := s.client.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+			CollectionName: s.collectionName,
+			Filter:         filter,
+			Limit:          qdrant.PtrOf(uint32(256)),
+			Offset:         offset,
+			WithPayload:    qdrant.NewWithPayloadInclude("product_id"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scroll product ids: %w", err)
+		}
+
+		for _, point := range points {
+			productID := s.extractStringFromValue(point.Payload["product_id"])
+			if productID == "" || seen[productID] {
+				continue
+			}
+			seen[productID] = true
+			productIDs = append(productIDs, productID)
+		}
+
+		if nextOffset == nil {
+			break
+		}
+		offset = nextOffset
+	}
+
+	return productIDs, nil
+}
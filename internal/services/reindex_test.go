@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// switchModel 模拟重建索引切换模型和集合
+func switchModel() {
+	servingMu.Lock()
+	servingGeneration++
+	servingMu.Unlock()
+}
+
+func TestWithServingReembedsAfterSwitch(t *testing.T) {
+	prepared, applied := 0, 0
+	err := WithServing(func() error {
+		prepared++
+		if prepared == 1 {
+			switchModel()
+		}
+		return nil
+	}, func() error {
+		applied++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if prepared != 2 || applied != 1 {
+		t.Fatalf("prepared %d times, applied %d times; want 2 and 1", prepared, applied)
+	}
+}
+
+func TestWithServingGivesUpWhileSwitching(t *testing.T) {
+	err := WithServing(func() error {
+		switchModel()
+		return nil
+	}, func() error {
+		t.Fatal("apply ran with a stale embedding")
+		return nil
+	})
+	if !errors.Is(err, ErrServingChanged) {
+		t.Fatalf("error = %v, want ErrServingChanged", err)
+	}
+}
+
+func TestWithServingDoesNotBlockSwitchWhileEmbedding(t *testing.T) {
+	embedding := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- WithServing(func() error {
+			<-embedding
+			return nil
+		}, func() error { return nil })
+	}()
+
+	switched := make(chan struct{})
+	go func() {
+		switchModel()
+		close(switched)
+	}()
+	select {
+	case <-switched:
+	case <-time.After(time.Second):
+		t.Fatal("switch waited for an in-flight embedding")
+	}
+
+	close(embedding)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"math"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// 得分归一化
+// 不同距离度量的原始得分含义不同：Cosine / Dot 越大越相似，Euclid / Manhattan 是距离、越小越相似。
+// 归一化后统一为"余弦相似度尺度"（越大越相似），使 similarity_threshold 在各种度量下含义一致。
+// Embedding 模型输出的向量通常已归一化为单位向量，此时 Dot 等于余弦相似度，
+// 欧氏距离满足 d² = 2 - 2·cos，可以精确互相换算；曼哈顿距离没有精确换算，使用 1/(1+d) 近似。
+
+// higherIsBetter 判断该距离度量下原始得分是否越大越好
+func higherIsBetter(distance qdrant.Distance) bool {
+	return distance != qdrant.Distance_Euclid && distance != qdrant.Distance_Manhattan
+}
+
+// normalizeScore 将原始得分映射到余弦相似度尺度
+func normalizeScore(raw float32, distance qdrant.Distance) float64 {
+	score := float64(raw)
+	switch distance {
+	case qdrant.Distance_Euclid:
+		return 1 - score*score/2
+	case qdrant.Distance_Manhattan:
+		return 1 / (1 + score)
+	default:
+		return score
+	}
+}
+
+// rawThreshold 将余弦尺度的阈值换算为该距离度量下的原始 score_threshold
+// 对 Euclid / Manhattan，Qdrant 会把 score_threshold 当作距离上限使用
+func rawThreshold(threshold float64, distance qdrant.Distance) float32 {
+	switch distance {
+	case qdrant.Distance_Euclid:
+		return float32(math.Sqrt(math.Max(0, 2-2*threshold)))
+	case qdrant.Distance_Manhattan:
+		if threshold <= 0 {
+			return float32(math.MaxFloat32)
+		}
+		return float32(1/threshold - 1)
+	default:
+		return float32(threshold)
+	}
+}
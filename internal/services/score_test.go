@@ -0,0 +1,53 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+func TestNormalizeScore(t *testing.T) {
+	cases := []struct {
+		raw      float32
+		distance qdrant.Distance
+		want     float64
+	}{
+		{0.8, qdrant.Distance_Cosine, 0.8},
+		{0.8, qdrant.Distance_Dot, 0.8},
+		{0, qdrant.Distance_Euclid, 1},
+		{1, qdrant.Distance_Euclid, 0.5},
+		{float32(math.Sqrt2), qdrant.Distance_Euclid, 0},
+		{0, qdrant.Distance_Manhattan, 1},
+		{3, qdrant.Distance_Manhattan, 0.25},
+	}
+	for _, tc := range cases {
+		if got := normalizeScore(tc.raw, tc.distance); math.Abs(got-tc.want) > 1e-6 {
+			t.Errorf("normalizeScore(%v, %v) = %v, want %v", tc.raw, tc.distance, got, tc.want)
+		}
+	}
+}
+
+func TestRawThresholdRoundTrip(t *testing.T) {
+	distances := []qdrant.Distance{qdrant.Distance_Cosine, qdrant.Distance_Dot, qdrant.Distance_Euclid, qdrant.Distance_Manhattan}
+	for _, distance := range distances {
+		for _, threshold := range []float64{0.1, 0.5, 0.75, 0.99} {
+			raw := rawThreshold(threshold, distance)
+			if got := normalizeScore(raw, distance); math.Abs(got-threshold) > 1e-5 {
+				t.Errorf("%v: normalizeScore(rawThreshold(%v)) = %v", distance, threshold, got)
+			}
+		}
+	}
+
+	// 距离度量下原始阈值是距离上限：阈值越高，允许的距离越小
+	if rawThreshold(0.9, qdrant.Distance_Euclid) >= rawThreshold(0.5, qdrant.Distance_Euclid) {
+		t.Errorf("euclid threshold should shrink as similarity grows")
+	}
+	if higherIsBetter(qdrant.Distance_Euclid) || higherIsBetter(qdrant.Distance_Manhattan) || !higherIsBetter(qdrant.Distance_Cosine) {
+		t.Errorf("higherIsBetter reports the wrong direction")
+	}
+	// 阈值为 0 时 Manhattan 不做限制
+	if rawThreshold(0, qdrant.Distance_Manhattan) != math.MaxFloat32 {
+		t.Errorf("manhattan threshold 0 should be unbounded")
+	}
+}
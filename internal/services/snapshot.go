@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"search-ec2/internal/config"
+	"search-ec2/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 集合快照
+// 创建、列出、删除快照使用 gRPC 接口；下载和上传恢复只有 REST 接口，使用 qdrant.http_port。
+// 快照是集合在某一时刻的完整备份（包括向量和索引），恢复时整个集合被替换。
+// 快照属于别名当前指向的物理集合，切换别名后旧集合的快照不会出现在列表中。
+
+// defaultQdrantHTTPPort Qdrant REST 接口默认端口
+const defaultQdrantHTTPPort = 6333
+
+// ErrSnapshotNotFound 快照不存在
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// CreateSnapshot 创建集合快照
+func (s *QdrantService) CreateSnapshot() (*models.SnapshotInfo, error) {
+	collection, err := s.LiveCollection()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := s.client.CreateSnapshot(context.Background(), collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	info := &models.SnapshotInfo{
+		Name:      snapshot.GetName(),
+		CreatedAt: snapshot.GetCreationTime().AsTime(),
+		Size:      snapshot.GetSize(),
+		Checksum:  snapshot.GetChecksum(),
+	}
+	logrus.Infof("Snapshot %s created for collection %s", info.Name, collection)
+	return info, nil
+}
+
+// ListSnapshots 列出集合快照
+func (s *QdrantService) ListSnapshots() ([]models.SnapshotInfo, error) {
+	collection, err := s.LiveCollection()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := s.client.ListSnapshots(context.Background(), collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	result := make([]models.SnapshotInfo, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		result = append(result, models.SnapshotInfo{
+			Name:      snapshot.GetName(),
+			CreatedAt: snapshot.GetCreationTime().AsTime(),
+			Size:      snapshot.GetSize(),
+			Checksum:  snapshot.GetChecksum(),
+		})
+	}
+	return result, nil
+}
+
+// DeleteSnapshot 删除集合快照
+func (s *QdrantService) DeleteSnapshot(name string) error {
+	collection, err := s.LiveCollection()
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.DeleteSnapshot(context.Background(), collection, name); err != nil {
+		return fmt.Errorf("failed to delete snapshot %s: %w", name, err)
+	}
+	logrus.Infof("Snapshot %s deleted", name)
+	return nil
+}
+
+// DownloadSnapshot 下载快照文件写入 w，返回写入的字节数
+func (s *QdrantService) DownloadSnapshot(name string, w io.Writer) (int64, error) {
+	collection, err := s.LiveCollection()
+	if err != nil {
+		return 0, err
+	}
+
+	request, err := s.restRequest(http.MethodGet,
+		"/collections/"+url.PathEscape(collection)+"/snapshots/"+url.PathEscape(name), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return 0, fmt.Errorf("failed to download snapshot: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return 0, fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return 0, fmt.Errorf("failed to download snapshot: status %d: %s", response.StatusCode, body)
+	}
+
+	written, err := io.Copy(w, response.Body)
+	if err != nil {
+		return written, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return written, nil
+}
+
+// RestoreSnapshot 上传快照文件并用它替换当前集合
+// 恢复后重新检查集合的向量参数，快照的向量维度与配置不一致时后续请求会返回 ErrVectorParamsMismatch
+func (s *QdrantService) RestoreSnapshot(r io.Reader, filename string) error {
+	collection, err := s.LiveCollection()
+	if err != nil {
+		return err
+	}
+	if filename == "" {
+		filename = collection + ".snapshot"
+	}
+
+	// 边读边上传，不把快照文件加载到内存
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		part, err := form.CreateFormFile("snapshot", filename)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	request, err := s.restRequest(http.MethodPost,
+		"/collections/"+url.PathEscape(collection)+"/snapshots/upload?wait=true&priority=snapshot", body)
+	if err != nil {
+		body.Close()
+		return err
+	}
+	request.Header.Set("Content-Type", form.FormDataContentType())
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to upload snapshot: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("failed to restore snapshot: status %d: %s", response.StatusCode, message)
+	}
+
+	// 集合已被替换，下次使用时重新初始化
+	s.initMu.Lock()
+	s.initialized = false
+	s.initMu.Unlock()
+
+	logrus.Infof("Collection %s restored from snapshot %s", collection, filename)
+	return nil
+}
+
+// restRequest 构建 Qdrant REST 请求
+func (s *QdrantService) restRequest(method, path string, body io.Reader) (*http.Request, error) {
+	port := config.AppConfig.Qdrant.HTTPPort
+	if port <= 0 {
+		port = defaultQdrantHTTPPort
+	}
+
+	request, err := http.NewRequest(method, fmt.Sprintf("http://%s:%d%s", config.AppConfig.Qdrant.Host, port, path), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Qdrant request: %w", err)
+	}
+	if apiKey := config.AppConfig.Qdrant.APIKey; apiKey != "" {
+		request.Header.Set("api-key", apiKey)
+	}
+	return request, nil
+}
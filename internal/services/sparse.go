@@ -0,0 +1,159 @@
+package services
+
+import (
+	"hash/fnv"
+	"search-ec2/internal/config"
+	"search-ec2/internal/models"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// sparseVectorName 集合中稀疏（关键词）向量的名称
+const sparseVectorName = "keywords"
+
+// BM25 参数：IDF 部分由 Qdrant 的 idf modifier 在服务端计算，本地只计算词频饱和部分
+const (
+	bm25K1        = 1.2
+	bm25B         = 0.75
+	bm25AvgDocLen = 48.0 // 商品文档（变体 + 名称 + 品牌等）的经验平均词数
+)
+
+// SparseVector 稀疏向量
+type SparseVector struct {
+	Indices []uint32
+	Values  []float32
+}
+
+// IsEmpty 判断稀疏向量是否为空
+func (v SparseVector) IsEmpty() bool {
+	return len(v.Indices) == 0
+}
+
+// SparseEncoder BM25 风格的稀疏向量编码器
+// 拉丁字母和数字按词切分（小写），型号类的连字符词额外生成拼接词，
+// 中文按单字和相邻双字切分，无需外部分词词典。
+type SparseEncoder struct{}
+
+// NewSparseEncoder 创建稀疏向量编码器
+func NewSparseEncoder() *SparseEncoder {
+	return &SparseEncoder{}
+}
+
+// EncodeDocument 编码文档：BM25 词频饱和权重
+func (e *SparseEncoder) EncodeDocument(text string) SparseVector {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return SparseVector{}
+	}
+
+	counts := make(map[uint32]float64)
+	for _, token := range tokens {
+		counts[termID(token)]++
+	}
+
+	docLen := float64(len(tokens))
+	norm := bm25K1 * (1 - bm25B + bm25B*docLen/bm25AvgDocLen)
+
+	weights := make(map[uint32]float32, len(counts))
+	for id, tf := range counts {
+		weights[id] = float32(tf * (bm25K1 + 1) / (tf + norm))
+	}
+	return sparseFromMap(weights)
+}
+
+// EncodeQuery 编码查询：每个词权重为 1，由服务端 IDF 决定词的重要性
+func (e *SparseEncoder) EncodeQuery(text string) SparseVector {
+	weights := make(map[uint32]float32)
+	for _, token := range tokenize(text) {
+		weights[termID(token)] = 1
+	}
+	return sparseFromMap(weights)
+}
+
+// sparseFromMap 将权重表转换为按索引排序的稀疏向量
+func sparseFromMap(weights map[uint32]float32) SparseVector {
+	vector := SparseVector{
+		Indices: make([]uint32, 0, len(weights)),
+		Values:  make([]float32, 0, len(weights)),
+	}
+	for id := range weights {
+		vector.Indices = append(vector.Indices, id)
+	}
+	sort.Slice(vector.Indices, func(i, j int) bool { return vector.Indices[i] < vector.Indices[j] })
+	for _, id := range vector.Indices {
+		vector.Values = append(vector.Values, weights[id])
+	}
+	return vector
+}
+
+// termID 词的哈希 ID
+func termID(token string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(token))
+	return h.Sum32()
+}
+
+// tokenize 切分文本
+func tokenize(text string) []string {
+	tokens := make([]string, 0)
+	var word []rune     // 当前拉丁字母/数字词
+	var compound []rune // 由 - _ . / 连接的型号词，如 WH-1000XM5
+	compoundParts := 0
+	var prevHan rune
+
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			compound = append(compound, word...)
+			compoundParts++
+			word = word[:0]
+		}
+	}
+	flushCompound := func() {
+		flushWord()
+		if compoundParts > 1 {
+			tokens = append(tokens, string(compound))
+		}
+		compound = compound[:0]
+		compoundParts = 0
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushCompound()
+			tokens = append(tokens, string(r))
+			if prevHan != 0 {
+				tokens = append(tokens, string([]rune{prevHan, r}))
+			}
+			prevHan = r
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word = append(word, r)
+		case r == '-' || r == '_' || r == '.' || r == '/':
+			flushWord()
+		default:
+			flushCompound()
+		}
+		prevHan = 0
+	}
+	flushCompound()
+
+	return tokens
+}
+
+// sparseDocumentText 构建变体点的关键词文档：变体文本加上适合精确匹配的商品字段
+func sparseDocumentText(product *models.Product, variant models.ProductVariant) string {
+	parts := []string{variant.Text, product.Name, product.Brand, product.Category}
+	for name, value := range product.Attributes {
+		// 已注册的属性只有标记为 searchable 时才参与关键词检索
+		if attr, ok := config.AttributeRegistry().Lookup(name); ok && !attr.Searchable {
+			continue
+		}
+		if str, ok := value.(string); ok {
+			parts = append(parts, str)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,38 @@
+package services
+
+import "testing"
+
+func TestSparseEncoder(t *testing.T) {
+	encoder := NewSparseEncoder()
+
+	query := encoder.EncodeQuery("wh1000xm5 耳机")
+	document := encoder.EncodeDocument("Sony WH-1000XM5 降噪耳机 耳机")
+	if query.IsEmpty() || document.IsEmpty() {
+		t.Fatalf("query = %+v, document = %+v", query, document)
+	}
+
+	weights := make(map[uint32]float32, len(document.Indices))
+	for i, id := range document.Indices {
+		if i > 0 && document.Indices[i-1] >= id {
+			t.Fatalf("indices not sorted: %v", document.Indices)
+		}
+		weights[id] = document.Values[i]
+	}
+	// 连字符型号写法不同也能命中，查询中的每个词都出现在文档中
+	for i, id := range query.Indices {
+		if query.Values[i] != 1 {
+			t.Errorf("query weight = %v, want 1", query.Values[i])
+		}
+		if _, ok := weights[id]; !ok {
+			t.Errorf("query term %d missing from document", id)
+		}
+	}
+	// 词频越高权重越高，但受 BM25 饱和限制
+	if earphone, sony := weights[termID("耳机")], weights[termID("sony")]; earphone <= sony || earphone >= bm25K1+1 {
+		t.Errorf("耳机 weight %v, sony weight %v", earphone, sony)
+	}
+
+	if !encoder.EncodeQuery("  ,.!").IsEmpty() {
+		t.Errorf("punctuation-only query should be empty")
+	}
+}
@@ -1,41 +1,33 @@
 package services
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"search-ec2/internal/config"
+	"search-ec2/internal/llm"
 	"search-ec2/internal/models"
 	"strings"
-	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 // VariantGenerationService AI 变体生成服务
 type VariantGenerationService struct {
-	client  *http.Client
-	baseURL string
-	apiKey  string
-	model   string
+	route *llm.Route // 变体生成使用的模型（models.variants）
 }
 
 // NewVariantGenerationService 创建变体生成服务
 func NewVariantGenerationService() *VariantGenerationService {
 	return &VariantGenerationService{
-		client: &http.Client{
-			Timeout: time.Duration(config.AppConfig.OpenAI.Timeout) * time.Second,
-		},
-		baseURL: config.AppConfig.OpenAI.BaseURL,
-		apiKey:  config.AppConfig.OpenAI.APIKey,
-		model:   config.AppConfig.OpenAI.ChatModel,
+		route: llm.NewRoute(config.TaskVariants),
 	}
 }
 
 // GenerateVariants 为商品生成变体描述
-func (s *VariantGenerationService) GenerateVariants(product *models.Product, variantCount int) ([]string, error) {
+func (s *VariantGenerationService) GenerateVariants(ctx context.Context, product *models.Product, variantCount int) ([]string, error) {
 	if variantCount <= 0 {
 		variantCount = 5 // 默认生成5个变体
 	}
@@ -49,7 +41,7 @@ func (s *VariantGenerationService) GenerateVariants(product *models.Product, var
 
 	// 构建请求
 	request := models.OpenAIRequest{
-		Model: s.model,
+		Model: s.route.Model(),
 		Messages: []models.OpenAIMessage{
 			{
 				Role:    "user",
@@ -61,7 +53,7 @@ func (s *VariantGenerationService) GenerateVariants(product *models.Product, var
 	}
 
 	// 发送请求
-	response, err := s.sendChatRequest(request)
+	response, err := s.sendChatRequest(ctx, request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate variants: %w", err)
 	}
@@ -98,7 +90,7 @@ func (s *VariantGenerationService) buildPrompt(product *models.Product, variantC
 		"{product_name}":  product.Name,
 		"{category}":      product.Category,
 		"{color}":         product.Color,
-		"{price}":         fmt.Sprintf("%.2f%s", product.Price, product.Currency),
+		"{price}":         promptPrice(product),
 		"{brand}":         product.Brand,
 		"{size}":          product.Size,
 		"{material}":      product.Material,
@@ -115,6 +107,34 @@ func (s *VariantGenerationService) buildPrompt(product *models.Product, variantC
 	return prompt
 }
 
+// promptPrice 提示词中的价格描述（价格+币种）
+func promptPrice(product *models.Product) string {
+	return fmt.Sprintf("%.2f%s", product.Price, product.Currency)
+}
+
+// VariantHash 计算变体指纹：提示词模板以及 buildPrompt 使用的全部商品字段（包括价格和币种）
+// 指纹不变时更新商品只需更新 payload，不重新调用 LLM 和 embedding
+func VariantHash(product *models.Product) string {
+	fields := []string{
+		config.VariantPromptTemplate,
+		product.Name,
+		product.Category,
+		product.Color,
+		promptPrice(product),
+		product.Brand,
+		product.Size,
+		product.Material,
+		product.Description,
+	}
+
+	hash := sha256.New()
+	for _, field := range fields {
+		// 以长度前缀分隔，避免字段拼接产生歧义
+		fmt.Fprintf(hash, "%d:%s;", len(field), field)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
 // parseVariants 解析变体 JSON 响应
 func (s *VariantGenerationService) parseVariants(content string) ([]string, error) {
 	// 尝试直接解析 JSON 数组
@@ -228,13 +248,14 @@ func (s *VariantGenerationService) isValidVariant(variant string, product *model
 
 // GenerateVariantsWithEmbeddings 生成变体并获取向量
 func (s *VariantGenerationService) GenerateVariantsWithEmbeddings(
+	ctx context.Context,
 	product *models.Product, 
 	variantCount int, 
 	embeddingService EmbeddingServiceInterface,
 ) ([]models.ProductVariant, error) {
 	
 	// 生成变体文本
-	variantTexts, err := s.GenerateVariants(product, variantCount)
+	variantTexts, err := s.GenerateVariants(ctx, product, variantCount)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate variant texts: %w", err)
 	}
@@ -244,7 +265,7 @@ func (s *VariantGenerationService) GenerateVariantsWithEmbeddings(
 	}
 
 	// 获取向量
-	productVariants, err := embeddingService.GetProductVariantEmbeddings(variantTexts)
+	productVariants, err := embeddingService.GetProductVariantEmbeddings(ctx, variantTexts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get variant embeddings: %w", err)
 	}
@@ -258,7 +279,9 @@ func (s *VariantGenerationService) GenerateVariantsWithEmbeddings(
 }
 
 // RegenerateVariants 重新生成商品变体
+// 新变体生成并写入成功后才删除旧变体，商品在此过程中始终可被检索
 func (s *VariantGenerationService) RegenerateVariants(
+	ctx context.Context,
 	productID string,
 	variantCount int,
 	qdrantService *QdrantService,
@@ -271,77 +294,46 @@ func (s *VariantGenerationService) RegenerateVariants(
 		return fmt.Errorf("failed to get product: %w", err)
 	}
 
-	// 删除旧变体
-	if err := qdrantService.DeleteProduct(productID); err != nil {
-		return fmt.Errorf("failed to delete old variants: %w", err)
-	}
-
-	// 生成新变体
-	variants, err := s.GenerateVariantsWithEmbeddings(product, variantCount, embeddingService)
+	// 先生成新变体，失败时旧变体保持不变
+	texts, err := s.GenerateVariants(ctx, product, variantCount)
 	if err != nil {
 		return fmt.Errorf("failed to generate new variants: %w", err)
 	}
+	if len(texts) == 0 {
+		return fmt.Errorf("failed to generate new variants: no valid variants generated")
+	}
 
-	// 插入新变体
-	if err := qdrantService.InsertProduct(product, variants); err != nil {
-		return fmt.Errorf("failed to insert new variants: %w", err)
+	// 向量化期间线上的模型被切换时重新向量化，写入时模型和集合不会被切换
+	var variants []models.ProductVariant
+	err = WithServing(func() error {
+		var err error
+		variants, err = embeddingService.GetProductVariantEmbeddings(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("failed to get variant embeddings: %w", err)
+		}
+		return nil
+	}, func() error {
+		for i := range variants {
+			variants[i].ProductID = product.ID
+		}
+		// 写入新一代变体并替换旧的变体
+		if err := qdrantService.InsertProduct(product, variants); err != nil {
+			return fmt.Errorf("failed to insert new variants: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	logrus.Infof("Regenerated %d variants for product %s", len(variants), productID)
 	return nil
 }
 
-// sendChatRequest 发送聊天请求
-func (s *VariantGenerationService) sendChatRequest(request models.OpenAIRequest) (*models.OpenAIResponse, error) {
-	// 序列化请求
-	requestBody, err := json.Marshal(request)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	// 创建 HTTP 请求
-	url := fmt.Sprintf("%s/chat/completions", s.baseURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// 设置请求头
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.apiKey))
-
-	// 发送请求
+// sendChatRequest 按 models.variants 的模型路由发送聊天请求（超时、重试和限流由共享的 LLM 客户端处理）
+func (s *VariantGenerationService) sendChatRequest(ctx context.Context, request models.OpenAIRequest) (*models.OpenAIResponse, error) {
 	logrus.Debugf("Sending variant generation request")
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// 读取响应
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	// 检查 HTTP 状态码
-	if resp.StatusCode != http.StatusOK {
-		logrus.Errorf("OpenAI API error: %s", string(responseBody))
-		return nil, fmt.Errorf("OpenAI API error: status %d", resp.StatusCode)
-	}
-
-	// 解析响应
-	var response models.OpenAIResponse
-	if err := json.Unmarshal(responseBody, &response); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
-
-	// 检查 API 错误
-	if response.Error != nil {
-		return nil, fmt.Errorf("OpenAI API error: %s", response.Error.Message)
-	}
-
-	return &response, nil
+	return s.route.ChatCompletion(ctx, &request)
 }
 
 // HealthCheck 健康检查
@@ -356,6 +348,6 @@ func (s *VariantGenerationService) HealthCheck() error {
 	}
 
 	// 尝试生成变体
-	_, err := s.GenerateVariants(testProduct, 2)
+	_, err := s.GenerateVariants(context.Background(), testProduct, 2)
 	return err
 }